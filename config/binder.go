@@ -0,0 +1,285 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Binder binds the keys of a JSON object to the fields of the configuration struct.
+// The fields keep the values assigned before binding if the keys are absent, which serves as the defaults.
+type Binder struct {
+	fields []*Field
+	checks []func() error
+}
+
+// Field is a field bound by Binder. The methods can be chained to add the validations.
+type Field struct {
+	name     string
+	required bool
+	decode   func(v interface{}) error
+	// number returns the value used by Range. This is nil if the field is not numeric.
+	number     func() float64
+	str        func() string
+	validators []func() error
+	// nested is the Binder of the object field bound by Binder.Object, whose decode is nil.
+	nested *Binder
+}
+
+// String binds the string field.
+func (b *Binder) String(name string, p *string) *Field {
+	return b.add(&Field{name: name, str: func() string { return *p }, decode: func(v interface{}) error {
+		s, ok := v.(string)
+		if !ok {
+			return errors.New("must be a string")
+		}
+		*p = s
+		return nil
+	}})
+}
+
+// Int binds the integer field.
+func (b *Binder) Int(name string, p *int) *Field {
+	return b.add(&Field{name: name,
+		str:    func() string { return strconv.Itoa(*p) },
+		number: func() float64 { return float64(*p) },
+		decode: func(v interface{}) error {
+			n, ok := v.(jsonNumber)
+			if !ok {
+				return errors.New("must be a number")
+			}
+			i, err := strconv.ParseInt(string(n), 10, 0)
+			if err != nil {
+				return fmt.Errorf("must be an integer: %s", n)
+			}
+			*p = int(i)
+			return nil
+		}})
+}
+
+// Float binds the floating point number field.
+func (b *Binder) Float(name string, p *float64) *Field {
+	return b.add(&Field{name: name,
+		str:    func() string { return strconv.FormatFloat(*p, 'g', -1, 64) },
+		number: func() float64 { return *p },
+		decode: func(v interface{}) error {
+			n, ok := v.(jsonNumber)
+			if !ok {
+				return errors.New("must be a number")
+			}
+			f, err := strconv.ParseFloat(string(n), 64)
+			if err != nil {
+				return err
+			}
+			*p = f
+			return nil
+		}})
+}
+
+// Bool binds the boolean field.
+func (b *Binder) Bool(name string, p *bool) *Field {
+	return b.add(&Field{name: name, str: func() string { return strconv.FormatBool(*p) }, decode: func(v interface{}) error {
+		bv, ok := v.(bool)
+		if !ok {
+			return errors.New("must be a boolean")
+		}
+		*p = bv
+		return nil
+	}})
+}
+
+// Duration binds the duration field given as a string accepted by time.ParseDuration, e.g. "1.5s".
+// The value for Range is in seconds.
+func (b *Binder) Duration(name string, p *time.Duration) *Field {
+	return b.add(&Field{name: name,
+		str:    func() string { return p.String() },
+		number: func() float64 { return p.Seconds() },
+		decode: func(v interface{}) error {
+			s, ok := v.(string)
+			if !ok {
+				return errors.New("must be a duration string such as \"1s\"")
+			}
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			*p = d
+			return nil
+		}})
+}
+
+// StringSlice binds the field of the array of strings.
+func (b *Binder) StringSlice(name string, p *[]string) *Field {
+	return b.add(&Field{name: name, str: func() string { return fmt.Sprintf("%q", *p) }, decode: func(v interface{}) error {
+		arr, ok := v.([]interface{})
+		if !ok {
+			return errors.New("must be an array")
+		}
+		r := make([]string, len(arr))
+		for i, e := range arr {
+			if r[i], ok = e.(string); !ok {
+				return fmt.Errorf("must be an array of strings: %d-th element is not a string", i)
+			}
+		}
+		*p = r
+		return nil
+	}})
+}
+
+// StringMap binds the field of the object whose values are strings.
+func (b *Binder) StringMap(name string, p *map[string]string) *Field {
+	return b.add(&Field{name: name, str: func() string { return fmt.Sprintf("%q", *p) }, decode: func(v interface{}) error {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return errors.New("must be an object")
+		}
+		r := make(map[string]string, len(obj))
+		for k, e := range obj {
+			if r[k], ok = e.(string); !ok {
+				return fmt.Errorf("must be an object of strings: value of %q is not a string", k)
+			}
+		}
+		*p = r
+		return nil
+	}})
+}
+
+// Object binds the nested object, whose fields are bound by the given function.
+func (b *Binder) Object(name string, bind func(b *Binder)) *Field {
+	nested := &Binder{}
+	bind(nested)
+	return b.add(&Field{name: name, nested: nested})
+}
+
+// Check adds the validation over multiple fields, which is called after all the fields are decoded.
+func (b *Binder) Check(f func() error) {
+	b.checks = append(b.checks, f)
+}
+
+func (b *Binder) add(f *Field) *Field {
+	b.fields = append(b.fields, f)
+	return f
+}
+
+// Required makes the field fail to decode if the key is absent or null.
+func (f *Field) Required() *Field {
+	f.required = true
+	return f
+}
+
+// Range makes the value of the numeric field fail to validate unless it is within [min, max].
+// This panics if the field is not numeric, i.e. not bound by Binder.Int, Binder.Float or Binder.Duration.
+func (f *Field) Range(min, max float64) *Field {
+	if f.number == nil {
+		panic(fmt.Sprintf("field %q is not numeric", f.name))
+	}
+	return f.Check(func() error {
+		if v := f.number(); v < min || v > max {
+			return fmt.Errorf("must be in range [%g, %g]: got %g", min, max, v)
+		}
+		return nil
+	})
+}
+
+// OneOf makes the value of the field fail to validate unless it is one of the given values.
+// This panics if the field is bound by Binder.Object.
+func (f *Field) OneOf(values ...string) *Field {
+	if f.str == nil {
+		panic(fmt.Sprintf("field %q is an object", f.name))
+	}
+	return f.Check(func() error {
+		v := f.str()
+		for _, allowed := range values {
+			if v == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %q: got %q", values, v)
+	})
+}
+
+// Check adds the custom validation of the field, which is called after the field is decoded
+// or left as the default.
+func (f *Field) Check(validate func() error) *Field {
+	f.validators = append(f.validators, validate)
+	return f
+}
+
+// decode decodes the object into the bound fields, and validates them. prefix is the path to this object.
+func (b *Binder) decode(obj map[string]interface{}, prefix string) error {
+	known := make(map[string]bool, len(b.fields))
+	for _, f := range b.fields {
+		known[f.name] = true
+		v, ok := obj[f.name]
+		if !ok || v == nil {
+			if f.required {
+				return fmt.Errorf("field %q: is required", prefix+f.name)
+			}
+		} else if f.nested != nil {
+			nested, ok := v.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("field %q: must be an object", prefix+f.name)
+			}
+			if err := f.nested.decode(nested, prefix+f.name+"."); err != nil {
+				return err
+			}
+		} else if err := f.decode(v); err != nil {
+			return fmt.Errorf("field %q: %w", prefix+f.name, err)
+		}
+		for _, validate := range f.validators {
+			if err := validate(); err != nil {
+				return fmt.Errorf("field %q: %w", prefix+f.name, err)
+			}
+		}
+	}
+
+	var unknown []string
+	for k := range obj {
+		if !known[k] {
+			unknown = append(unknown, prefix+k)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown fields: %s", strings.Join(unknown, ", "))
+	}
+
+	for _, check := range b.checks {
+		if err := check(); err != nil {
+			if prefix != "" {
+				return fmt.Errorf("object %q: %w", strings.TrimSuffix(prefix, "."), err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// values returns the string representations of the bound fields keyed by their paths, which are used to diff
+// configurations.
+func (b *Binder) values(prefix string, into map[string]string) {
+	for _, f := range b.fields {
+		if f.nested != nil {
+			f.nested.values(prefix+f.name+".", into)
+		} else {
+			into[prefix+f.name] = f.str()
+		}
+	}
+}
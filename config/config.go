@@ -0,0 +1,161 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config provides a loader of the plugin and VM configurations given in JSON into typed structs.
+// Only JSON is supported: YAML is not parsed, so the configurations given in YAML to the host need to be
+// converted to JSON beforehand. The fields are bound explicitly with Binder instead of reflection,
+// since TinyGo doesn't support encoding/json, e.g.
+//
+//	type pluginConfig struct {
+//		Upstream string
+//		Timeout  time.Duration
+//	}
+//
+//	func newPluginContext() *pluginContext {
+//		return &pluginContext{config: config.NewLoader(func(c *pluginConfig, b *config.Binder) {
+//			c.Timeout = time.Second // default
+//			b.String("upstream", &c.Upstream).Required()
+//			b.Duration("timeout", &c.Timeout).Range(0.001, 60)
+//		})}
+//	}
+//
+//	func (ctx *pluginContext) OnPluginStart(int) types.OnPluginStartStatus {
+//		return ctx.config.LoadPluginConfiguration()
+//	}
+package config
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+// Loader decodes the configurations into *T, and keeps the current one across the reconfigurations.
+type Loader[T any] struct {
+	bind     func(c *T, b *Binder)
+	onChange func(prev, next *T, changed []string)
+
+	current *T
+	values  map[string]string
+}
+
+// NewLoader returns a new Loader which binds the fields of *T with the given function. The function is called
+// with a new zero value for each decode, so it can assign the default values before binding the fields.
+func NewLoader[T any](bind func(c *T, b *Binder)) *Loader[T] {
+	return &Loader[T]{bind: bind}
+}
+
+// OnChange sets the function called when Update replaces the current configuration with a different one.
+// changed is the sorted paths of the changed fields, e.g. "upstream" and "limits.rps" for nested objects.
+func (l *Loader[T]) OnChange(f func(prev, next *T, changed []string)) *Loader[T] {
+	l.onChange = f
+	return l
+}
+
+// Current returns the current configuration, or nil if none has been loaded.
+func (l *Loader[T]) Current() *T {
+	return l.current
+}
+
+// Decode decodes the JSON data into a new *T without updating the current configuration.
+// Empty data is decoded as an empty object, so that the defaults and the required fields are applied.
+func (l *Loader[T]) Decode(data []byte) (*T, error) {
+	c, _, err := l.decode(data)
+	return c, err
+}
+
+func (l *Loader[T]) decode(data []byte) (*T, map[string]string, error) {
+	obj := map[string]interface{}{}
+	if len(data) > 0 {
+		v, err := parseJSON(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		var ok bool
+		if obj, ok = v.(map[string]interface{}); !ok {
+			return nil, nil, errors.New("configuration must be a json object")
+		}
+	}
+
+	c := new(T)
+	b := &Binder{}
+	l.bind(c, b)
+	if err := b.decode(obj, ""); err != nil {
+		return nil, nil, err
+	}
+	values := map[string]string{}
+	b.values("", values)
+	return c, values, nil
+}
+
+// Update decodes the JSON data, and replaces the current configuration with it.
+// If there is a current configuration and any field is changed, the function given to OnChange is called.
+// On error, the current configuration is kept.
+func (l *Loader[T]) Update(data []byte) (*T, error) {
+	next, values, err := l.decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	prev, prevValues := l.current, l.values
+	l.current, l.values = next, values
+	if prev == nil || l.onChange == nil {
+		return next, nil
+	}
+
+	var changed []string
+	for path, v := range values {
+		if prevValues[path] != v {
+			changed = append(changed, path)
+		}
+	}
+	if len(changed) > 0 {
+		sort.Strings(changed)
+		l.onChange(prev, next, changed)
+	}
+	return next, nil
+}
+
+// LoadPluginConfiguration updates the current configuration with proxywasm.GetPluginConfiguration,
+// and returns the status to be returned from types.PluginContext.OnPluginStart.
+// The reason of the failure is logged. As this is called on every proxy_on_configure,
+// the reconfiguration is notified to the function given to OnChange.
+func (l *Loader[T]) LoadPluginConfiguration() types.OnPluginStartStatus {
+	if err := l.load(proxywasm.GetPluginConfiguration); err != nil {
+		proxywasm.LogCriticalf("failed to load plugin configuration: %v", err)
+		return types.OnPluginStartStatusFailed
+	}
+	return types.OnPluginStartStatusOK
+}
+
+// LoadVMConfiguration updates the current configuration with proxywasm.GetVMConfiguration,
+// and returns the status to be returned from types.VMContext.OnVMStart. The reason of the failure is logged.
+func (l *Loader[T]) LoadVMConfiguration() types.OnVMStartStatus {
+	if err := l.load(proxywasm.GetVMConfiguration); err != nil {
+		proxywasm.LogCriticalf("failed to load vm configuration: %v", err)
+		return types.OnVMStartStatusFailed
+	}
+	return types.OnVMStartStatusOK
+}
+
+func (l *Loader[T]) load(get func() ([]byte, error)) error {
+	data, err := get()
+	if err != nil && !errors.Is(err, types.ErrorStatusNotFound) {
+		return err
+	}
+	_, err = l.Update(data)
+	return err
+}
@@ -0,0 +1,172 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/config"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+type limits struct {
+	RPS   int
+	Burst int
+}
+
+type pluginConfig struct {
+	Upstream string
+	Mode     string
+	Timeout  time.Duration
+	Ratio    float64
+	Enabled  bool
+	Keys     []string
+	Tags     map[string]string
+	Limits   limits
+}
+
+func newLoader() *config.Loader[pluginConfig] {
+	return config.NewLoader(func(c *pluginConfig, b *config.Binder) {
+		c.Mode = "enforce"
+		c.Timeout = time.Second
+		c.Limits.RPS = 100
+
+		b.String("upstream", &c.Upstream).Required()
+		b.String("mode", &c.Mode).OneOf("enforce", "dry_run")
+		b.Duration("timeout", &c.Timeout).Range(0.001, 60)
+		b.Float("ratio", &c.Ratio).Range(0, 1)
+		b.Bool("enabled", &c.Enabled)
+		b.StringSlice("keys", &c.Keys)
+		b.StringMap("tags", &c.Tags)
+		b.Object("limits", func(b *config.Binder) {
+			b.Int("rps", &c.Limits.RPS).Range(1, 10000)
+			b.Int("burst", &c.Limits.Burst)
+			b.Check(func() error {
+				if c.Limits.Burst != 0 && c.Limits.Burst < c.Limits.RPS {
+					return errors.New("burst must not be less than rps")
+				}
+				return nil
+			})
+		})
+	})
+}
+
+func TestLoader_Decode(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		c, err := newLoader().Decode([]byte(`{"upstream": "backend"}`))
+		require.NoError(t, err)
+		require.Equal(t, &pluginConfig{
+			Upstream: "backend",
+			Mode:     "enforce",
+			Timeout:  time.Second,
+			Limits:   limits{RPS: 100},
+		}, c)
+	})
+
+	t.Run("all", func(t *testing.T) {
+		c, err := newLoader().Decode([]byte(`{
+			"upstream": "backend", "mode": "dry_run", "timeout": "250ms", "ratio": 0.5, "enabled": true,
+			"keys": ["a", "b"], "tags": {"env": "prod"}, "limits": {"rps": 10, "burst": 20}
+		}`))
+		require.NoError(t, err)
+		require.Equal(t, &pluginConfig{
+			Upstream: "backend",
+			Mode:     "dry_run",
+			Timeout:  250 * time.Millisecond,
+			Ratio:    0.5,
+			Enabled:  true,
+			Keys:     []string{"a", "b"},
+			Tags:     map[string]string{"env": "prod"},
+			Limits:   limits{RPS: 10, Burst: 20},
+		}, c)
+	})
+
+	for _, tc := range []struct {
+		data   string
+		expErr string
+	}{
+		{data: ``, expErr: `field "upstream": is required`},
+		{data: `{"upstream": null}`, expErr: `field "upstream": is required`},
+		{data: `[]`, expErr: `configuration must be a json object`},
+		{data: `{"upstream": 1}`, expErr: `field "upstream": must be a string`},
+		{data: `{"upstream": "a", "mode": "off"}`, expErr: `field "mode": must be one of ["enforce" "dry_run"]: got "off"`},
+		{data: `{"upstream": "a", "timeout": "2m"}`, expErr: `field "timeout": must be in range [0.001, 60]: got 120`},
+		{data: `{"upstream": "a", "keys": ["a", 1]}`, expErr: `field "keys": must be an array of strings: 1-th element is not a string`},
+		{data: `{"upstream": "a", "limits": {"rps": 1.5}}`, expErr: `field "limits.rps": must be an integer: 1.5`},
+		{data: `{"upstream": "a", "limits": {"rps": 0}}`, expErr: `field "limits.rps": must be in range [1, 10000]: got 0`},
+		{data: `{"upstream": "a", "limits": {"burst": 1}}`, expErr: `object "limits": burst must not be less than rps`},
+		{data: `{"upstream": "a", "limits": 1}`, expErr: `field "limits": must be an object`},
+		{data: `{"upstream": "a", "tmieout": "1s", "limits": {"x": 1}}`, expErr: `unknown fields: limits.x`},
+		{data: `{"upstream": "a", "tmieout": "1s"}`, expErr: `unknown fields: tmieout`},
+	} {
+		t.Run(tc.data, func(t *testing.T) {
+			_, err := newLoader().Decode([]byte(tc.data))
+			require.EqualError(t, err, tc.expErr)
+		})
+	}
+}
+
+type configPlugin struct {
+	types.DefaultVMContext
+}
+
+type configPluginContext struct {
+	types.DefaultPluginContext
+	config *config.Loader[pluginConfig]
+}
+
+// NewPluginContext implements the same method on types.VMContext.
+func (*configPlugin) NewPluginContext(uint32) types.PluginContext {
+	ctx := &configPluginContext{config: newLoader()}
+	ctx.config.OnChange(func(prev, next *pluginConfig, changed []string) {
+		proxywasm.LogInfof("changed: %v", changed)
+	})
+	return ctx
+}
+
+// OnPluginStart implements the same method on types.PluginContext.
+func (ctx *configPluginContext) OnPluginStart(int) types.OnPluginStartStatus {
+	return ctx.config.LoadPluginConfiguration()
+}
+
+func TestLoader_LoadPluginConfiguration(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().
+		WithVMContext(&configPlugin{}).
+		WithPluginConfiguration([]byte(`{"upstream": "a", "limits": {"rps": 10}}`)))
+	defer reset()
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+	require.Empty(t, host.GetInfoLogs())
+
+	// Reconfiguration is diffed against the current one.
+	id := host.PluginContextIDs()[0]
+	require.Equal(t, types.OnPluginStartStatusOK, host.ReconfigurePlugin(id, []byte(`{"upstream": "b", "enabled": true}`)))
+	require.Equal(t, []string{fmt.Sprintf("changed: %v", []string{"enabled", "limits.rps", "upstream"})}, host.GetInfoLogs())
+
+	// The same configuration doesn't notify the change.
+	require.Equal(t, types.OnPluginStartStatusOK, host.ReconfigurePlugin(id, []byte(`{"enabled": true, "upstream": "b"}`)))
+	require.Len(t, host.GetInfoLogs(), 1)
+
+	// The invalid configuration is rejected with the reason.
+	require.Equal(t, types.OnPluginStartStatusFailed, host.ReconfigurePlugin(id, []byte(`{"upstream": "c", "ratio": 2}`)))
+	require.Equal(t, []string{`failed to load plugin configuration: field "ratio": must be in range [0, 1]: got 2`},
+		host.GetCriticalLogs())
+}
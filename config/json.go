@@ -0,0 +1,291 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// This file hosts a minimal JSON parser which doesn't rely on reflection, since TinyGo doesn't support encoding/json.
+// JSON values are parsed into the following Go values:
+//
+//	object: map[string]interface{}
+//	array:  []interface{}
+//	string: string
+//	number: jsonNumber
+//	true, false: bool
+//	null: nil
+
+// maxJSONDepth is the max nesting depth of JSON objects and arrays, which bounds the recursion of the parser
+// so that a malicious configuration cannot exhaust the stack.
+const maxJSONDepth = 64
+
+// jsonNumber keeps the literal of a JSON number so that integers are decoded without the loss of precision.
+type jsonNumber string
+
+func parseJSON(data []byte) (interface{}, error) {
+	p := &jsonParser{data: data}
+	p.skipSpaces()
+	v, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos != len(p.data) {
+		return nil, p.errorf("unexpected trailing data")
+	}
+	return v, nil
+}
+
+type jsonParser struct {
+	data []byte
+	pos  int
+	// depth is the nesting depth of the object or array being parsed.
+	depth int
+}
+
+func (p *jsonParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid json at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *jsonParser) skipSpaces() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *jsonParser) parseValue() (interface{}, error) {
+	if p.pos >= len(p.data) {
+		return nil, p.errorf("unexpected end of data")
+	}
+	switch c := p.data[p.pos]; {
+	case c == '{' || c == '[':
+		if p.depth >= maxJSONDepth {
+			return nil, p.errorf("exceeded the max nesting depth %d", maxJSONDepth)
+		}
+		p.depth++
+		defer func() { p.depth-- }()
+		if c == '{' {
+			return p.parseObject()
+		}
+		return p.parseArray()
+	case c == '"':
+		return p.parseString()
+	case c == '-' || ('0' <= c && c <= '9'):
+		return p.parseNumber()
+	case p.consumeLiteral("true"):
+		return true, nil
+	case p.consumeLiteral("false"):
+		return false, nil
+	case p.consumeLiteral("null"):
+		return nil, nil
+	default:
+		return nil, p.errorf("unexpected character %q", c)
+	}
+}
+
+func (p *jsonParser) consumeLiteral(literal string) bool {
+	if strings.HasPrefix(string(p.data[p.pos:]), literal) {
+		p.pos += len(literal)
+		return true
+	}
+	return false
+}
+
+func (p *jsonParser) parseObject() (interface{}, error) {
+	p.pos++ // '{'
+	obj := map[string]interface{}{}
+	p.skipSpaces()
+	if p.pos < len(p.data) && p.data[p.pos] == '}' {
+		p.pos++
+		return obj, nil
+	}
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.data) || p.data[p.pos] != '"' {
+			return nil, p.errorf("expected object key")
+		}
+		key, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if p.pos >= len(p.data) || p.data[p.pos] != ':' {
+			return nil, p.errorf("expected ':' after object key")
+		}
+		p.pos++
+		p.skipSpaces()
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		obj[key] = value
+		p.skipSpaces()
+		if p.pos >= len(p.data) {
+			return nil, p.errorf("unexpected end of object")
+		}
+		switch p.data[p.pos] {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return obj, nil
+		default:
+			return nil, p.errorf("expected ',' or '}' in object")
+		}
+	}
+}
+
+func (p *jsonParser) parseArray() (interface{}, error) {
+	p.pos++ // '['
+	arr := []interface{}{}
+	p.skipSpaces()
+	if p.pos < len(p.data) && p.data[p.pos] == ']' {
+		p.pos++
+		return arr, nil
+	}
+	for {
+		p.skipSpaces()
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, value)
+		p.skipSpaces()
+		if p.pos >= len(p.data) {
+			return nil, p.errorf("unexpected end of array")
+		}
+		switch p.data[p.pos] {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			return arr, nil
+		default:
+			return nil, p.errorf("expected ',' or ']' in array")
+		}
+	}
+}
+
+func (p *jsonParser) parseString() (string, error) {
+	p.pos++ // '"'
+	var b strings.Builder
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return b.String(), nil
+		case c == '\\':
+			p.pos++
+			if p.pos >= len(p.data) {
+				return "", p.errorf("unexpected end of string")
+			}
+			esc := p.data[p.pos]
+			p.pos++
+			switch esc {
+			case '"', '\\', '/':
+				b.WriteByte(esc)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				r, err := p.parseUnicodeEscape()
+				if err != nil {
+					return "", err
+				}
+				b.WriteRune(r)
+			default:
+				return "", p.errorf("invalid escape character %q", esc)
+			}
+		case c < 0x20:
+			return "", p.errorf("invalid control character in string")
+		default:
+			r, size := utf8.DecodeRune(p.data[p.pos:])
+			if r == utf8.RuneError && size == 1 {
+				return "", p.errorf("invalid utf-8 in string")
+			}
+			b.WriteRune(r)
+			p.pos += size
+		}
+	}
+	return "", p.errorf("unexpected end of string")
+}
+
+func (p *jsonParser) parseUnicodeEscape() (rune, error) {
+	r, err := p.parseHex4()
+	if err != nil {
+		return 0, err
+	}
+	if !utf16.IsSurrogate(r) {
+		return r, nil
+	}
+	// The surrogate pair must follow as another escape.
+	if !strings.HasPrefix(string(p.data[p.pos:]), `\u`) {
+		return utf8.RuneError, nil
+	}
+	p.pos += 2
+	r2, err := p.parseHex4()
+	if err != nil {
+		return 0, err
+	}
+	return utf16.DecodeRune(r, r2), nil
+}
+
+func (p *jsonParser) parseHex4() (rune, error) {
+	if p.pos+4 > len(p.data) {
+		return 0, p.errorf("unexpected end of unicode escape")
+	}
+	v, err := strconv.ParseUint(string(p.data[p.pos:p.pos+4]), 16, 32)
+	if err != nil {
+		return 0, p.errorf("invalid unicode escape")
+	}
+	p.pos += 4
+	return rune(v), nil
+}
+
+func (p *jsonParser) parseNumber() (interface{}, error) {
+	start := p.pos
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if ('0' <= c && c <= '9') || c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E' {
+			p.pos++
+			continue
+		}
+		break
+	}
+	literal := string(p.data[start:p.pos])
+	if _, err := strconv.ParseFloat(literal, 64); err != nil {
+		p.pos = start
+		return nil, p.errorf("invalid number %q", literal)
+	}
+	return jsonNumber(literal), nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJSON(t *testing.T) {
+	v, err := parseJSON([]byte(` {"s": "a\"b\\né😀", "n": -1.5e3, "i": 9007199254740993,
+		"b": [true, false, null], "o": {}, "a": []} `))
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"s": "a\"b\\né\U0001F600",
+		"n": jsonNumber("-1.5e3"),
+		"i": jsonNumber("9007199254740993"),
+		"b": []interface{}{true, false, nil},
+		"o": map[string]interface{}{},
+		"a": []interface{}{},
+	}, v)
+
+	for _, invalid := range []string{
+		``, `{`, `{"a"}`, `{"a":1,}`, `[1 2]`, `"abc`, `tru`, `{} {}`, `{"a": -}`, `"\x"`, "\"\x01\"",
+	} {
+		_, err := parseJSON([]byte(invalid))
+		require.Error(t, err, invalid)
+	}
+
+	t.Run("max depth", func(t *testing.T) {
+		_, err := parseJSON([]byte(strings.Repeat("[", maxJSONDepth) + strings.Repeat("]", maxJSONDepth)))
+		require.NoError(t, err)
+		_, err = parseJSON([]byte(strings.Repeat(`{"a":`, maxJSONDepth) + "[]" + strings.Repeat("}", maxJSONDepth)))
+		require.EqualError(t, err, "invalid json at offset 320: exceeded the max nesting depth 64")
+	})
+}
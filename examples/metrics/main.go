@@ -15,8 +15,6 @@
 package main
 
 import (
-	"fmt"
-
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
 )
@@ -61,24 +59,17 @@ const (
 	customHeaderValueTagKey = "value"
 )
 
-// counters is a map from custom header value to a counter metric.
-// Note that Proxy-Wasm plugins are single threaded, so no need to use a lock.
-var counters = map[string]proxywasm.MetricCounter{}
+// counters is the counters partitioned by the custom header value and the reporter, which are defined on the first use.
+// This metric is processed as: custom_header_value_counts{value="foo",reporter="wasmgosdk"} n.
+// The extraction rule is defined in envoy.yaml as a bootstrap configuration.
+// See https://www.envoyproxy.io/docs/envoy/latest/api-v3/config/metrics/v3/stats.proto#config-metrics-v3-statsconfig.
+var counters = proxywasm.NewCounterVec("custom_header_value_counts", customHeaderValueTagKey, "reporter")
 
 // OnHttpRequestHeaders implements types.HttpContext.
 func (ctx *metricHttpContext) OnHttpRequestHeaders(numHeaders int, endOfStream bool) types.Action {
 	customHeaderValue, err := proxywasm.GetHttpRequestHeader(customHeaderKey)
 	if err == nil {
-		counter, ok := counters[customHeaderValue]
-		if !ok {
-			// This metric is processed as: custom_header_value_counts{value="foo",reporter="wasmgosdk"} n.
-			// The extraction rule is defined in envoy.yaml as a bootstrap configuration.
-			// See https://www.envoyproxy.io/docs/envoy/latest/api-v3/config/metrics/v3/stats.proto#config-metrics-v3-statsconfig.
-			fqn := fmt.Sprintf("custom_header_value_counts_%s=%s_reporter=wasmgosdk", customHeaderValueTagKey, customHeaderValue)
-			counter = proxywasm.DefineCounterMetric(fqn)
-			counters[customHeaderValue] = counter
-		}
-		counter.Increment(1)
+		counters.With(customHeaderValue, "wasmgosdk").Increment(1)
 	}
 	return types.ActionContinue
 }
@@ -34,7 +34,7 @@ func TestMetric(t *testing.T) {
 		}
 
 		// Check metrics.
-		value, err := host.GetCounterMetric("custom_header_value_counts_value=foo_reporter=wasmgosdk")
+		value, err := host.GetCounterMetric("custom_header_value_counts.value.foo.reporter.wasmgosdk")
 		require.NoError(t, err)
 		require.Equal(t, uint64(3), value)
 	})
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -14,98 +15,130 @@ import (
 )
 
 func TestNetwork_OnNewConnection(t *testing.T) {
-	opt := proxytest.NewEmulatorOption().WithVMContext(&vmContext{})
-	host, reset := proxytest.NewHostEmulator(opt)
-	defer reset()
-
-	// Initialize plugin
-	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
-
-	// OnNewConnection is called.
-	_, action := host.InitializeConnection()
-	require.Equal(t, types.ActionContinue, action)
-
-	// Check Envoy logs.
-	logs := host.GetInfoLogs()
-	require.Contains(t, logs, "new connection!")
+	vmTest(t, func(t *testing.T, vm types.VMContext) {
+		opt := proxytest.NewEmulatorOption().WithVMContext(vm)
+		host, reset := proxytest.NewHostEmulator(opt)
+		defer reset()
+
+		// Initialize plugin
+		require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+		// OnNewConnection is called.
+		_, action := host.InitializeConnection()
+		require.Equal(t, types.ActionContinue, action)
+
+		// Check Envoy logs.
+		logs := host.GetInfoLogs()
+		require.Contains(t, logs, "new connection!")
+	})
 }
 
 func TestNetwork_OnDownstreamClose(t *testing.T) {
-	opt := proxytest.NewEmulatorOption().WithVMContext(&vmContext{})
-	host, reset := proxytest.NewHostEmulator(opt)
-	defer reset()
-
-	// OnNewConnection is called.
-	contextID, action := host.InitializeConnection()
-	require.Equal(t, types.ActionContinue, action)
-
-	// OnDownstreamClose is called.
-	host.CloseDownstreamConnection(contextID)
-
-	// Check Envoy logs.
-	logs := host.GetInfoLogs()
-	require.Contains(t, logs, "downstream connection close!")
+	vmTest(t, func(t *testing.T, vm types.VMContext) {
+		opt := proxytest.NewEmulatorOption().WithVMContext(vm)
+		host, reset := proxytest.NewHostEmulator(opt)
+		defer reset()
+
+		// OnNewConnection is called.
+		contextID, action := host.InitializeConnection()
+		require.Equal(t, types.ActionContinue, action)
+
+		// OnDownstreamClose is called.
+		host.CloseDownstreamConnection(contextID)
+
+		// Check Envoy logs.
+		logs := host.GetInfoLogs()
+		require.Contains(t, logs, "downstream connection close!")
+	})
 }
 
 func TestNetwork_OnDownstreamData(t *testing.T) {
-	opt := proxytest.NewEmulatorOption().WithVMContext(&vmContext{})
-	host, reset := proxytest.NewHostEmulator(opt)
-	defer reset()
-
-	// OnNewConnection is called.
-	contextID, action := host.InitializeConnection()
-	require.Equal(t, types.ActionContinue, action)
-
-	// OnDownstreamData is called.
-	msg := "this is downstream data"
-	data := []byte(msg)
-	host.CallOnDownstreamData(contextID, data)
-
-	// Check Envoy logs.
-	logs := host.GetInfoLogs()
-	require.Contains(t, logs, ">>>>>> downstream data received >>>>>>\n"+msg)
+	vmTest(t, func(t *testing.T, vm types.VMContext) {
+		opt := proxytest.NewEmulatorOption().WithVMContext(vm)
+		host, reset := proxytest.NewHostEmulator(opt)
+		defer reset()
+
+		// OnNewConnection is called.
+		contextID, action := host.InitializeConnection()
+		require.Equal(t, types.ActionContinue, action)
+
+		// OnDownstreamData is called.
+		msg := "this is downstream data"
+		data := []byte(msg)
+		host.CallOnDownstreamData(contextID, data)
+
+		// Check Envoy logs.
+		logs := host.GetInfoLogs()
+		require.Contains(t, logs, ">>>>>> downstream data received >>>>>>\n"+msg)
+	})
 }
 
 func TestNetwork_OnUpstreamData(t *testing.T) {
-	opt := proxytest.NewEmulatorOption().WithVMContext(&vmContext{})
-	host, reset := proxytest.NewHostEmulator(opt)
-	defer reset()
-
-	// OnNewConnection is called.
-	contextID, action := host.InitializeConnection()
-	require.Equal(t, types.ActionContinue, action)
-
-	// OnUpstreamData is called.
-	msg := "this is upstream data"
-	data := []byte(msg)
-	host.CallOnUpstreamData(contextID, data)
-
-	// Check Envoy logs.
-	logs := host.GetInfoLogs()
-	require.Contains(t, logs, "<<<<<< upstream data received <<<<<<\n"+msg)
+	vmTest(t, func(t *testing.T, vm types.VMContext) {
+		opt := proxytest.NewEmulatorOption().WithVMContext(vm)
+		host, reset := proxytest.NewHostEmulator(opt)
+		defer reset()
+
+		// OnNewConnection is called.
+		contextID, action := host.InitializeConnection()
+		require.Equal(t, types.ActionContinue, action)
+
+		// OnUpstreamData is called.
+		msg := "this is upstream data"
+		data := []byte(msg)
+		host.CallOnUpstreamData(contextID, data)
+
+		// Check Envoy logs.
+		logs := host.GetInfoLogs()
+		require.Contains(t, logs, "<<<<<< upstream data received <<<<<<\n"+msg)
+	})
 }
 
 func TestNetwork_counter(t *testing.T) {
-	opt := proxytest.NewEmulatorOption().WithVMContext(&vmContext{})
-	host, reset := proxytest.NewHostEmulator(opt)
-	defer reset()
-
-	// Call OnVMStart -> initialize metric
-	require.Equal(t, types.OnVMStartStatusOK, host.StartVM())
-
-	// OnNewConnection is called.
-	contextID, action := host.InitializeConnection()
-	require.Equal(t, types.ActionContinue, action)
-
-	// call OnStreamDone on contextID -> increment the connection counter.
-	host.CompleteConnection(contextID)
-
-	// Check Envoy logs.
-	logs := host.GetInfoLogs()
-	require.Contains(t, logs, "connection complete!")
+	vmTest(t, func(t *testing.T, vm types.VMContext) {
+		opt := proxytest.NewEmulatorOption().WithVMContext(vm)
+		host, reset := proxytest.NewHostEmulator(opt)
+		defer reset()
+
+		// Call OnVMStart -> initialize metric
+		require.Equal(t, types.OnVMStartStatusOK, host.StartVM())
+
+		// OnNewConnection is called.
+		contextID, action := host.InitializeConnection()
+		require.Equal(t, types.ActionContinue, action)
+
+		// call OnStreamDone on contextID -> increment the connection counter.
+		host.CompleteConnection(contextID)
+
+		// Check Envoy logs.
+		logs := host.GetInfoLogs()
+		require.Contains(t, logs, "connection complete!")
+
+		// Check counter metric.
+		value, err := host.GetCounterMetric("proxy_wasm_go.connection_counter")
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), value)
+	})
+}
 
-	// Check counter metric.
-	value, err := host.GetCounterMetric("proxy_wasm_go.connection_counter")
-	require.NoError(t, err)
-	require.Equal(t, uint64(1), value)
+// vmTest executes f twice, once with a types.VMContext that executes plugin code directly
+// in the host, and again by executing the plugin code within the compiled main.wasm binary.
+// Execution with main.wasm will be skipped if the file cannot be found.
+func vmTest(t *testing.T, f func(*testing.T, types.VMContext)) {
+	t.Helper()
+
+	t.Run("go", func(t *testing.T) {
+		f(t, &vmContext{})
+	})
+
+	t.Run("wasm", func(t *testing.T) {
+		wasm, err := os.ReadFile("main.wasm")
+		if err != nil {
+			t.Skip("wasm not found")
+		}
+		v, err := proxytest.NewWasmVMContext(wasm)
+		require.NoError(t, err)
+		defer v.Close()
+		f(t, v)
+	})
 }
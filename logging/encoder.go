@@ -0,0 +1,176 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"unicode/utf8"
+)
+
+// MessageKey is the key of the log message in the encoded logs.
+const MessageKey = "msg"
+
+// Encoder encodes a log message and its fields into a line.
+type Encoder interface {
+	// Encode appends the encoded line to dst and returns the extended buffer.
+	Encode(dst []byte, msg string, fields []Field) []byte
+}
+
+// Logfmt encodes the logs as logfmt, e.g. `msg="request denied" status=403`.
+// Keys and values are quoted with the Go syntax when they contain spaces, quotes, '=' or non-printable characters.
+var Logfmt Encoder = logfmtEncoder{}
+
+// JSON encodes the logs as JSON objects, e.g. `{"msg":"request denied","status":403}`.
+// Non-finite floating point numbers are encoded as strings since JSON cannot represent them.
+var JSON Encoder = jsonEncoder{}
+
+type logfmtEncoder struct{}
+
+// Encode implements Encoder.
+func (logfmtEncoder) Encode(dst []byte, msg string, fields []Field) []byte {
+	dst = append(dst, MessageKey...)
+	dst = append(dst, '=')
+	dst = appendLogfmtValue(dst, msg)
+	for _, f := range fields {
+		dst = append(dst, ' ')
+		dst = appendLogfmtValue(dst, f.Key)
+		dst = append(dst, '=')
+		switch f.kind {
+		case kindString:
+			dst = appendLogfmtValue(dst, f.str)
+		case kindStringer:
+			dst = appendLogfmtValue(dst, stringerValue(f.s))
+		default:
+			dst = appendScalar(dst, f)
+		}
+	}
+	return dst
+}
+
+func appendLogfmtValue(dst []byte, s string) []byte {
+	if s == "" {
+		return append(dst, `""`...)
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError || !strconv.IsPrint(r) {
+			return strconv.AppendQuote(dst, s)
+		}
+	}
+	return append(dst, s...)
+}
+
+// stringerValue returns the result of String, or "<nil>" as fmt does if s is nil,
+// including a nil pointer whose String method panics.
+func stringerValue(s fmt.Stringer) (str string) {
+	if s == nil {
+		return "<nil>"
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if v := reflect.ValueOf(s); v.Kind() != reflect.Ptr || !v.IsNil() {
+				panic(r)
+			}
+			str = "<nil>"
+		}
+	}()
+	return s.String()
+}
+
+type jsonEncoder struct{}
+
+// Encode implements Encoder.
+func (jsonEncoder) Encode(dst []byte, msg string, fields []Field) []byte {
+	dst = append(dst, '{')
+	dst = appendJSONString(dst, MessageKey)
+	dst = append(dst, ':')
+	dst = appendJSONString(dst, msg)
+	for _, f := range fields {
+		dst = append(dst, ',')
+		dst = appendJSONString(dst, f.Key)
+		dst = append(dst, ':')
+		switch f.kind {
+		case kindString:
+			dst = appendJSONString(dst, f.str)
+		case kindStringer:
+			dst = appendJSONString(dst, stringerValue(f.s))
+		case kindFloat:
+			if math.IsNaN(f.f) || math.IsInf(f.f, 0) {
+				dst = appendJSONString(dst, strconv.FormatFloat(f.f, 'g', -1, 64))
+			} else {
+				dst = appendScalar(dst, f)
+			}
+		default:
+			dst = appendScalar(dst, f)
+		}
+	}
+	return append(dst, '}')
+}
+
+const hexDigits = "0123456789abcdef"
+
+func appendJSONString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				dst = append(dst, `\ufffd`...)
+			} else {
+				dst = append(dst, s[i:i+size]...)
+			}
+			i += size
+			continue
+		}
+		switch c {
+		case '"', '\\':
+			dst = append(dst, '\\', c)
+		case '\n':
+			dst = append(dst, '\\', 'n')
+		case '\r':
+			dst = append(dst, '\\', 'r')
+		case '\t':
+			dst = append(dst, '\\', 't')
+		default:
+			if c < 0x20 {
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			} else {
+				dst = append(dst, c)
+			}
+		}
+		i++
+	}
+	return append(dst, '"')
+}
+
+// appendScalar appends the integer, floating point number or boolean value which are encoded in the same way
+// in both logfmt and JSON.
+func appendScalar(dst []byte, f Field) []byte {
+	switch f.kind {
+	case kindInt:
+		return strconv.AppendInt(dst, int64(f.num), 10)
+	case kindUint:
+		return strconv.AppendUint(dst, f.num, 10)
+	case kindFloat:
+		return strconv.AppendFloat(dst, f.f, 'g', -1, 64)
+	case kindBool:
+		return strconv.AppendBool(dst, f.num == 1)
+	default:
+		panic("invalid field kind")
+	}
+}
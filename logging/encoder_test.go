@@ -0,0 +1,91 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package logging
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type stringer string
+
+func (s stringer) String() string { return string(s) }
+
+type pointerStringer struct{ s string }
+
+func (p *pointerStringer) String() string { return p.s }
+
+type panicStringer struct{}
+
+func (panicStringer) String() string { panic("boom") }
+
+func TestEncoders(t *testing.T) {
+	fields := []Field{
+		String("path", "/a b"),
+		Int("delta", -3),
+		Uint("status", 403),
+		Float("ratio", 0.5),
+		Bool("cached", true),
+		Duration("latency", 1500*time.Millisecond),
+		Err(errors.New(`quota "x" exceeded`)),
+		Stringer("peer", stringer("10.0.0.1")),
+		String("empty", ""),
+	}
+
+	for _, tc := range []struct {
+		name    string
+		encoder Encoder
+		exp     string
+	}{
+		{
+			name:    "logfmt",
+			encoder: Logfmt,
+			exp: `msg="request denied" path="/a b" delta=-3 status=403 ratio=0.5 cached=true latency=1.5s ` +
+				`error="quota \"x\" exceeded" peer=10.0.0.1 empty=""`,
+		},
+		{
+			name:    "json",
+			encoder: JSON,
+			exp: `{"msg":"request denied","path":"/a b","delta":-3,"status":403,"ratio":0.5,"cached":true,` +
+				`"latency":"1.5s","error":"quota \"x\" exceeded","peer":"10.0.0.1","empty":""}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.exp, string(tc.encoder.Encode(nil, "request denied", fields)))
+		})
+	}
+}
+
+func TestLogfmt_key(t *testing.T) {
+	actual := Logfmt.Encode(nil, "m", []Field{String("a b", "1"), String("k=v", "2"), String(`"q"`, "3"), String("", "4")})
+	require.Equal(t, `msg=m "a b"=1 "k=v"=2 "\"q\""=3 ""=4`, string(actual))
+}
+
+func TestEncoders_nilStringer(t *testing.T) {
+	var p *pointerStringer
+	fields := []Field{Stringer("nil", nil), Stringer("pointer", p)}
+	require.Equal(t, `msg=m nil=<nil> pointer=<nil>`, string(Logfmt.Encode(nil, "m", fields)))
+	require.Equal(t, `{"msg":"m","nil":"<nil>","pointer":"<nil>"}`, string(JSON.Encode(nil, "m", fields)))
+	// The panics other than the nil pointer are not swallowed.
+	require.Panics(t, func() { Logfmt.Encode(nil, "m", []Field{Stringer("panic", panicStringer{})}) })
+}
+
+func TestJSON_escape(t *testing.T) {
+	actual := JSON.Encode(nil, "a\nb\t\x01\xff", []Field{Float("nan", math.NaN()), Float("inf", math.Inf(1))})
+	require.Equal(t, `{"msg":"a\nb\t\u0001\ufffd","nan":"NaN","inf":"+Inf"}`, string(actual))
+}
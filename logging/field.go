@@ -0,0 +1,89 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"fmt"
+	"time"
+)
+
+type fieldKind uint8
+
+const (
+	kindString fieldKind = iota
+	kindInt
+	kindUint
+	kindFloat
+	kindBool
+	kindStringer
+)
+
+// Field is a typed key/value pair of a structured log. Fields are encoded without reflection,
+// since TinyGo supports it only partially.
+type Field struct {
+	Key  string
+	kind fieldKind
+	str  string
+	num  uint64
+	f    float64
+	s    fmt.Stringer
+}
+
+// String returns a Field of the string value.
+func String(key, value string) Field {
+	return Field{Key: key, kind: kindString, str: value}
+}
+
+// Int returns a Field of the signed integer value.
+func Int(key string, value int64) Field {
+	return Field{Key: key, kind: kindInt, num: uint64(value)}
+}
+
+// Uint returns a Field of the unsigned integer value.
+func Uint(key string, value uint64) Field {
+	return Field{Key: key, kind: kindUint, num: value}
+}
+
+// Float returns a Field of the floating point number value.
+func Float(key string, value float64) Field {
+	return Field{Key: key, kind: kindFloat, f: value}
+}
+
+// Bool returns a Field of the boolean value.
+func Bool(key string, value bool) Field {
+	f := Field{Key: key, kind: kindBool}
+	if value {
+		f.num = 1
+	}
+	return f
+}
+
+// Duration returns a Field of the duration encoded as a string such as "1.5s".
+func Duration(key string, value time.Duration) Field {
+	return String(key, value.String())
+}
+
+// Err returns a Field of the error message with the key "error".
+func Err(err error) Field {
+	if err == nil {
+		return String("error", "<nil>")
+	}
+	return String("error", err.Error())
+}
+
+// Stringer returns a Field of the value encoded with its String method, which is called only if the log is emitted.
+func Stringer(key string, value fmt.Stringer) Field {
+	return Field{Key: key, kind: kindStringer, s: value}
+}
@@ -0,0 +1,156 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging provides a structured logger emitting the logs with typed fields through the host, e.g.
+//
+//	logger := logging.New().WithEncoder(logging.JSON).WithContextID(contextID).WithRequestID()
+//	logger.Info("request denied", logging.Int("status", 403), logging.String("reason", "quota"))
+//
+// emits `{"msg":"request denied","context_id":2,"request_id":"...","status":403,"reason":"quota"}`
+// with the info level of the host.
+package logging
+
+import (
+	"github.com/tetratelabs/proxy-wasm-go-sdk/properties"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+// Logger emits structured logs. The With* methods return a new Logger without modifying the receiver,
+// so a Logger can be derived for each context from the one shared by the plugin context.
+type Logger struct {
+	encoder Encoder
+	level   types.LogLevel
+	fields  []Field
+}
+
+// New returns a new Logger with the Logfmt encoder, which emits all the logs allowed by the host.
+func New() *Logger {
+	return &Logger{encoder: Logfmt, level: types.LogLevelTrace}
+}
+
+// WithEncoder returns a new Logger with the given encoder.
+func (l *Logger) WithEncoder(encoder Encoder) *Logger {
+	n := l.clone()
+	n.encoder = encoder
+	return n
+}
+
+// WithLevel returns a new Logger which discards the logs below the given level,
+// in addition to the ones below the level of the host.
+func (l *Logger) WithLevel(level types.LogLevel) *Logger {
+	n := l.clone()
+	n.level = level
+	return n
+}
+
+// With returns a new Logger which adds the given fields to every log.
+func (l *Logger) With(fields ...Field) *Logger {
+	n := l.clone()
+	n.fields = append(n.fields, fields...)
+	return n
+}
+
+// WithContextID returns a new Logger which adds the context ID as "context_id" to every log.
+func (l *Logger) WithContextID(contextID uint32) *Logger {
+	return l.With(Uint("context_id", uint64(contextID)))
+}
+
+// WithRequestID returns a new Logger which adds the value of x-request-id as "request_id" to every log.
+// The receiver is returned as is if the request ID is not available, e.g. outside of the HTTP contexts.
+func (l *Logger) WithRequestID() *Logger {
+	id, err := properties.GetRequestId()
+	if err != nil || id == "" {
+		return l
+	}
+	return l.With(String("request_id", id))
+}
+
+// WithPluginName returns a new Logger which adds the plugin name as "plugin_name" to every log.
+// The receiver is returned as is if the plugin name is not available.
+func (l *Logger) WithPluginName() *Logger {
+	name, err := properties.GetPluginName()
+	if err != nil || name == "" {
+		return l
+	}
+	return l.With(String("plugin_name", name))
+}
+
+// Enabled returns whether the logs of the given level are emitted.
+func (l *Logger) Enabled(level types.LogLevel) bool {
+	if level < l.level {
+		return false
+	}
+	host, err := proxywasm.GetLogLevel()
+	return err != nil || level >= host
+}
+
+// Trace emits the log with the trace level.
+func (l *Logger) Trace(msg string, fields ...Field) {
+	l.log(types.LogLevelTrace, msg, fields)
+}
+
+// Debug emits the log with the debug level.
+func (l *Logger) Debug(msg string, fields ...Field) {
+	l.log(types.LogLevelDebug, msg, fields)
+}
+
+// Info emits the log with the info level.
+func (l *Logger) Info(msg string, fields ...Field) {
+	l.log(types.LogLevelInfo, msg, fields)
+}
+
+// Warn emits the log with the warn level.
+func (l *Logger) Warn(msg string, fields ...Field) {
+	l.log(types.LogLevelWarn, msg, fields)
+}
+
+// Error emits the log with the error level.
+func (l *Logger) Error(msg string, fields ...Field) {
+	l.log(types.LogLevelError, msg, fields)
+}
+
+// Critical emits the log with the critical level.
+func (l *Logger) Critical(msg string, fields ...Field) {
+	l.log(types.LogLevelCritical, msg, fields)
+}
+
+func (l *Logger) log(level types.LogLevel, msg string, fields []Field) {
+	if !l.Enabled(level) {
+		return
+	}
+	buf := l.encoder.Encode(nil, msg, append(l.fields[:len(l.fields):len(l.fields)], fields...))
+	line := string(buf)
+	switch level {
+	case types.LogLevelTrace:
+		proxywasm.LogTrace(line)
+	case types.LogLevelDebug:
+		proxywasm.LogDebug(line)
+	case types.LogLevelInfo:
+		proxywasm.LogInfo(line)
+	case types.LogLevelWarn:
+		proxywasm.LogWarn(line)
+	case types.LogLevelError:
+		proxywasm.LogError(line)
+	default:
+		proxywasm.LogCritical(line)
+	}
+}
+
+func (l *Logger) clone() *Logger {
+	n := *l
+	// Cap the fields so that appending to the new one doesn't overwrite the others derived from the receiver.
+	n.fields = l.fields[:len(l.fields):len(l.fields)]
+	return &n
+}
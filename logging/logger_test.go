@@ -0,0 +1,68 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package logging_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/logging"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+func TestLogger(t *testing.T) {
+	for name, encoder := range map[string]logging.Encoder{"logfmt": logging.Logfmt, "json": logging.JSON} {
+		t.Run(name, func(t *testing.T) {
+			opt := proxytest.NewEmulatorOption().
+				WithProperty([]string{"request", "id"}, []byte("req-1")).
+				WithProperty([]string{"plugin_name"}, []byte("ratelimit"))
+			host, reset := proxytest.NewHostEmulator(opt)
+			defer reset()
+
+			base := logging.New().WithEncoder(encoder).WithPluginName()
+			logger := base.WithContextID(2).WithRequestID()
+			logger.Info("request denied", logging.Int("status", 429), logging.Bool("dry_run", false))
+			base.Warn("no request")
+
+			require.Equal(t, []map[string]string{{
+				"msg": "request denied", "plugin_name": "ratelimit", "context_id": "2", "request_id": "req-1",
+				"status": "429", "dry_run": "false",
+			}}, host.GetLogFields(types.LogLevelInfo))
+			// The fields bound by the derived logger are not added to the base one.
+			require.Equal(t, []map[string]string{{"msg": "no request", "plugin_name": "ratelimit"}},
+				host.GetLogFields(types.LogLevelWarn))
+		})
+	}
+}
+
+func TestLogger_level(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithLogLevel(types.LogLevelDebug))
+	defer reset()
+
+	logger := logging.New().WithLevel(types.LogLevelInfo)
+	require.False(t, logger.Enabled(types.LogLevelDebug))
+	logger.Debug("discarded by the logger")
+	logger.Info("emitted")
+	require.Empty(t, host.GetDebugLogs())
+	require.Equal(t, []string{"msg=emitted"}, host.GetInfoLogs())
+
+	// The level of the host also applies.
+	logger = logging.New()
+	logger.Trace("discarded by the host")
+	logger.Debug("emitted")
+	require.Empty(t, host.GetTraceLogs())
+	require.Equal(t, []string{"msg=emitted"}, host.GetDebugLogs())
+}
@@ -0,0 +1,207 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxywasm
+
+import (
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+// FullRequestBodyHandler is implemented by a types.HttpContext wrapped by NewBodyBufferingHttpContext
+// to receive the whole request body at once.
+type FullRequestBodyHandler interface {
+	// OnFullRequestBody is called once with the whole request body, which is nil if the request has no body.
+	// The returned action is handled in the same way as the one of types.HttpContext.OnHttpRequestBody.
+	// The body can be modified with ReplaceHttpRequestBody only if the request has no trailers,
+	// since this is called during types.HttpContext.OnHttpRequestTrailers otherwise.
+	OnFullRequestBody(body []byte) types.Action
+}
+
+// FullResponseBodyHandler is implemented by a types.HttpContext wrapped by NewBodyBufferingHttpContext
+// to receive the whole response body at once.
+type FullResponseBodyHandler interface {
+	// OnFullResponseBody is the same as FullRequestBodyHandler.OnFullRequestBody, but for the response body.
+	OnFullResponseBody(body []byte) types.Action
+}
+
+// NewBodyBufferingHttpContext wraps the given types.HttpContext so that the body is buffered until the end of stream,
+// and then passed to FullRequestBodyHandler.OnFullRequestBody or FullResponseBodyHandler.OnFullResponseBody
+// if ctx implements them. OnHttpRequestBody and OnHttpResponseBody of ctx are not called for the buffered direction.
+//
+// The handler is also called for streams without body: right after the headers callback for headers-only streams,
+// and right before the trailers callback for streams with trailers. In these cases, the first non-continue action
+// returned by the callbacks takes effect.
+//
+// If maxBodyBytes is positive and the body exceeds it, the handler is not called, and the request is rejected by
+// SendHttpResponse with 413, or the stream is reset by ResetHttpStream for the response, since the response headers
+// have possibly been sent to the downstream.
+func NewBodyBufferingHttpContext(ctx types.HttpContext, maxBodyBytes int) types.HttpContext {
+	c := &bodyBufferingHttpContext{HttpContext: ctx}
+	c.request = bodyBuffer{
+		maxBytes: maxBodyBytes,
+		getBody:  GetHttpRequestBody,
+		reject: func() error {
+			return SendHttpResponse(413, nil, []byte("Payload Too Large"), -1)
+		},
+	}
+	if h, ok := ctx.(FullRequestBodyHandler); ok {
+		c.request.onFullBody = h.OnFullRequestBody
+	}
+	c.response = bodyBuffer{
+		maxBytes: maxBodyBytes,
+		getBody:  GetHttpResponseBody,
+		reject:   ResetHttpStream,
+	}
+	if h, ok := ctx.(FullResponseBodyHandler); ok {
+		c.response.onFullBody = h.OnFullResponseBody
+	}
+	return c
+}
+
+type bodyBufferingHttpContext struct {
+	types.HttpContext
+	request, response bodyBuffer
+}
+
+type bodyBufferState int
+
+const (
+	bodyBufferStateBuffering bodyBufferState = iota
+	bodyBufferStateDelivered
+	bodyBufferStateRejected
+)
+
+// bodyBuffer accumulates the body of one direction of the stream.
+type bodyBuffer struct {
+	maxBytes   int
+	getBody    func(start, maxSize int) ([]byte, error)
+	onFullBody func(body []byte) types.Action // nil if not implemented
+	reject     func() error
+
+	state bodyBufferState
+	body  []byte
+}
+
+// OnHttpRequestHeaders implements types.HttpContext.
+func (c *bodyBufferingHttpContext) OnHttpRequestHeaders(numHeaders int, endOfStream bool) types.Action {
+	action := c.HttpContext.OnHttpRequestHeaders(numHeaders, endOfStream)
+	if !endOfStream || !c.request.buffering() {
+		return action
+	}
+	return firstNonContinue(action, c.request.deliver())
+}
+
+// OnHttpRequestBody implements types.HttpContext.
+func (c *bodyBufferingHttpContext) OnHttpRequestBody(bodySize int, endOfStream bool) types.Action {
+	if c.request.onFullBody == nil {
+		return c.HttpContext.OnHttpRequestBody(bodySize, endOfStream)
+	}
+	return c.request.onBody(bodySize, endOfStream)
+}
+
+// OnHttpRequestTrailers implements types.HttpContext.
+func (c *bodyBufferingHttpContext) OnHttpRequestTrailers(numTrailers int) types.Action {
+	if c.request.state == bodyBufferStateRejected {
+		return types.ActionPause
+	} else if !c.request.buffering() {
+		return c.HttpContext.OnHttpRequestTrailers(numTrailers)
+	}
+	action := c.request.deliver()
+	return firstNonContinue(action, c.HttpContext.OnHttpRequestTrailers(numTrailers))
+}
+
+// OnHttpResponseHeaders implements types.HttpContext.
+func (c *bodyBufferingHttpContext) OnHttpResponseHeaders(numHeaders int, endOfStream bool) types.Action {
+	action := c.HttpContext.OnHttpResponseHeaders(numHeaders, endOfStream)
+	if !endOfStream || !c.response.buffering() {
+		return action
+	}
+	return firstNonContinue(action, c.response.deliver())
+}
+
+// OnHttpResponseBody implements types.HttpContext.
+func (c *bodyBufferingHttpContext) OnHttpResponseBody(bodySize int, endOfStream bool) types.Action {
+	if c.response.onFullBody == nil {
+		return c.HttpContext.OnHttpResponseBody(bodySize, endOfStream)
+	}
+	return c.response.onBody(bodySize, endOfStream)
+}
+
+// OnHttpResponseTrailers implements types.HttpContext.
+func (c *bodyBufferingHttpContext) OnHttpResponseTrailers(numTrailers int) types.Action {
+	if c.response.state == bodyBufferStateRejected {
+		return types.ActionPause
+	} else if !c.response.buffering() {
+		return c.HttpContext.OnHttpResponseTrailers(numTrailers)
+	}
+	action := c.response.deliver()
+	return firstNonContinue(action, c.HttpContext.OnHttpResponseTrailers(numTrailers))
+}
+
+func (b *bodyBuffer) buffering() bool {
+	return b.onFullBody != nil && b.state == bodyBufferStateBuffering
+}
+
+func (b *bodyBuffer) onBody(bodySize int, endOfStream bool) types.Action {
+	switch b.state {
+	case bodyBufferStateDelivered:
+		return types.ActionContinue
+	case bodyBufferStateRejected:
+		return types.ActionPause
+	}
+
+	if b.maxBytes > 0 && bodySize > b.maxBytes {
+		b.fail()
+		return types.ActionPause
+	}
+
+	// The host keeps buffering the body while this returns types.ActionPause, so only read the unseen part.
+	// This copy is needed since the body is not available during the trailers callback.
+	if bodySize > len(b.body) {
+		chunk, err := b.getBody(len(b.body), bodySize-len(b.body))
+		if err != nil {
+			LogErrorf("failed to get body: %v", err)
+			b.fail()
+			return types.ActionPause
+		}
+		b.body = append(b.body, chunk...)
+	}
+
+	if !endOfStream {
+		return types.ActionPause
+	}
+	return b.deliver()
+}
+
+func (b *bodyBuffer) deliver() types.Action {
+	b.state = bodyBufferStateDelivered
+	body := b.body
+	b.body = nil
+	return b.onFullBody(body)
+}
+
+func (b *bodyBuffer) fail() {
+	b.state = bodyBufferStateRejected
+	b.body = nil
+	if err := b.reject(); err != nil {
+		LogErrorf("failed to reject the stream: %v", err)
+	}
+}
+
+func firstNonContinue(a, b types.Action) types.Action {
+	if a != types.ActionContinue {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,153 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxywasm_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+type fullBodyVMContext struct {
+	types.DefaultVMContext
+	// response enables buffering the response body instead of the request body.
+	response bool
+}
+
+type fullBodyPluginContext struct {
+	types.DefaultPluginContext
+	response bool
+}
+
+type fullBodyHttpContext struct {
+	types.DefaultHttpContext
+}
+
+// NewPluginContext implements the same method on types.VMContext.
+func (vm *fullBodyVMContext) NewPluginContext(uint32) types.PluginContext {
+	return &fullBodyPluginContext{response: vm.response}
+}
+
+// NewHttpContext implements the same method on types.PluginContext.
+func (p *fullBodyPluginContext) NewHttpContext(uint32) types.HttpContext {
+	if p.response {
+		return proxywasm.NewBodyBufferingHttpContext(&fullResponseBodyHttpContext{}, 10)
+	}
+	return proxywasm.NewBodyBufferingHttpContext(&fullBodyHttpContext{}, 10)
+}
+
+// OnFullRequestBody implements proxywasm.FullRequestBodyHandler.
+func (*fullBodyHttpContext) OnFullRequestBody(body []byte) types.Action {
+	proxywasm.LogInfof("request body:%q", body)
+	return types.ActionContinue
+}
+
+// OnHttpRequestTrailers implements the same method on types.HttpContext.
+func (*fullBodyHttpContext) OnHttpRequestTrailers(int) types.Action {
+	proxywasm.LogInfo("request trailers")
+	return types.ActionContinue
+}
+
+// OnHttpResponseBody implements the same method on types.HttpContext.
+func (*fullBodyHttpContext) OnHttpResponseBody(bodySize int, _ bool) types.Action {
+	proxywasm.LogInfof("response body frame:%d", bodySize)
+	return types.ActionContinue
+}
+
+type fullResponseBodyHttpContext struct {
+	types.DefaultHttpContext
+}
+
+// OnFullResponseBody implements proxywasm.FullResponseBodyHandler.
+func (*fullResponseBodyHttpContext) OnFullResponseBody(body []byte) types.Action {
+	proxywasm.LogInfof("response body:%q", body)
+	return types.ActionContinue
+}
+
+func TestBodyBufferingHttpContext(t *testing.T) {
+	newHost := func(t *testing.T) (proxytest.HostEmulator, uint32) {
+		host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(&fullBodyVMContext{}))
+		t.Cleanup(reset)
+		return host, host.InitializeHttpContext()
+	}
+
+	t.Run("body", func(t *testing.T) {
+		host, id := newHost(t)
+		require.Equal(t, types.ActionContinue, host.CallOnRequestHeaders(id, nil, false))
+		require.Equal(t, types.ActionPause, host.CallOnRequestBody(id, []byte("11111"), false))
+		require.Equal(t, types.ActionContinue, host.CallOnRequestBody(id, []byte("22222"), true))
+		require.Equal(t, []string{`request body:"1111122222"`}, host.GetInfoLogs())
+
+		// The response body isn't buffered as the handler isn't implemented.
+		require.Equal(t, types.ActionContinue, host.CallOnResponseBody(id, []byte("33333"), false))
+		require.Equal(t, []string{`request body:"1111122222"`, "response body frame:5"}, host.GetInfoLogs())
+	})
+
+	t.Run("body and trailers", func(t *testing.T) {
+		host, id := newHost(t)
+		require.Equal(t, types.ActionContinue, host.CallOnRequestHeaders(id, nil, false))
+		require.Equal(t, types.ActionPause, host.CallOnRequestBody(id, []byte("11111"), false))
+		require.Equal(t, types.ActionContinue, host.CallOnRequestTrailers(id, [][2]string{{"key", "value"}}))
+		require.Equal(t, []string{`request body:"11111"`, "request trailers"}, host.GetInfoLogs())
+	})
+
+	t.Run("headers only", func(t *testing.T) {
+		host, id := newHost(t)
+		require.Equal(t, types.ActionContinue, host.CallOnRequestHeaders(id, nil, true))
+		require.Equal(t, []string{`request body:""`}, host.GetInfoLogs())
+	})
+
+	t.Run("trailers only", func(t *testing.T) {
+		host, id := newHost(t)
+		require.Equal(t, types.ActionContinue, host.CallOnRequestHeaders(id, nil, false))
+		require.Equal(t, types.ActionContinue, host.CallOnRequestTrailers(id, [][2]string{{"key", "value"}}))
+		require.Equal(t, []string{`request body:""`, "request trailers"}, host.GetInfoLogs())
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		host, id := newHost(t)
+		require.Equal(t, types.ActionContinue, host.CallOnRequestHeaders(id, nil, false))
+		require.Equal(t, types.ActionPause, host.CallOnRequestBody(id, []byte("11111"), false))
+		require.Equal(t, types.ActionPause, host.CallOnRequestBody(id, []byte("222222"), false))
+		require.Equal(t, types.ActionPause, host.CallOnRequestTrailers(id, nil))
+		require.Empty(t, host.GetInfoLogs())
+
+		res := host.GetSentLocalResponse(id)
+		require.NotNil(t, res)
+		require.Equal(t, uint32(413), res.StatusCode)
+		require.Equal(t, []byte("Payload Too Large"), res.Data)
+	})
+
+	t.Run("response too large", func(t *testing.T) {
+		opt := proxytest.NewEmulatorOption().WithVMContext(&fullBodyVMContext{response: true})
+		host, reset := proxytest.NewHostEmulator(opt)
+		defer reset()
+		id := host.InitializeHttpContext()
+
+		// The response headers have been sent to the downstream, so the stream is reset instead of the local response.
+		require.Equal(t, types.ActionContinue, host.CallOnResponseHeaders(id, nil, false))
+		require.Equal(t, types.ActionPause, host.CallOnResponseBody(id, []byte("11111"), false))
+		require.False(t, host.IsHttpStreamReset(id))
+		require.Equal(t, types.ActionPause, host.CallOnResponseBody(id, []byte("222222"), false))
+		require.Equal(t, types.ActionPause, host.CallOnResponseTrailers(id, nil))
+		require.Empty(t, host.GetInfoLogs())
+		require.True(t, host.IsHttpStreamReset(id))
+		require.Nil(t, host.GetSentLocalResponse(id))
+	})
+}
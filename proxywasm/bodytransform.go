@@ -0,0 +1,191 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxywasm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+// BodyTransformer transforms the HTTP body frame by frame without buffering the whole body.
+type BodyTransformer interface {
+	// Transform writes the transformed in to dst, and returns the number of bytes consumed from in.
+	// in is the unconsumed bytes of the previous frames followed by the current frame.
+	// The bytes not consumed are carried over to the next call, e.g. an incomplete line or a partial match.
+	// When endOfStream is true, the bytes not consumed are written to the body as they are.
+	Transform(dst io.Writer, in []byte, endOfStream bool) (consumed int, err error)
+}
+
+// BodyTransformerFunc is the function implementing BodyTransformer.
+type BodyTransformerFunc func(dst io.Writer, in []byte, endOfStream bool) (consumed int, err error)
+
+// Transform implements BodyTransformer.
+func (f BodyTransformerFunc) Transform(dst io.Writer, in []byte, endOfStream bool) (int, error) {
+	return f(dst, in, endOfStream)
+}
+
+// BodyStream applies a BodyTransformer to each frame of the HTTP request or response body,
+// replacing the frame in place with the output. Call OnBody from types.HttpContext.OnHttpRequestBody
+// or types.HttpContext.OnHttpResponseBody, and OnTrailers from the trailers callback of the same direction.
+// Remove the "content-length" header in the headers callback since the size of the body may change.
+//
+// The body can only be modified during the body callbacks, so if the stream ends with trailers, e.g. gRPC,
+// while the transformer still carries over bytes, the stream fails rather than passing the truncated body.
+// Transformers should keep the carried-over bytes as short as possible.
+type BodyStream struct {
+	transformer BodyTransformer
+	getBody     func(start, maxSize int) ([]byte, error)
+	replaceBody func(data []byte) error
+	reject      func() error
+	leftover    []byte
+	failed      bool
+}
+
+// NewRequestBodyStream returns a BodyStream which transforms the request body.
+func NewRequestBodyStream(transformer BodyTransformer) *BodyStream {
+	return &BodyStream{transformer: transformer, getBody: GetHttpRequestBody, replaceBody: ReplaceHttpRequestBody,
+		reject: func() error {
+			return SendHttpResponse(500, nil, []byte("Internal Server Error"), -1)
+		}}
+}
+
+// NewResponseBodyStream returns a BodyStream which transforms the response body.
+func NewResponseBodyStream(transformer BodyTransformer) *BodyStream {
+	return &BodyStream{transformer: transformer, getBody: GetHttpResponseBody, replaceBody: ReplaceHttpResponseBody,
+		reject: ResetHttpStream}
+}
+
+// OnBody transforms the current frame, and returns the action to be returned from the body callback.
+// If the transformer or a hostcall fails, rather than passing the untransformed body, the request is rejected
+// by SendHttpResponse with 500, or the stream is reset by ResetHttpStream for the response since the response
+// headers have already been sent to the downstream, and types.ActionPause is returned.
+func (s *BodyStream) OnBody(bodySize int, endOfStream bool) types.Action {
+	if s.failed {
+		return types.ActionPause
+	}
+
+	in := s.leftover
+	if bodySize > 0 {
+		frame, err := s.getBody(0, bodySize)
+		if err != nil {
+			return s.fail("failed to get body: %v", err)
+		}
+		in = append(in, frame...)
+	}
+
+	var out bytes.Buffer
+	consumed, err := s.transformer.Transform(&out, in, endOfStream)
+	if err != nil {
+		return s.fail("failed to transform body: %v", err)
+	}
+	if endOfStream {
+		out.Write(in[consumed:])
+		s.leftover = nil
+	} else {
+		s.leftover = append([]byte(nil), in[consumed:]...)
+	}
+
+	if err := s.replaceBody(out.Bytes()); err != nil {
+		return s.fail("failed to replace body: %v", err)
+	}
+	return types.ActionContinue
+}
+
+// OnTrailers returns the action to be returned from types.HttpContext.OnHttpRequestTrailers or
+// types.HttpContext.OnHttpResponseTrailers. If the transformer has carried-over bytes which can no longer
+// be written to the body, the stream fails in the same way as OnBody, and types.ActionPause is returned.
+func (s *BodyStream) OnTrailers() types.Action {
+	if s.failed {
+		return types.ActionPause
+	}
+	if len(s.leftover) > 0 {
+		return s.fail("failed to flush body: %v", fmt.Errorf("%d bytes carried over to the trailers", len(s.leftover)))
+	}
+	return types.ActionContinue
+}
+
+func (s *BodyStream) fail(format string, err error) types.Action {
+	LogErrorf(format, err)
+	s.failed = true
+	s.leftover = nil
+	if err := s.reject(); err != nil {
+		LogErrorf("failed to reject the stream: %v", err)
+	}
+	return types.ActionPause
+}
+
+// NewLineTransformer returns a BodyTransformer which calls f with each line of the body including the trailing "\n",
+// and writes the returned bytes in place of the line. The last line may not end with "\n".
+func NewLineTransformer(f func(line []byte) []byte) BodyTransformer {
+	return BodyTransformerFunc(func(dst io.Writer, in []byte, endOfStream bool) (int, error) {
+		consumed := 0
+		for {
+			i := bytes.IndexByte(in[consumed:], '\n')
+			if i < 0 {
+				break
+			}
+			if _, err := dst.Write(f(in[consumed : consumed+i+1])); err != nil {
+				return 0, err
+			}
+			consumed += i + 1
+		}
+		if endOfStream && consumed < len(in) {
+			if _, err := dst.Write(f(in[consumed:])); err != nil {
+				return 0, err
+			}
+			consumed = len(in)
+		}
+		return consumed, nil
+	})
+}
+
+// NewReplaceTransformer returns a BodyTransformer which replaces all the occurrences of old with new,
+// including the ones spanning multiple frames. old must not be empty.
+func NewReplaceTransformer(old, new []byte) BodyTransformer {
+	if len(old) == 0 {
+		panic("old must not be empty")
+	}
+	return BodyTransformerFunc(func(dst io.Writer, in []byte, endOfStream bool) (int, error) {
+		consumed := 0
+		for {
+			i := bytes.Index(in[consumed:], old)
+			if i < 0 {
+				break
+			}
+			if _, err := dst.Write(in[consumed : consumed+i]); err != nil {
+				return 0, err
+			}
+			if _, err := dst.Write(new); err != nil {
+				return 0, err
+			}
+			consumed += i + len(old)
+		}
+
+		// Keep the tail which might be the prefix of old split across frames.
+		end := len(in)
+		if !endOfStream && end-consumed >= len(old) {
+			end -= len(old) - 1
+		} else if !endOfStream {
+			end = consumed
+		}
+		if _, err := dst.Write(in[consumed:end]); err != nil {
+			return 0, err
+		}
+		return end, nil
+	})
+}
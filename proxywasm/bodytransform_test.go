@@ -0,0 +1,133 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxywasm_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+type transformVMContext struct {
+	types.DefaultVMContext
+}
+
+type transformPluginContext struct {
+	types.DefaultPluginContext
+}
+
+type transformHttpContext struct {
+	types.DefaultHttpContext
+	request, response *proxywasm.BodyStream
+}
+
+// NewPluginContext implements the same method on types.VMContext.
+func (*transformVMContext) NewPluginContext(uint32) types.PluginContext {
+	return &transformPluginContext{}
+}
+
+// NewHttpContext implements the same method on types.PluginContext.
+func (*transformPluginContext) NewHttpContext(uint32) types.HttpContext {
+	return &transformHttpContext{
+		request: proxywasm.NewRequestBodyStream(proxywasm.NewLineTransformer(func(line []byte) []byte {
+			if bytes.HasPrefix(line, []byte("password=")) {
+				return []byte("password=***\n")
+			}
+			return line
+		})),
+		response: proxywasm.NewResponseBodyStream(proxywasm.NewReplaceTransformer([]byte("foo"), []byte("bar"))),
+	}
+}
+
+// OnHttpRequestBody implements the same method on types.HttpContext.
+func (h *transformHttpContext) OnHttpRequestBody(bodySize int, endOfStream bool) types.Action {
+	return h.request.OnBody(bodySize, endOfStream)
+}
+
+// OnHttpResponseBody implements the same method on types.HttpContext.
+func (h *transformHttpContext) OnHttpResponseBody(bodySize int, endOfStream bool) types.Action {
+	return h.response.OnBody(bodySize, endOfStream)
+}
+
+// OnHttpRequestTrailers implements the same method on types.HttpContext.
+func (h *transformHttpContext) OnHttpRequestTrailers(int) types.Action {
+	return h.request.OnTrailers()
+}
+
+// OnHttpResponseTrailers implements the same method on types.HttpContext.
+func (h *transformHttpContext) OnHttpResponseTrailers(int) types.Action {
+	return h.response.OnTrailers()
+}
+
+func TestBodyStream(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(&transformVMContext{}))
+	defer reset()
+	id := host.InitializeHttpContext()
+
+	t.Run("lines", func(t *testing.T) {
+		for _, tc := range []struct {
+			frame, exp  string
+			endOfStream bool
+		}{
+			{frame: "user=alice\npass", exp: "user=alice\n"},
+			{frame: "word=secret\nname=", exp: "password=***\n"},
+			{frame: "bob", exp: "name=bob", endOfStream: true},
+		} {
+			require.Equal(t, types.ActionContinue, host.CallOnRequestBody(id, []byte(tc.frame), tc.endOfStream))
+			require.Equal(t, tc.exp, string(host.GetCurrentRequestBody(id)))
+		}
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		for _, tc := range []struct {
+			frame, exp  string
+			endOfStream bool
+		}{
+			{frame: "xxfo", exp: "xx"},
+			{frame: "oyyf", exp: "bary"},
+			{frame: "", exp: "yf", endOfStream: true},
+		} {
+			require.Equal(t, types.ActionContinue, host.CallOnResponseBody(id, []byte(tc.frame), tc.endOfStream))
+			require.Equal(t, tc.exp, string(host.GetCurrentResponseBody(id)))
+		}
+	})
+
+	t.Run("trailers", func(t *testing.T) {
+		id := host.InitializeHttpContext()
+		require.Equal(t, types.ActionContinue, host.CallOnRequestBody(id, []byte("user=alice\n"), false))
+		require.Equal(t, types.ActionContinue, host.CallOnRequestTrailers(id, nil))
+		require.Nil(t, host.GetSentLocalResponse(id))
+	})
+
+	t.Run("trailers with carried-over bytes", func(t *testing.T) {
+		id := host.InitializeHttpContext()
+		require.Equal(t, types.ActionContinue, host.CallOnRequestBody(id, []byte("user=alice\npass"), false))
+		require.Equal(t, types.ActionPause, host.CallOnRequestTrailers(id, nil))
+		require.Equal(t, uint32(500), host.GetSentLocalResponse(id).StatusCode)
+		require.Contains(t, host.GetErrorLogs(), "failed to flush body: 4 bytes carried over to the trailers")
+
+		// The response headers have been sent to the downstream, so the stream is reset instead.
+		id = host.InitializeHttpContext()
+		require.Equal(t, types.ActionContinue, host.CallOnResponseBody(id, []byte("xxfo"), false))
+		require.Equal(t, types.ActionPause, host.CallOnResponseTrailers(id, nil))
+		require.True(t, host.IsHttpStreamReset(id))
+		require.Nil(t, host.GetSentLocalResponse(id))
+	})
+}
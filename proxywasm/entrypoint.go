@@ -25,3 +25,19 @@ import (
 func SetVMContext(ctx types.VMContext) {
 	internal.SetVMContext(ctx)
 }
+
+// PanicMetricName is the name of the counter metric incremented on every panic recovered by SetPanicPolicy.
+const PanicMetricName = internal.PanicMetricName
+
+// SetPanicPolicy opts in to recovering panics in the callbacks of types.HttpContext, including the callbacks of
+// HTTP callouts dispatched by them. A recovered panic is logged with the stack trace at the critical level,
+// increments the counter PanicMetricName, and is handled according to the policy. Call this in "main()" along with
+// SetVMContext.
+//
+// Note that the recovery requires the support of recover in the toolchain; with TinyGo versions which
+// don't support it on WebAssembly, the VM aborts as with types.PanicPolicyNone.
+// With types.PanicPolicyFailOpen, a stream paused for an HTTP callout is not resumed if the callback panics,
+// since which direction to resume is unknown.
+func SetPanicPolicy(policy types.PanicPolicy) {
+	internal.SetPanicPolicy(policy)
+}
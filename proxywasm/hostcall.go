@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"time"
 
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/internal"
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
@@ -41,6 +42,27 @@ func SetTickPeriodMilliSeconds(millSec uint32) error {
 	return internal.StatusToError(internal.ProxySetTickPeriodMilliseconds(millSec))
 }
 
+// GetCurrentTime returns the current time of the host. Unlike time.Now, this is controlled by
+// proxytest.HostEmulator in tests, so the time-dependent logic should prefer this.
+func GetCurrentTime() (time.Time, error) {
+	var nanos int64
+	if err := internal.StatusToError(internal.ProxyGetCurrentTimeNanoseconds(&nanos)); err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, nanos), nil
+}
+
+// Now returns the current time of the host as GetCurrentTime does, but falls back to time.Now
+// if the host doesn't support it. Note that the local clock of each VM may differ from the others,
+// so VMs sharing the state, for example via shared data, may disagree on the time when falling back.
+func Now() time.Time {
+	now, err := GetCurrentTime()
+	if err != nil {
+		return time.Now()
+	}
+	return now
+}
+
 // SetEffectiveContext sets the effective context to "context_id".
 // This hostcall is usually used to change the context after receiving
 // types.PluginContext.OnQueueReady or types.PluginContext.OnTick
@@ -151,6 +173,144 @@ func GetHttpCallResponseTrailers() ([][2]string, error) {
 	return getMap(internal.MapTypeHttpCallResponseTrailers)
 }
 
+// DispatchGrpcCall is for dispatching unary gRPC calls to a remote cluster. This can be used by all contexts
+// including Tcp and Root contexts. "grpcService" arg specifies the remote cluster the host will send the request against,
+// and "serviceName" and "method" specify the fully-qualified gRPC service name (e.g. "envoy.service.auth.v3.Authorization")
+// and the method name (e.g. "Check"). "message" is the serialized request message.
+// "callBack" function is called when the host received the response or the call failed.
+// "grpcStatus" passed to the callBack is 0 (OK) on success, and the gRPC status code of the failure otherwise.
+// When the callBack function is called with grpcStatus 0, the "GetGrpcCallResponseMessage" and
+// "GetGrpcCallResponseTrailingMetadata" calls are available for accessing the response information.
+// Note that the trailing metadata is only available if the host delivers it before the response message,
+// which not all hosts do for unary calls.
+func DispatchGrpcCall(
+	grpcService string,
+	serviceName string,
+	method string,
+	initialMetadata [][2]string,
+	message []byte,
+	timeoutMillisecond uint32,
+	callBack func(grpcStatus uint32, responseSize int),
+) (calloutID uint32, err error) {
+	sms := internal.SerializeMap(initialMetadata)
+	mp := &sms[0]
+	ml := len(sms)
+
+	var messagePtr *byte
+	if len(message) > 0 {
+		messagePtr = &message[0]
+	}
+
+	switch st := internal.ProxyGrpcCall(
+		internal.StringBytePtr(grpcService), len(grpcService),
+		internal.StringBytePtr(serviceName), len(serviceName),
+		internal.StringBytePtr(method), len(method),
+		mp, ml, messagePtr, len(message), timeoutMillisecond, &calloutID); st {
+	case internal.StatusOK:
+		internal.RegisterGrpcCallout(calloutID, callBack)
+		return calloutID, nil
+	default:
+		return 0, internal.StatusToError(st)
+	}
+}
+
+// GetGrpcCallResponseMessage is used for retrieving the serialized response message
+// returned by a remote cluster in response to the DispatchGrpcCall.
+// Only available during "callback" function passed to the DispatchGrpcCall.
+func GetGrpcCallResponseMessage(start, maxSize int) ([]byte, error) {
+	return getBuffer(internal.BufferTypeGrpcReceiveBuffer, start, maxSize)
+}
+
+// GetGrpcCallResponseTrailingMetadata is used for retrieving the trailing metadata
+// returned by a remote cluster in response to the DispatchGrpcCall.
+// Only available during "callback" function passed to the DispatchGrpcCall.
+// This returns types.ErrorStatusNotFound if the host hasn't delivered the trailing metadata.
+func GetGrpcCallResponseTrailingMetadata() ([][2]string, error) {
+	md := internal.GetGrpcCallTrailingMetadata()
+	if md == nil {
+		return nil, types.ErrorStatusNotFound
+	}
+	return md, nil
+}
+
+// GrpcStream represents a bidirectional gRPC stream opened by OpenGrpcStream.
+type GrpcStream uint32
+
+// OpenGrpcStream opens a bidirectional gRPC stream to a remote cluster. This can be used by all contexts
+// including Tcp and Root contexts. "grpcService", "serviceName" and "method" are the same as DispatchGrpcCall.
+// The events on the stream, such as received messages, are delivered to the given types.GrpcStreamContext
+// until types.GrpcStreamContext.OnGrpcStreamClose is called or the stream is cancelled via GrpcStream.Cancel.
+func OpenGrpcStream(
+	grpcService string,
+	serviceName string,
+	method string,
+	initialMetadata [][2]string,
+	ctx types.GrpcStreamContext,
+) (GrpcStream, error) {
+	sms := internal.SerializeMap(initialMetadata)
+	mp := &sms[0]
+	ml := len(sms)
+
+	var streamID uint32
+	switch st := internal.ProxyGrpcStream(
+		internal.StringBytePtr(grpcService), len(grpcService),
+		internal.StringBytePtr(serviceName), len(serviceName),
+		internal.StringBytePtr(method), len(method),
+		mp, ml, &streamID); st {
+	case internal.StatusOK:
+		internal.RegisterGrpcStream(streamID, ctx)
+		return GrpcStream(streamID), nil
+	default:
+		return 0, internal.StatusToError(st)
+	}
+}
+
+// ID returns the identifier of this stream assigned by the host.
+func (s GrpcStream) ID() uint32 {
+	return uint32(s)
+}
+
+// Send sends the serialized message on this stream.
+// Set endOfStream to true to half-close the stream after sending the message.
+func (s GrpcStream) Send(message []byte, endOfStream bool) error {
+	var messagePtr *byte
+	if len(message) > 0 {
+		messagePtr = &message[0]
+	}
+	return internal.StatusToError(internal.ProxyGrpcSend(uint32(s), messagePtr, len(message), endOfStream))
+}
+
+// Cancel cancels this stream. No further events are delivered to the types.GrpcStreamContext
+// after this call.
+func (s GrpcStream) Cancel() error {
+	internal.UnregisterGrpcStream(uint32(s))
+	return internal.StatusToError(internal.ProxyGrpcCancel(uint32(s)))
+}
+
+// Close gracefully closes this stream from the local side. The remaining events from the remote,
+// including types.GrpcStreamContext.OnGrpcStreamClose, are still delivered after this call.
+func (s GrpcStream) Close() error {
+	return internal.StatusToError(internal.ProxyGrpcClose(uint32(s)))
+}
+
+// GetGrpcStreamInitialMetadata is used for retrieving the initial metadata received on a gRPC stream.
+// Only available during types.GrpcStreamContext.OnGrpcStreamInitialMetadata.
+func GetGrpcStreamInitialMetadata() ([][2]string, error) {
+	return getMap(internal.MapTypeGrpcReceiveInitialMetadata)
+}
+
+// GetGrpcStreamMessage is used for retrieving the serialized message received on a gRPC stream.
+// Only available during types.GrpcStreamContext.OnGrpcStreamMessage.
+func GetGrpcStreamMessage(start, maxSize int) ([]byte, error) {
+	return getBuffer(internal.BufferTypeGrpcReceiveBuffer, start, maxSize)
+}
+
+// GetGrpcStreamTrailingMetadata is used for retrieving the trailing metadata received on a gRPC stream.
+// Only available during types.GrpcStreamContext.OnGrpcStreamTrailingMetadata.
+func GetGrpcStreamTrailingMetadata() ([][2]string, error) {
+	return getMap(internal.MapTypeGrpcReceiveTrailingMetadata)
+}
+
 // GetDownstreamData can be used for retrieving TCP downstream data buffered in the host.
 // Returned bytes beginning from "start" to "start" + "maxSize" in the buffer.
 // Only available during types.TcpContext.OnDownstreamData.
@@ -501,6 +661,14 @@ func SendHttpResponse(statusCode uint32, headers [][2]string, body []byte, gRPCS
 	)
 }
 
+// ResetHttpStream resets the HTTP stream in both directions. Use this in place of SendHttpResponse to abort
+// the response after types.HttpContext.OnHttpResponseHeaders returned Continue, since the downstream has
+// possibly received the response headers. After you've invoked this function, you *must* return
+// types.Action.Pause. Only available during types.HttpContext.
+func ResetHttpStream() error {
+	return internal.StatusToError(internal.ProxyCloseStream(internal.StreamTypeResponse))
+}
+
 // GetSharedData is used for retrieving the value for given "key".
 // For thread-safe updates you must use the returned "cas" value
 // when calling SetSharedData for the same key.
@@ -625,6 +793,27 @@ func CallForeignFunction(funcName string, param []byte) (ret []byte, err error)
 	}
 }
 
+// GetForeignFunctionCallData returns the argument passed by the host to the foreign function.
+// Only available during types.ForeignFunctionHandler.OnForeignFunction.
+func GetForeignFunctionCallData() ([]byte, error) {
+	return getBuffer(internal.BufferTypeCallData, 0, math.MaxInt32)
+}
+
+// GetLogLevel returns the log level of the host. The logs below this level are discarded by the host,
+// so the Log*f functions skip formatting them. The level is queried once and cached, and the cache is updated
+// when the host notifies the changes. Note that the changes are not reflected on the hosts which don't notify them.
+func GetLogLevel() (types.LogLevel, error) {
+	level, err := internal.GetLogLevel()
+	return types.LogLevel(level), err
+}
+
+// logEnabled returns whether the host emits the logs of the given level.
+// This errs on the side of emitting if the host fails to return the level.
+func logEnabled(level internal.LogLevel) bool {
+	current, err := internal.GetLogLevel()
+	return err != nil || level >= current
+}
+
 // LogTrace emits a message as a log with Trace log level.
 func LogTrace(msg string) {
 	internal.ProxyLog(internal.LogLevelTrace, internal.StringBytePtr(msg), len(msg))
@@ -637,6 +826,9 @@ func LogTrace(msg string) {
 // https://tinygo.org/docs/reference/lang-support/stdlib/#fmt for more
 // information.
 func LogTracef(format string, args ...interface{}) {
+	if !logEnabled(internal.LogLevelTrace) {
+		return
+	}
 	msg := fmt.Sprintf(format, args...)
 	internal.ProxyLog(internal.LogLevelTrace, internal.StringBytePtr(msg), len(msg))
 }
@@ -653,6 +845,9 @@ func LogDebug(msg string) {
 // https://tinygo.org/docs/reference/lang-support/stdlib/#fmt for more
 // information.
 func LogDebugf(format string, args ...interface{}) {
+	if !logEnabled(internal.LogLevelDebug) {
+		return
+	}
 	msg := fmt.Sprintf(format, args...)
 	internal.ProxyLog(internal.LogLevelDebug, internal.StringBytePtr(msg), len(msg))
 }
@@ -669,6 +864,9 @@ func LogInfo(msg string) {
 // https://tinygo.org/docs/reference/lang-support/stdlib/#fmt for more
 // information.
 func LogInfof(format string, args ...interface{}) {
+	if !logEnabled(internal.LogLevelInfo) {
+		return
+	}
 	msg := fmt.Sprintf(format, args...)
 	internal.ProxyLog(internal.LogLevelInfo, internal.StringBytePtr(msg), len(msg))
 }
@@ -685,6 +883,9 @@ func LogWarn(msg string) {
 // https://tinygo.org/docs/reference/lang-support/stdlib/#fmt for more
 // information.
 func LogWarnf(format string, args ...interface{}) {
+	if !logEnabled(internal.LogLevelWarn) {
+		return
+	}
 	msg := fmt.Sprintf(format, args...)
 	internal.ProxyLog(internal.LogLevelWarn, internal.StringBytePtr(msg), len(msg))
 }
@@ -701,6 +902,9 @@ func LogError(msg string) {
 // https://tinygo.org/docs/reference/lang-support/stdlib/#fmt for more
 // information.
 func LogErrorf(format string, args ...interface{}) {
+	if !logEnabled(internal.LogLevelError) {
+		return
+	}
 	msg := fmt.Sprintf(format, args...)
 	internal.ProxyLog(internal.LogLevelError, internal.StringBytePtr(msg), len(msg))
 }
@@ -717,6 +921,9 @@ func LogCritical(msg string) {
 // https://tinygo.org/docs/reference/lang-support/stdlib/#fmt for more
 // information.
 func LogCriticalf(format string, args ...interface{}) {
+	if !logEnabled(internal.LogLevelCritical) {
+		return
+	}
 	msg := fmt.Sprintf(format, args...)
 	internal.ProxyLog(internal.LogLevelCritical, internal.StringBytePtr(msg), len(msg))
 }
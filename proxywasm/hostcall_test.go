@@ -16,10 +16,12 @@ package proxywasm
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/internal"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
 )
 
 type logHost struct {
@@ -178,6 +180,87 @@ func TestHostCall_Logging(t *testing.T) {
 	})
 }
 
+type logLevelHost struct {
+	internal.DefaultProxyWAMSHost
+	level    internal.LogLevel
+	queries  int
+	messages []string
+}
+
+func (l *logLevelHost) ProxyGetLogLevel(returnLogLevel *internal.LogLevel) internal.Status {
+	l.queries++
+	*returnLogLevel = l.level
+	return internal.StatusOK
+}
+
+func (l *logLevelHost) ProxyLog(logLevel internal.LogLevel, messageData *byte, messageSize int) internal.Status {
+	l.messages = append(l.messages, internal.RawBytePtrToString(messageData, messageSize))
+	return internal.StatusOK
+}
+
+// formatCounter counts how many times it is formatted.
+type formatCounter int
+
+func (c *formatCounter) String() string {
+	*c++
+	return "formatted"
+}
+
+func TestHostCall_LogLevel(t *testing.T) {
+	host := &logLevelHost{level: internal.LogLevelWarn}
+	defer internal.RegisterMockWasmHost(host)()
+	// Drop the level cached from the previous hosts.
+	internal.VMStateReset()
+	defer internal.VMStateReset()
+
+	level, err := GetLogLevel()
+	require.NoError(t, err)
+	require.Equal(t, types.LogLevelWarn, level)
+
+	// The logs below the level of the host are not formatted.
+	var c formatCounter
+	LogDebugf("debug: %s", &c)
+	LogWarnf("warn: %s", &c)
+	require.Equal(t, formatCounter(1), c)
+	require.Equal(t, []string{"warn: formatted"}, host.messages)
+	// The level is queried only once.
+	require.Equal(t, 1, host.queries)
+
+	// The notified level replaces the cached one.
+	internal.ProxyOnLogLevelChanged(internal.LogLevelDebug)
+	LogDebugf("debug: %s", &c)
+	LogTracef("trace: %s", &c)
+	require.Equal(t, formatCounter(2), c)
+	require.Equal(t, []string{"warn: formatted", "debug: formatted"}, host.messages)
+	require.Equal(t, 1, host.queries)
+}
+
+type timeHost struct {
+	internal.DefaultProxyWAMSHost
+	status internal.Status
+}
+
+// ProxyGetCurrentTimeNanoseconds implements the same method on internal.ProxyWasmHost.
+func (h timeHost) ProxyGetCurrentTimeNanoseconds(returnTime *int64) internal.Status {
+	*returnTime = 1234
+	return h.status
+}
+
+func TestHostCall_Now(t *testing.T) {
+	t.Run("host time", func(t *testing.T) {
+		defer internal.RegisterMockWasmHost(timeHost{status: internal.StatusOK})()
+		require.Equal(t, time.Unix(0, 1234), Now())
+	})
+
+	t.Run("fall back to local clock", func(t *testing.T) {
+		defer internal.RegisterMockWasmHost(timeHost{status: internal.StatusUnimplemented})()
+		before := time.Now()
+		now := Now()
+		require.False(t, now.Before(before))
+		require.False(t, now.After(time.Now()))
+	})
+}
+
 type metricProxyWasmHost struct {
 	internal.DefaultProxyWAMSHost
 	idToValue map[uint32]uint64
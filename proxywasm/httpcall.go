@@ -0,0 +1,178 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxywasm
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+// ErrHttpCallFailed is passed to the callback of DispatchHttpCallout when the host could not receive
+// the response from the remote cluster, e.g. on timeout or connection reset.
+var ErrHttpCallFailed = errors.New("http call failed without response")
+
+// HttpCallout is an HTTP call to be dispatched by DispatchHttpCallout and DispatchHttpCallouts.
+type HttpCallout struct {
+	// Cluster, Headers, Body, Trailers and TimeoutMillisecond are the same as the arguments of DispatchHttpCall.
+	Cluster            string
+	Headers            [][2]string
+	Body               []byte
+	Trailers           [][2]string
+	TimeoutMillisecond uint32
+
+	// MaxRetries is the maximum number of times the call is dispatched again when ShouldRetry returns true.
+	MaxRetries int
+	// ShouldRetry reports whether the call should be retried for the given result.
+	// If nil, the call is retried on ErrHttpCallFailed or a 5xx response.
+	ShouldRetry func(res *HttpCallResponse, err error) bool
+}
+
+// HttpCallResponse is the response of an HTTP call received from the remote cluster.
+type HttpCallResponse struct {
+	// StatusCode is the value of the ":status" response header, or zero if it is missing or malformed.
+	StatusCode int
+	Headers    [][2]string
+	Body       []byte
+	Trailers   [][2]string
+}
+
+// HttpCallResult is the result of one of the HTTP calls dispatched by DispatchHttpCallouts.
+// Response is nil if Err is not nil.
+type HttpCallResult struct {
+	Response *HttpCallResponse
+	Err      error
+}
+
+// LocalResponse is the response sent to the downstream by DispatchHttpCalloutsAndResume
+// in place of resuming the HTTP stream.
+type LocalResponse struct {
+	StatusCode uint32
+	Headers    [][2]string
+	Body       []byte
+}
+
+// DispatchHttpCallout dispatches the HTTP call in the same way as DispatchHttpCall, but retries it
+// as configured in the callout and reads the response before calling callBack with the final result.
+// The returned error is only for the first dispatch; the failure of a retry is passed to callBack instead.
+func DispatchHttpCallout(callout HttpCallout, callBack func(res *HttpCallResponse, err error)) error {
+	return dispatchHttpCallout(&callout, 0, callBack)
+}
+
+func dispatchHttpCallout(callout *HttpCallout, attempt int, callBack func(res *HttpCallResponse, err error)) error {
+	_, err := DispatchHttpCall(callout.Cluster, callout.Headers, callout.Body, callout.Trailers, callout.TimeoutMillisecond,
+		func(numHeaders, bodySize, numTrailers int) {
+			res, err := readHttpCallResponse(numHeaders, bodySize, numTrailers)
+			if attempt < callout.MaxRetries && callout.shouldRetry(res, err) {
+				if err := dispatchHttpCallout(callout, attempt+1, callBack); err != nil {
+					callBack(nil, err)
+				}
+				return
+			}
+			callBack(res, err)
+		})
+	return err
+}
+
+func (c *HttpCallout) shouldRetry(res *HttpCallResponse, err error) bool {
+	if c.ShouldRetry != nil {
+		return c.ShouldRetry(res, err)
+	}
+	return errors.Is(err, ErrHttpCallFailed) || (res != nil && res.StatusCode >= 500)
+}
+
+// readHttpCallResponse reads the response of the HTTP call. This is only available during the callback of DispatchHttpCall.
+func readHttpCallResponse(numHeaders, bodySize, numTrailers int) (*HttpCallResponse, error) {
+	// The host calls back without headers when it fails to receive the response.
+	if numHeaders == 0 {
+		return nil, ErrHttpCallFailed
+	}
+
+	res := &HttpCallResponse{}
+	var err error
+	if res.Headers, err = GetHttpCallResponseHeaders(); err != nil {
+		return nil, err
+	}
+	for _, h := range res.Headers {
+		if h[0] == ":status" {
+			res.StatusCode, _ = strconv.Atoi(h[1])
+			break
+		}
+	}
+	if bodySize > 0 {
+		if res.Body, err = GetHttpCallResponseBody(0, bodySize); err != nil {
+			return nil, err
+		}
+	}
+	if numTrailers > 0 {
+		if res.Trailers, err = GetHttpCallResponseTrailers(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// DispatchHttpCallouts dispatches all the HTTP calls with DispatchHttpCallout at once, and calls join
+// with the results in the same order as callouts after all of them complete.
+// If any of the dispatches fails, the error is returned and join is never called.
+// The calls already dispatched at that point are not canceled, but their results are discarded.
+// At least one callout is required.
+func DispatchHttpCallouts(callouts []HttpCallout, join func(results []HttpCallResult)) error {
+	if len(callouts) == 0 {
+		return types.ErrorStatusBadArgument
+	}
+
+	results := make([]HttpCallResult, len(callouts))
+	pending := len(callouts)
+	aborted := false
+	for i := range callouts {
+		i := i
+		err := DispatchHttpCallout(callouts[i], func(res *HttpCallResponse, err error) {
+			results[i] = HttpCallResult{Response: res, Err: err}
+			pending--
+			if pending == 0 && !aborted {
+				join(results)
+			}
+		})
+		if err != nil {
+			aborted = true
+			return err
+		}
+	}
+	return nil
+}
+
+// DispatchHttpCalloutsAndResume dispatches the HTTP calls with DispatchHttpCallouts, and then resumes or rejects
+// the current HTTP stream depending on the results. If decide returns nil, the stream is resumed with resume,
+// i.e. ResumeHttpRequest or ResumeHttpResponse; otherwise the returned LocalResponse is sent with SendHttpResponse.
+// Only available for types.HttpContext, which must return types.ActionPause if this returns nil.
+func DispatchHttpCalloutsAndResume(
+	callouts []HttpCallout,
+	resume func() error,
+	decide func(results []HttpCallResult) *LocalResponse,
+) error {
+	return DispatchHttpCallouts(callouts, func(results []HttpCallResult) {
+		if res := decide(results); res != nil {
+			if err := SendHttpResponse(res.StatusCode, res.Headers, res.Body, -1); err != nil {
+				LogErrorf("failed to send local response: %v", err)
+			}
+			return
+		}
+		if err := resume(); err != nil {
+			LogErrorf("failed to resume http stream: %v", err)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxywasm_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+type calloutVMContext struct {
+	types.DefaultVMContext
+	results []proxywasm.HttpCallResult
+}
+
+type calloutPluginContext struct {
+	types.DefaultPluginContext
+	vm *calloutVMContext
+}
+
+type calloutHttpContext struct {
+	types.DefaultHttpContext
+	vm *calloutVMContext
+}
+
+// NewPluginContext implements the same method on types.VMContext.
+func (v *calloutVMContext) NewPluginContext(uint32) types.PluginContext {
+	return &calloutPluginContext{vm: v}
+}
+
+// NewHttpContext implements the same method on types.PluginContext.
+func (p *calloutPluginContext) NewHttpContext(uint32) types.HttpContext {
+	return &calloutHttpContext{vm: p.vm}
+}
+
+// OnHttpRequestHeaders implements the same method on types.HttpContext.
+func (h *calloutHttpContext) OnHttpRequestHeaders(int, bool) types.Action {
+	callouts := []proxywasm.HttpCallout{
+		{Cluster: "authz", Headers: [][2]string{{":path", "/check"}}, TimeoutMillisecond: 1000, MaxRetries: 1},
+		{Cluster: "quota", Headers: [][2]string{{":path", "/quota"}}, TimeoutMillisecond: 1000},
+	}
+	err := proxywasm.DispatchHttpCalloutsAndResume(callouts, proxywasm.ResumeHttpRequest,
+		func(results []proxywasm.HttpCallResult) *proxywasm.LocalResponse {
+			h.vm.results = results
+			for _, r := range results {
+				if r.Err != nil || r.Response.StatusCode != 200 {
+					return &proxywasm.LocalResponse{StatusCode: 403, Body: []byte("denied")}
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		proxywasm.LogCriticalf("failed to dispatch: %v", err)
+		return types.ActionContinue
+	}
+	return types.ActionPause
+}
+
+func TestDispatchHttpCalloutsAndResume(t *testing.T) {
+	t.Run("resume after retry", func(t *testing.T) {
+		vm := &calloutVMContext{}
+		host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm))
+		defer reset()
+
+		id := host.InitializeHttpContext()
+		require.Equal(t, types.ActionPause, host.CallOnRequestHeaders(id, nil, false))
+		callouts := host.GetCalloutAttributesFromContext(id)
+		require.Len(t, callouts, 2)
+
+		// The first call fails with 503, and is retried.
+		host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "503"}}, nil, nil)
+		host.CallOnHttpCallResponse(callouts[1].CalloutID, [][2]string{{":status", "200"}}, nil, []byte("ok"))
+		require.Equal(t, types.ActionPause, host.GetCurrentHttpStreamAction(id))
+
+		retried := host.GetCalloutAttributesFromContext(id)
+		require.Len(t, retried, 3)
+		require.Equal(t, "authz", retried[2].Upstream)
+		host.CallOnHttpCallResponse(retried[2].CalloutID,
+			[][2]string{{":status", "200"}}, [][2]string{{"grpc-status", "0"}}, []byte("allowed"))
+
+		require.Equal(t, types.ActionContinue, host.GetCurrentHttpStreamAction(id))
+		require.Nil(t, host.GetSentLocalResponse(id))
+		require.Equal(t, []proxywasm.HttpCallResult{
+			{Response: &proxywasm.HttpCallResponse{
+				StatusCode: 200,
+				Headers:    [][2]string{{":status", "200"}},
+				Body:       []byte("allowed"),
+				Trailers:   [][2]string{{"grpc-status", "0"}},
+			}},
+			{Response: &proxywasm.HttpCallResponse{
+				StatusCode: 200,
+				Headers:    [][2]string{{":status", "200"}},
+				Body:       []byte("ok"),
+			}},
+		}, vm.results)
+	})
+
+	t.Run("reject on failure", func(t *testing.T) {
+		vm := &calloutVMContext{}
+		host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm))
+		defer reset()
+
+		id := host.InitializeHttpContext()
+		require.Equal(t, types.ActionPause, host.CallOnRequestHeaders(id, nil, false))
+		callouts := host.GetCalloutAttributesFromContext(id)
+		require.Len(t, callouts, 2)
+
+		// The host calls back without headers on timeout. The second call isn't retried.
+		host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "200"}}, nil, nil)
+		host.CallOnHttpCallResponse(callouts[1].CalloutID, nil, nil, nil)
+		require.Len(t, host.GetCalloutAttributesFromContext(id), 2)
+
+		require.ErrorIs(t, vm.results[1].Err, proxywasm.ErrHttpCallFailed)
+		res := host.GetSentLocalResponse(id)
+		require.NotNil(t, res)
+		require.Equal(t, uint32(403), res.StatusCode)
+		require.Equal(t, []byte("denied"), res.Data)
+	})
+}
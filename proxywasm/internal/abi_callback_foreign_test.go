@@ -0,0 +1,54 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+type foreignFunctionContext struct {
+	types.DefaultPluginContext
+	functionID uint32
+	argSize    int
+}
+
+func (ctx *foreignFunctionContext) OnForeignFunction(functionID uint32, argSize int) {
+	ctx.functionID = functionID
+	ctx.argSize = argSize
+}
+
+func Test_proxyOnForeignFunction(t *testing.T) {
+	var id uint32 = 100
+	currentStateMux.Lock()
+	defer currentStateMux.Unlock()
+
+	t.Run("handler", func(t *testing.T) {
+		ctx := &foreignFunctionContext{}
+		currentState = &state{pluginContexts: map[uint32]*pluginContextState{id: {context: ctx}}}
+		proxyOnForeignFunction(id, 5, 10)
+		require.Equal(t, uint32(5), ctx.functionID)
+		require.Equal(t, 10, ctx.argSize)
+		require.Equal(t, id, currentState.activeContextID)
+	})
+
+	t.Run("no handler", func(t *testing.T) {
+		currentState = &state{pluginContexts: map[uint32]*pluginContextState{id: {context: &types.DefaultPluginContext{}}}}
+		require.NotPanics(t, func() { proxyOnForeignFunction(id, 5, 10) })
+	})
+}
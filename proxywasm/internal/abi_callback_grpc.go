@@ -0,0 +1,136 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import "time"
+
+// GrpcStatusOK is the gRPC status code passed to callbacks when a gRPC call succeeds.
+const GrpcStatusOK uint32 = 0
+
+//export proxy_on_grpc_receive_initial_metadata
+func proxyOnGrpcReceiveInitialMetadata(pluginContextID, calloutID uint32, numHeaders int) {
+	if recordTiming {
+		defer logTiming("proxyOnGrpcReceiveInitialMetadata", time.Now())
+	}
+	root, ok := currentState.pluginContexts[pluginContextID]
+	if !ok {
+		panic("grpc_receive_initial_metadata on invalid plugin context")
+	}
+
+	if stream, ok := root.grpcStreams[calloutID]; ok {
+		if setGrpcCallerContext(stream.callerContextID) {
+			stream.context.OnGrpcStreamInitialMetadata(numHeaders)
+		}
+	}
+	// Initial metadata of unary calls is not exposed to plugins.
+}
+
+//export proxy_on_grpc_receive
+func proxyOnGrpcReceive(pluginContextID, calloutID uint32, responseSize int) {
+	if recordTiming {
+		defer logTiming("proxyOnGrpcReceive", time.Now())
+	}
+	root, ok := currentState.pluginContexts[pluginContextID]
+	if !ok {
+		panic("grpc_receive on invalid plugin context")
+	}
+
+	if cb, ok := root.grpcCallbacks[calloutID]; ok {
+		delete(root.grpcCallbacks, calloutID)
+		if setGrpcCallerContext(cb.callerContextID) {
+			currentState.grpcCallTrailingMetadata = cb.trailingMetadata
+			defer func() { currentState.grpcCallTrailingMetadata = nil }()
+			cb.callback(GrpcStatusOK, responseSize)
+		}
+		return
+	}
+
+	if stream, ok := root.grpcStreams[calloutID]; ok {
+		if setGrpcCallerContext(stream.callerContextID) {
+			stream.context.OnGrpcStreamMessage(responseSize)
+		}
+		return
+	}
+	panic("invalid grpc callout or stream id")
+}
+
+//export proxy_on_grpc_receive_trailing_metadata
+func proxyOnGrpcReceiveTrailingMetadata(pluginContextID, calloutID uint32, numTrailers int) {
+	if recordTiming {
+		defer logTiming("proxyOnGrpcReceiveTrailingMetadata", time.Now())
+	}
+	root, ok := currentState.pluginContexts[pluginContextID]
+	if !ok {
+		panic("grpc_receive_trailing_metadata on invalid plugin context")
+	}
+
+	if stream, ok := root.grpcStreams[calloutID]; ok {
+		if setGrpcCallerContext(stream.callerContextID) {
+			stream.context.OnGrpcStreamTrailingMetadata(numTrailers)
+		}
+		return
+	}
+
+	// The trailing metadata of unary calls is only readable during this callback, which comes before
+	// proxy_on_grpc_receive, so keep it for GetGrpcCallResponseTrailingMetadata in the callback of the call.
+	if cb, ok := root.grpcCallbacks[calloutID]; ok && numTrailers > 0 {
+		var raw *byte
+		var size int
+		if ProxyGetHeaderMapPairs(MapTypeGrpcReceiveTrailingMetadata, &raw, &size) == StatusOK && raw != nil {
+			// Copy the map since the deserialized strings refer to the memory of the host.
+			cb.trailingMetadata = DeserializeMap(append([]byte(nil), RawBytePtrToByteSlice(raw, size)...))
+		}
+	}
+}
+
+//export proxy_on_grpc_close
+func proxyOnGrpcClose(pluginContextID, calloutID uint32, statusCode uint32) {
+	if recordTiming {
+		defer logTiming("proxyOnGrpcClose", time.Now())
+	}
+	root, ok := currentState.pluginContexts[pluginContextID]
+	if !ok {
+		panic("grpc_close on invalid plugin context")
+	}
+
+	if cb, ok := root.grpcCallbacks[calloutID]; ok {
+		delete(root.grpcCallbacks, calloutID)
+		if setGrpcCallerContext(cb.callerContextID) {
+			cb.callback(statusCode, 0)
+		}
+		return
+	}
+
+	if stream, ok := root.grpcStreams[calloutID]; ok {
+		delete(root.grpcStreams, calloutID)
+		if setGrpcCallerContext(stream.callerContextID) {
+			stream.context.OnGrpcStreamClose(statusCode)
+		}
+		return
+	}
+	panic("invalid grpc callout or stream id")
+}
+
+// setGrpcCallerContext sets the context which made the gRPC call or opened the stream as the active one.
+// Same as proxy_on_http_call_response, the caller context might have been deleted before
+// the response arrives. In that case, this returns false and callbacks must not be called.
+func setGrpcCallerContext(ctxID uint32) bool {
+	currentState.setActiveContextID(ctxID)
+	if _, ok := currentState.contextIDToRootID[ctxID]; !ok {
+		return false
+	}
+	ProxySetEffectiveContext(ctxID)
+	return true
+}
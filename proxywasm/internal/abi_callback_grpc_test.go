@@ -0,0 +1,216 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+type grpcCallContext struct {
+	called           bool
+	grpcStatus       uint32
+	responseSize     int
+	trailingMetadata [][2]string
+}
+
+func (ctx *grpcCallContext) onGrpcCallResponse(grpcStatus uint32, responseSize int) {
+	ctx.called = true
+	ctx.grpcStatus = grpcStatus
+	ctx.responseSize = responseSize
+	ctx.trailingMetadata = GetGrpcCallTrailingMetadata()
+}
+
+// grpcTrailingMetadataHost returns the trailing metadata only while delivering it, as the hosts do.
+type grpcTrailingMetadataHost struct {
+	DefaultProxyWAMSHost
+	trailingMetadata []byte
+}
+
+func (h *grpcTrailingMetadataHost) ProxyGetHeaderMapPairs(mapType MapType, returnValueData **byte, returnValueSize *int) Status {
+	if mapType != MapTypeGrpcReceiveTrailingMetadata || h.trailingMetadata == nil {
+		return StatusNotFound
+	}
+	*returnValueData = &h.trailingMetadata[0]
+	*returnValueSize = len(h.trailingMetadata)
+	return StatusOK
+}
+
+func Test_proxyOnGrpcCall(t *testing.T) {
+	release := RegisterMockWasmHost(DefaultProxyWAMSHost{})
+	defer release()
+
+	var (
+		pluginContextID uint32 = 1
+		callerContextID uint32 = 100
+		callOutID       uint32 = 11
+	)
+
+	currentStateMux.Lock()
+	defer currentStateMux.Unlock()
+
+	newState := func(ctx *grpcCallContext) *state {
+		return &state{
+			pluginContexts: map[uint32]*pluginContextState{pluginContextID: {
+				grpcCallbacks: map[uint32]*grpcCallbackAttribute{callOutID: {callback: ctx.onGrpcCallResponse, callerContextID: callerContextID}},
+			}},
+			httpContexts:      map[uint32]types.HttpContext{callerContextID: nil},
+			contextIDToRootID: map[uint32]uint32{callerContextID: pluginContextID},
+		}
+	}
+
+	t.Run("receive", func(t *testing.T) {
+		ctx := &grpcCallContext{}
+		currentState = newState(ctx)
+
+		proxyOnGrpcReceiveInitialMetadata(pluginContextID, callOutID, 1)
+		require.False(t, ctx.called)
+		proxyOnGrpcReceive(pluginContextID, callOutID, 10)
+		_, ok := currentState.pluginContexts[pluginContextID].grpcCallbacks[callOutID]
+		require.False(t, ok)
+		require.True(t, ctx.called)
+		require.Equal(t, GrpcStatusOK, ctx.grpcStatus)
+		require.Equal(t, 10, ctx.responseSize)
+		require.Equal(t, callerContextID, currentState.activeContextID)
+	})
+
+	t.Run("trailing metadata", func(t *testing.T) {
+		ctx := &grpcCallContext{}
+		currentState = newState(ctx)
+		host := &grpcTrailingMetadataHost{trailingMetadata: SerializeMap([][2]string{{"grpc-message", "ok"}})}
+		prev := SwapMockWasmHost(host)
+		defer SwapMockWasmHost(prev)
+
+		proxyOnGrpcReceiveTrailingMetadata(pluginContextID, callOutID, 1)
+		require.False(t, ctx.called)
+		// The memory of the host is reused after the callback.
+		copy(host.trailingMetadata, make([]byte, len(host.trailingMetadata)))
+		host.trailingMetadata = nil
+
+		proxyOnGrpcReceive(pluginContextID, callOutID, 10)
+		require.True(t, ctx.called)
+		require.Equal(t, [][2]string{{"grpc-message", "ok"}}, ctx.trailingMetadata)
+		require.Nil(t, GetGrpcCallTrailingMetadata())
+	})
+
+	t.Run("close", func(t *testing.T) {
+		ctx := &grpcCallContext{}
+		currentState = newState(ctx)
+
+		proxyOnGrpcClose(pluginContextID, callOutID, 14)
+		_, ok := currentState.pluginContexts[pluginContextID].grpcCallbacks[callOutID]
+		require.False(t, ok)
+		require.True(t, ctx.called)
+		require.Equal(t, uint32(14), ctx.grpcStatus)
+		require.Equal(t, 0, ctx.responseSize)
+	})
+
+	t.Run("delete before callback", func(t *testing.T) {
+		ctx := &grpcCallContext{}
+		currentState = newState(ctx)
+
+		proxyOnDelete(callerContextID)
+
+		proxyOnGrpcReceive(pluginContextID, callOutID, 10)
+		_, ok := currentState.pluginContexts[pluginContextID].grpcCallbacks[callOutID]
+		require.False(t, ok)
+		require.False(t, ctx.called)
+	})
+}
+
+type grpcStreamContext struct {
+	types.DefaultGrpcStreamContext
+	initialMetadata, messages, trailingMetadata int
+	closed                                      bool
+	grpcStatus                                  uint32
+}
+
+func (ctx *grpcStreamContext) OnGrpcStreamInitialMetadata(int)  { ctx.initialMetadata++ }
+func (ctx *grpcStreamContext) OnGrpcStreamMessage(int)          { ctx.messages++ }
+func (ctx *grpcStreamContext) OnGrpcStreamTrailingMetadata(int) { ctx.trailingMetadata++ }
+func (ctx *grpcStreamContext) OnGrpcStreamClose(grpcStatus uint32) {
+	ctx.closed = true
+	ctx.grpcStatus = grpcStatus
+}
+
+func Test_proxyOnGrpcStream(t *testing.T) {
+	release := RegisterMockWasmHost(DefaultProxyWAMSHost{})
+	defer release()
+
+	var (
+		pluginContextID uint32 = 1
+		callerContextID uint32 = 100
+		streamID        uint32 = 12
+	)
+
+	currentStateMux.Lock()
+	defer currentStateMux.Unlock()
+
+	newState := func(ctx *grpcStreamContext) *state {
+		return &state{
+			pluginContexts: map[uint32]*pluginContextState{pluginContextID: {
+				grpcStreams: map[uint32]*grpcStreamAttribute{streamID: {context: ctx, callerContextID: callerContextID}},
+			}},
+			httpContexts:      map[uint32]types.HttpContext{callerContextID: nil},
+			contextIDToRootID: map[uint32]uint32{callerContextID: pluginContextID},
+		}
+	}
+
+	t.Run("normal", func(t *testing.T) {
+		ctx := &grpcStreamContext{}
+		currentState = newState(ctx)
+
+		proxyOnGrpcReceiveInitialMetadata(pluginContextID, streamID, 1)
+		proxyOnGrpcReceive(pluginContextID, streamID, 10)
+		proxyOnGrpcReceive(pluginContextID, streamID, 10)
+		proxyOnGrpcReceiveTrailingMetadata(pluginContextID, streamID, 1)
+		require.Equal(t, 1, ctx.initialMetadata)
+		require.Equal(t, 2, ctx.messages)
+		require.Equal(t, 1, ctx.trailingMetadata)
+		require.Equal(t, callerContextID, currentState.activeContextID)
+
+		proxyOnGrpcClose(pluginContextID, streamID, 2)
+		require.True(t, ctx.closed)
+		require.Equal(t, uint32(2), ctx.grpcStatus)
+		_, ok := currentState.pluginContexts[pluginContextID].grpcStreams[streamID]
+		require.False(t, ok)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx := &grpcStreamContext{}
+		currentState = newState(ctx)
+
+		UnregisterGrpcStream(streamID)
+		_, ok := currentState.pluginContexts[pluginContextID].grpcStreams[streamID]
+		require.False(t, ok)
+	})
+
+	t.Run("delete before callback", func(t *testing.T) {
+		ctx := &grpcStreamContext{}
+		currentState = newState(ctx)
+
+		proxyOnDelete(callerContextID)
+
+		proxyOnGrpcReceive(pluginContextID, streamID, 10)
+		proxyOnGrpcClose(pluginContextID, streamID, 0)
+		require.Equal(t, 0, ctx.messages)
+		require.False(t, ctx.closed)
+		_, ok := currentState.pluginContexts[pluginContextID].grpcStreams[streamID]
+		require.False(t, ok)
+	})
+}
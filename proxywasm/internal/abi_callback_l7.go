@@ -21,7 +21,7 @@ import (
 )
 
 //export proxy_on_request_headers
-func proxyOnRequestHeaders(contextID uint32, numHeaders int, endOfStream bool) types.Action {
+func proxyOnRequestHeaders(contextID uint32, numHeaders int, endOfStream bool) (action types.Action) {
 	if recordTiming {
 		defer logTiming("proxyOnRequestHeaders", time.Now())
 	}
@@ -31,11 +31,12 @@ func proxyOnRequestHeaders(contextID uint32, numHeaders int, endOfStream bool) t
 	}
 
 	currentState.setActiveContextID(contextID)
+	defer recoverHttpPanic(contextID, "OnHttpRequestHeaders", &action, false)
 	return ctx.OnHttpRequestHeaders(numHeaders, endOfStream)
 }
 
 //export proxy_on_request_body
-func proxyOnRequestBody(contextID uint32, bodySize int, endOfStream bool) types.Action {
+func proxyOnRequestBody(contextID uint32, bodySize int, endOfStream bool) (action types.Action) {
 	if recordTiming {
 		defer logTiming("proxyOnRequestBody", time.Now())
 	}
@@ -44,11 +45,12 @@ func proxyOnRequestBody(contextID uint32, bodySize int, endOfStream bool) types.
 		panic("invalid context on proxy_on_request_body")
 	}
 	currentState.setActiveContextID(contextID)
-	return ctx.OnHttpRequestBody(bodySize, endOfStream)
+	defer recoverHttpPanic(contextID, "OnHttpRequestBody", &action, false)
+	return stopIterationAction(ctx.OnHttpRequestBody(bodySize, endOfStream))
 }
 
 //export proxy_on_request_trailers
-func proxyOnRequestTrailers(contextID uint32, numTrailers int) types.Action {
+func proxyOnRequestTrailers(contextID uint32, numTrailers int) (action types.Action) {
 	if recordTiming {
 		defer logTiming("proxyOnRequestTrailers", time.Now())
 	}
@@ -57,11 +59,12 @@ func proxyOnRequestTrailers(contextID uint32, numTrailers int) types.Action {
 		panic("invalid context on proxy_on_request_trailers")
 	}
 	currentState.setActiveContextID(contextID)
-	return ctx.OnHttpRequestTrailers(numTrailers)
+	defer recoverHttpPanic(contextID, "OnHttpRequestTrailers", &action, false)
+	return stopIterationAction(ctx.OnHttpRequestTrailers(numTrailers))
 }
 
 //export proxy_on_response_headers
-func proxyOnResponseHeaders(contextID uint32, numHeaders int, endOfStream bool) types.Action {
+func proxyOnResponseHeaders(contextID uint32, numHeaders int, endOfStream bool) (action types.Action) {
 	if recordTiming {
 		defer logTiming("proxyOnResponseHeaders", time.Now())
 	}
@@ -70,11 +73,14 @@ func proxyOnResponseHeaders(contextID uint32, numHeaders int, endOfStream bool)
 		panic("invalid context id on proxy_on_response_headers")
 	}
 	currentState.setActiveContextID(contextID)
+	currentState.inResponseCallback = true
+	defer func() { currentState.inResponseCallback = false }()
+	defer recoverHttpPanic(contextID, "OnHttpResponseHeaders", &action, false)
 	return ctx.OnHttpResponseHeaders(numHeaders, endOfStream)
 }
 
 //export proxy_on_response_body
-func proxyOnResponseBody(contextID uint32, bodySize int, endOfStream bool) types.Action {
+func proxyOnResponseBody(contextID uint32, bodySize int, endOfStream bool) (action types.Action) {
 	if recordTiming {
 		defer logTiming("proxyOnResponseBody", time.Now())
 	}
@@ -83,11 +89,14 @@ func proxyOnResponseBody(contextID uint32, bodySize int, endOfStream bool) types
 		panic("invalid context id on proxy_on_response_headers")
 	}
 	currentState.setActiveContextID(contextID)
-	return ctx.OnHttpResponseBody(bodySize, endOfStream)
+	currentState.inResponseCallback = true
+	defer func() { currentState.inResponseCallback = false }()
+	defer recoverHttpPanic(contextID, "OnHttpResponseBody", &action, true)
+	return stopIterationAction(ctx.OnHttpResponseBody(bodySize, endOfStream))
 }
 
 //export proxy_on_response_trailers
-func proxyOnResponseTrailers(contextID uint32, numTrailers int) types.Action {
+func proxyOnResponseTrailers(contextID uint32, numTrailers int) (action types.Action) {
 	if recordTiming {
 		defer logTiming("proxyOnResponseTrailers", time.Now())
 	}
@@ -96,7 +105,10 @@ func proxyOnResponseTrailers(contextID uint32, numTrailers int) types.Action {
 		panic("invalid context id on proxy_on_response_headers")
 	}
 	currentState.setActiveContextID(contextID)
-	return ctx.OnHttpResponseTrailers(numTrailers)
+	currentState.inResponseCallback = true
+	defer func() { currentState.inResponseCallback = false }()
+	defer recoverHttpPanic(contextID, "OnHttpResponseTrailers", &action, true)
+	return stopIterationAction(ctx.OnHttpResponseTrailers(numTrailers))
 }
 
 //export proxy_on_http_call_response
@@ -126,6 +138,23 @@ func proxyOnHttpCallResponse(pluginContextID, calloutID uint32, numHeaders, body
 	// for already-deleted context id. See https://github.com/tetratelabs/proxy-wasm-go-sdk/issues/261 for detail.
 	if _, ok := currentState.contextIDToRootID[ctxID]; ok {
 		ProxySetEffectiveContext(ctxID)
+		if _, ok := currentState.httpContexts[ctxID]; ok {
+			// The local response can be sent since the stream is still active.
+			var action types.Action
+			defer recoverHttpPanic(ctxID, "http call response callback", &action, cb.dispatchedInResponse)
+		}
 		cb.callback(numHeaders, bodySize, numTrailers)
 	}
 }
+
+// stopIterationAction converts the action returned by the body and trailers callbacks to the one accepted by hosts.
+// The StopAllIteration actions are only defined for headers, and the same values have different meanings for
+// the body (e.g. StopIterationNoBuffer in Envoy), so they are converted to types.ActionPause.
+func stopIterationAction(action types.Action) types.Action {
+	switch action {
+	case types.ActionStopAllIterationAndBuffer, types.ActionStopAllIterationAndWatermark:
+		return types.ActionPause
+	default:
+		return action
+	}
+}
@@ -140,3 +140,16 @@ func Test_proxyOnHttpCallResponse(t *testing.T) {
 	})
 
 }
+
+func Test_stopIterationAction(t *testing.T) {
+	for _, tc := range []struct {
+		action, exp types.Action
+	}{
+		{action: types.ActionContinue, exp: types.ActionContinue},
+		{action: types.ActionPause, exp: types.ActionPause},
+		{action: types.ActionStopAllIterationAndBuffer, exp: types.ActionPause},
+		{action: types.ActionStopAllIterationAndWatermark, exp: types.ActionPause},
+	} {
+		require.Equal(t, tc.exp, stopIterationAction(tc.action))
+	}
+}
@@ -40,10 +40,20 @@ func proxyOnLog(contextID uint32) {
 		ctx.OnStreamDone()
 	} else if ctx, ok := currentState.httpContexts[contextID]; ok {
 		currentState.setActiveContextID(contextID)
+		defer recoverHttpPanic(contextID, "OnHttpStreamDone", nil, false)
 		ctx.OnHttpStreamDone()
 	}
 }
 
+//export proxy_on_log_level_changed
+func proxyOnLogLevelChanged(logLevel LogLevel) {
+	if recordTiming {
+		defer logTiming("proxyOnLogLevelChanged", time.Now())
+	}
+	currentState.logLevel = logLevel
+	currentState.logLevelCached = true
+}
+
 //export proxy_on_done
 func proxyOnDone(contextID uint32) bool {
 	if recordTiming {
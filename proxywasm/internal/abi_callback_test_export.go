@@ -80,6 +80,14 @@ func ProxyOnContextCreate(contextID uint32, pluginContextID uint32) {
 	proxyOnContextCreate(contextID, pluginContextID)
 }
 
+// ProxyOnTcpContextCreate is the same as ProxyOnContextCreate except that only a TCP context is created,
+// so that proxytest can tell the plugin running in a compiled wasm binary which kind of context to create.
+func ProxyOnTcpContextCreate(contextID uint32, pluginContextID uint32) {
+	if !currentState.createTcpContext(contextID, pluginContextID) {
+		panic("invalid context id on proxy_on_context_create")
+	}
+}
+
 func ProxyOnDone(contextID uint32) bool {
 	return proxyOnDone(contextID)
 }
@@ -99,3 +107,27 @@ func ProxyOnTick(pluginContextID uint32) {
 func ProxyOnDelete(contextID uint32) {
 	proxyOnDelete(contextID)
 }
+
+func ProxyOnGrpcReceiveInitialMetadata(pluginContextID, calloutID uint32, numHeaders int) {
+	proxyOnGrpcReceiveInitialMetadata(pluginContextID, calloutID, numHeaders)
+}
+
+func ProxyOnGrpcReceive(pluginContextID, calloutID uint32, responseSize int) {
+	proxyOnGrpcReceive(pluginContextID, calloutID, responseSize)
+}
+
+func ProxyOnGrpcReceiveTrailingMetadata(pluginContextID, calloutID uint32, numTrailers int) {
+	proxyOnGrpcReceiveTrailingMetadata(pluginContextID, calloutID, numTrailers)
+}
+
+func ProxyOnGrpcClose(pluginContextID, calloutID uint32, statusCode uint32) {
+	proxyOnGrpcClose(pluginContextID, calloutID, statusCode)
+}
+
+func ProxyOnForeignFunction(pluginContextID, functionID uint32, argSize int) {
+	proxyOnForeignFunction(pluginContextID, functionID, argSize)
+}
+
+func ProxyOnLogLevelChanged(logLevel LogLevel) {
+	proxyOnLogLevelChanged(logLevel)
+}
@@ -55,12 +55,14 @@ func (l LogLevel) String() string {
 type MapType uint32
 
 const (
-	MapTypeHttpRequestHeaders       MapType = 0
-	MapTypeHttpRequestTrailers      MapType = 1
-	MapTypeHttpResponseHeaders      MapType = 2
-	MapTypeHttpResponseTrailers     MapType = 3
-	MapTypeHttpCallResponseHeaders  MapType = 6
-	MapTypeHttpCallResponseTrailers MapType = 7
+	MapTypeHttpRequestHeaders          MapType = 0
+	MapTypeHttpRequestTrailers         MapType = 1
+	MapTypeHttpResponseHeaders         MapType = 2
+	MapTypeHttpResponseTrailers        MapType = 3
+	MapTypeGrpcReceiveInitialMetadata  MapType = 4
+	MapTypeGrpcReceiveTrailingMetadata MapType = 5
+	MapTypeHttpCallResponseHeaders     MapType = 6
+	MapTypeHttpCallResponseTrailers    MapType = 7
 )
 
 type MetricType uint32
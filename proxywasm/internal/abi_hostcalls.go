@@ -19,6 +19,9 @@ package internal
 //export proxy_log
 func ProxyLog(logLevel LogLevel, messageData *byte, messageSize int) Status
 
+//export proxy_get_log_level
+func ProxyGetLogLevel(returnLogLevel *LogLevel) Status
+
 //export proxy_send_local_response
 func ProxySendLocalResponse(statusCode uint32, statusCodeDetailData *byte, statusCodeDetailsSize int,
 	bodyData *byte, bodySize int, headersData *byte, headersSize int, grpcStatus int32) Status
@@ -76,12 +79,35 @@ func ProxyHttpCall(upstreamData *byte, upstreamSize int, headerData *byte, heade
 	bodyData *byte, bodySize int, trailersData *byte, trailersSize int, timeout uint32, calloutIDPtr *uint32,
 ) Status
 
+//export proxy_grpc_call
+func ProxyGrpcCall(grpcServiceData *byte, grpcServiceSize int, serviceNameData *byte, serviceNameSize int,
+	methodNameData *byte, methodNameSize int, initialMetadataData *byte, initialMetadataSize int,
+	messageData *byte, messageSize int, timeout uint32, calloutIDPtr *uint32,
+) Status
+
+//export proxy_grpc_stream
+func ProxyGrpcStream(grpcServiceData *byte, grpcServiceSize int, serviceNameData *byte, serviceNameSize int,
+	methodNameData *byte, methodNameSize int, initialMetadataData *byte, initialMetadataSize int, streamIDPtr *uint32,
+) Status
+
+//export proxy_grpc_send
+func ProxyGrpcSend(streamID uint32, messageData *byte, messageSize int, endOfStream bool) Status
+
+//export proxy_grpc_cancel
+func ProxyGrpcCancel(calloutID uint32) Status
+
+//export proxy_grpc_close
+func ProxyGrpcClose(calloutID uint32) Status
+
 //export proxy_call_foreign_function
 func ProxyCallForeignFunction(funcNamePtr *byte, funcNameSize int, paramPtr *byte, paramSize int, returnData **byte, returnSize *int) Status
 
 //export proxy_set_tick_period_milliseconds
 func ProxySetTickPeriodMilliseconds(period uint32) Status
 
+//export proxy_get_current_time_nanoseconds
+func ProxyGetCurrentTimeNanoseconds(returnTime *int64) Status
+
 //export proxy_set_effective_context
 func ProxySetEffectiveContext(contextID uint32) Status
 
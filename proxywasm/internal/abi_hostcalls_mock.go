@@ -35,8 +35,17 @@ func RegisterMockWasmHost(host ProxyWasmHost) (release func()) {
 	}
 }
 
+// SwapMockWasmHost replaces the registered host with the given one, and returns the previous one.
+// This must be called while holding the registration by RegisterMockWasmHost.
+func SwapMockWasmHost(host ProxyWasmHost) (prev ProxyWasmHost) {
+	prev = currentHost
+	currentHost = host
+	return
+}
+
 type ProxyWasmHost interface {
 	ProxyLog(logLevel LogLevel, messageData *byte, messageSize int) Status
+	ProxyGetLogLevel(returnLogLevel *LogLevel) Status
 	ProxySetProperty(pathData *byte, pathSize int, valueData *byte, valueSize int) Status
 	ProxyGetProperty(pathData *byte, pathSize int, returnValueData **byte, returnValueSize *int) Status
 	ProxySendLocalResponse(statusCode uint32, statusCodeDetailData *byte, statusCodeDetailsSize int, bodyData *byte, bodySize int, headersData *byte, headersSize int, grpcStatus int32) Status
@@ -57,8 +66,14 @@ type ProxyWasmHost interface {
 	ProxyGetBufferBytes(bufferType BufferType, start int, maxSize int, returnBufferData **byte, returnBufferSize *int) Status
 	ProxySetBufferBytes(bufferType BufferType, start int, maxSize int, bufferData *byte, bufferSize int) Status
 	ProxyHttpCall(upstreamData *byte, upstreamSize int, headerData *byte, headerSize int, bodyData *byte, bodySize int, trailersData *byte, trailersSize int, timeout uint32, calloutIDPtr *uint32) Status
+	ProxyGrpcCall(grpcServiceData *byte, grpcServiceSize int, serviceNameData *byte, serviceNameSize int, methodNameData *byte, methodNameSize int, initialMetadataData *byte, initialMetadataSize int, messageData *byte, messageSize int, timeout uint32, calloutIDPtr *uint32) Status
+	ProxyGrpcStream(grpcServiceData *byte, grpcServiceSize int, serviceNameData *byte, serviceNameSize int, methodNameData *byte, methodNameSize int, initialMetadataData *byte, initialMetadataSize int, streamIDPtr *uint32) Status
+	ProxyGrpcSend(streamID uint32, messageData *byte, messageSize int, endOfStream bool) Status
+	ProxyGrpcCancel(calloutID uint32) Status
+	ProxyGrpcClose(calloutID uint32) Status
 	ProxyCallForeignFunction(funcNamePtr *byte, funcNameSize int, paramPtr *byte, paramSize int, returnData **byte, returnSize *int) Status
 	ProxySetTickPeriodMilliseconds(period uint32) Status
+	ProxyGetCurrentTimeNanoseconds(returnTime *int64) Status
 	ProxySetEffectiveContext(contextID uint32) Status
 	ProxyDone() Status
 	ProxyDefineMetric(metricType MetricType, metricNameData *byte, metricNameSize int, returnMetricIDPtr *uint32) Status
@@ -74,6 +89,7 @@ var _ ProxyWasmHost = DefaultProxyWAMSHost{}
 func (d DefaultProxyWAMSHost) ProxyLog(logLevel LogLevel, messageData *byte, messageSize int) Status {
 	return 0
 }
+func (d DefaultProxyWAMSHost) ProxyGetLogLevel(returnLogLevel *LogLevel) Status { return 0 }
 func (d DefaultProxyWAMSHost) ProxySetProperty(pathData *byte, pathSize int, valueData *byte, valueSize int) Status {
 	return 0
 }
@@ -130,12 +146,28 @@ func (d DefaultProxyWAMSHost) ProxySetBufferBytes(bufferType BufferType, start i
 func (d DefaultProxyWAMSHost) ProxyHttpCall(upstreamData *byte, upstreamSize int, headerData *byte, headerSize int, bodyData *byte, bodySize int, trailersData *byte, trailersSize int, timeout uint32, calloutIDPtr *uint32) Status {
 	return 0
 }
+func (d DefaultProxyWAMSHost) ProxyGrpcCall(grpcServiceData *byte, grpcServiceSize int, serviceNameData *byte, serviceNameSize int, methodNameData *byte, methodNameSize int, initialMetadataData *byte, initialMetadataSize int, messageData *byte, messageSize int, timeout uint32, calloutIDPtr *uint32) Status {
+	return 0
+}
+
+func (d DefaultProxyWAMSHost) ProxyGrpcStream(grpcServiceData *byte, grpcServiceSize int, serviceNameData *byte, serviceNameSize int, methodNameData *byte, methodNameSize int, initialMetadataData *byte, initialMetadataSize int, streamIDPtr *uint32) Status {
+	return 0
+}
+
+func (d DefaultProxyWAMSHost) ProxyGrpcSend(streamID uint32, messageData *byte, messageSize int, endOfStream bool) Status {
+	return 0
+}
+
+func (d DefaultProxyWAMSHost) ProxyGrpcCancel(calloutID uint32) Status { return 0 }
+func (d DefaultProxyWAMSHost) ProxyGrpcClose(calloutID uint32) Status  { return 0 }
+
 func (d DefaultProxyWAMSHost) ProxyCallForeignFunction(funcNamePtr *byte, funcNameSize int, paramPtr *byte, paramSize int, returnData **byte, returnSize *int) Status {
 	return 0
 }
-func (d DefaultProxyWAMSHost) ProxySetTickPeriodMilliseconds(period uint32) Status { return 0 }
-func (d DefaultProxyWAMSHost) ProxySetEffectiveContext(contextID uint32) Status    { return 0 }
-func (d DefaultProxyWAMSHost) ProxyDone() Status                                   { return 0 }
+func (d DefaultProxyWAMSHost) ProxySetTickPeriodMilliseconds(period uint32) Status     { return 0 }
+func (d DefaultProxyWAMSHost) ProxyGetCurrentTimeNanoseconds(returnTime *int64) Status { return 0 }
+func (d DefaultProxyWAMSHost) ProxySetEffectiveContext(contextID uint32) Status        { return 0 }
+func (d DefaultProxyWAMSHost) ProxyDone() Status                                       { return 0 }
 func (d DefaultProxyWAMSHost) ProxyDefineMetric(metricType MetricType, metricNameData *byte, metricNameSize int, returnMetricIDPtr *uint32) Status {
 	return 0
 }
@@ -151,6 +183,10 @@ func ProxyLog(logLevel LogLevel, messageData *byte, messageSize int) Status {
 	return currentHost.ProxyLog(logLevel, messageData, messageSize)
 }
 
+func ProxyGetLogLevel(returnLogLevel *LogLevel) Status {
+	return currentHost.ProxyGetLogLevel(returnLogLevel)
+}
+
 func ProxySetProperty(pathData *byte, pathSize int, valueData *byte, valueSize int) Status {
 	return currentHost.ProxySetProperty(pathData, pathSize, valueData, valueSize)
 }
@@ -234,6 +270,31 @@ func ProxyHttpCall(upstreamData *byte, upstreamSize int, headerData *byte, heade
 		headerData, headerSize, bodyData, bodySize, trailersData, trailersSize, timeout, calloutIDPtr)
 }
 
+func ProxyGrpcCall(grpcServiceData *byte, grpcServiceSize int, serviceNameData *byte, serviceNameSize int,
+	methodNameData *byte, methodNameSize int, initialMetadataData *byte, initialMetadataSize int,
+	messageData *byte, messageSize int, timeout uint32, calloutIDPtr *uint32) Status {
+	return currentHost.ProxyGrpcCall(grpcServiceData, grpcServiceSize, serviceNameData, serviceNameSize,
+		methodNameData, methodNameSize, initialMetadataData, initialMetadataSize, messageData, messageSize, timeout, calloutIDPtr)
+}
+
+func ProxyGrpcStream(grpcServiceData *byte, grpcServiceSize int, serviceNameData *byte, serviceNameSize int,
+	methodNameData *byte, methodNameSize int, initialMetadataData *byte, initialMetadataSize int, streamIDPtr *uint32) Status {
+	return currentHost.ProxyGrpcStream(grpcServiceData, grpcServiceSize, serviceNameData, serviceNameSize,
+		methodNameData, methodNameSize, initialMetadataData, initialMetadataSize, streamIDPtr)
+}
+
+func ProxyGrpcSend(streamID uint32, messageData *byte, messageSize int, endOfStream bool) Status {
+	return currentHost.ProxyGrpcSend(streamID, messageData, messageSize, endOfStream)
+}
+
+func ProxyGrpcCancel(calloutID uint32) Status {
+	return currentHost.ProxyGrpcCancel(calloutID)
+}
+
+func ProxyGrpcClose(calloutID uint32) Status {
+	return currentHost.ProxyGrpcClose(calloutID)
+}
+
 func ProxyCallForeignFunction(funcNamePtr *byte, funcNameSize int, paramPtr *byte, paramSize int, returnData **byte, returnSize *int) Status {
 	return currentHost.ProxyCallForeignFunction(funcNamePtr, funcNameSize, paramPtr, paramSize, returnData, returnSize)
 }
@@ -242,6 +303,10 @@ func ProxySetTickPeriodMilliseconds(period uint32) Status {
 	return currentHost.ProxySetTickPeriodMilliseconds(period)
 }
 
+func ProxyGetCurrentTimeNanoseconds(returnTime *int64) Status {
+	return currentHost.ProxyGetCurrentTimeNanoseconds(returnTime)
+}
+
 func ProxySetEffectiveContext(contextID uint32) Status {
 	return currentHost.ProxySetEffectiveContext(contextID)
 }
@@ -0,0 +1,93 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+// PanicMetricName is the name of the counter incremented on every recovered panic.
+const PanicMetricName = "proxywasm_panics_total"
+
+// PanicHook is called with every recovered panic. This is used by proxytest to surface them to tests.
+type PanicHook func(contextID uint32, callback string, value interface{})
+
+var (
+	// panicPolicy is shared by all the VMs, since it is set once by the plugin like SetVMContext.
+	panicPolicy             types.PanicPolicy
+	internalServerErrorBody = []byte("Internal Server Error")
+)
+
+func SetPanicPolicy(policy types.PanicPolicy) {
+	panicPolicy = policy
+}
+
+// recoverHttpPanic recovers the panic in the callback of the HTTP context, and handles it according to the policy.
+// This must be deferred directly so that recover works. action is overwritten with the action to return to the host,
+// and is nil for the callbacks returning no action, in which case the local response is not sent.
+// responseStarted is true for the callbacks after the response headers have possibly been sent to the downstream,
+// in which case the stream is reset instead of sending the local response.
+func recoverHttpPanic(contextID uint32, callback string, action *types.Action, responseStarted bool) {
+	policy := panicPolicy
+	if policy == types.PanicPolicyNone {
+		return
+	}
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	msg := fmt.Sprintf("panic in %s of context %d: %v\n%s", callback, contextID, r, debug.Stack())
+	ProxyLog(LogLevelCritical, StringBytePtr(msg), len(msg))
+	incrementPanicMetric()
+	if currentState.panicHook != nil {
+		currentState.panicHook(contextID, callback, r)
+	}
+
+	switch policy {
+	case types.PanicPolicyRepanic:
+		panic(r)
+	case types.PanicPolicyFailClosed:
+		if action == nil {
+			return
+		}
+		if responseStarted {
+			ProxyCloseStream(StreamTypeResponse)
+		} else {
+			headers := SerializeMap(nil)
+			ProxySendLocalResponse(500, nil, 0, &internalServerErrorBody[0], len(internalServerErrorBody),
+				&headers[0], len(headers), -1)
+		}
+		*action = types.ActionPause
+	default:
+		if action != nil {
+			*action = types.ActionContinue
+		}
+	}
+}
+
+func incrementPanicMetric() {
+	if !currentState.panicMetricDefined {
+		name := PanicMetricName
+		if ProxyDefineMetric(MetricTypeCounter, StringBytePtr(name), len(name), &currentState.panicMetricID) != StatusOK {
+			return
+		}
+		currentState.panicMetricDefined = true
+	}
+	ProxyIncrementMetric(currentState.panicMetricID, 1)
+}
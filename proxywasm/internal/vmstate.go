@@ -22,11 +22,29 @@ type (
 	pluginContextState struct {
 		context       types.PluginContext
 		httpCallbacks map[uint32]*httpCallbackAttribute
+		grpcCallbacks map[uint32]*grpcCallbackAttribute
+		grpcStreams   map[uint32]*grpcStreamAttribute
 	}
 
 	httpCallbackAttribute struct {
 		callback        func(numHeaders, bodySize, numTrailers int)
 		callerContextID uint32
+		// dispatchedInResponse is true if the call is dispatched by the response callbacks,
+		// after which the response may have been sent to the downstream.
+		dispatchedInResponse bool
+	}
+
+	grpcCallbackAttribute struct {
+		callback        func(grpcStatus uint32, responseSize int)
+		callerContextID uint32
+		// trailingMetadata is captured in proxy_on_grpc_receive_trailing_metadata,
+		// since the host only exposes it during that callback.
+		trailingMetadata [][2]string
+	}
+
+	grpcStreamAttribute struct {
+		context         types.GrpcStreamContext
+		callerContextID uint32
 	}
 )
 
@@ -38,6 +56,20 @@ type state struct {
 
 	contextIDToRootID map[uint32]uint32
 	activeContextID   uint32
+	// inResponseCallback is true while the response callbacks of the HTTP context are running.
+	inResponseCallback bool
+
+	// logLevel is the log level of the host returned by the first proxy_get_log_level,
+	// and updated by proxy_on_log_level_changed. This is valid only if logLevelCached is true.
+	logLevel       LogLevel
+	logLevelCached bool
+
+	// grpcCallTrailingMetadata is the trailing metadata of the gRPC call whose callback is running.
+	grpcCallTrailingMetadata [][2]string
+
+	panicHook          PanicHook
+	panicMetricID      uint32
+	panicMetricDefined bool
 }
 
 var currentState = &state{
@@ -47,6 +79,27 @@ var currentState = &state{
 	contextIDToRootID: make(map[uint32]uint32),
 }
 
+// GetLogLevel returns the log level of the host. This queries the host with proxy_get_log_level only once,
+// and then returns the cached level, which is updated by proxy_on_log_level_changed.
+func GetLogLevel() (LogLevel, error) {
+	if currentState.logLevelCached {
+		return currentState.logLevel, nil
+	}
+	var level LogLevel
+	if err := StatusToError(ProxyGetLogLevel(&level)); err != nil {
+		return 0, err
+	}
+	currentState.logLevel = level
+	currentState.logLevelCached = true
+	return level, nil
+}
+
+// GetGrpcCallTrailingMetadata returns the trailing metadata of the gRPC call whose callback is running,
+// or nil if the host hasn't delivered it.
+func GetGrpcCallTrailingMetadata() [][2]string {
+	return currentState.grpcCallTrailingMetadata
+}
+
 func SetVMContext(vmContext types.VMContext) {
 	currentState.vmContext = vmContext
 }
@@ -55,11 +108,25 @@ func RegisterHttpCallout(calloutID uint32, callback func(numHeaders, bodySize, n
 	currentState.registerHttpCallOut(calloutID, callback)
 }
 
+func RegisterGrpcCallout(calloutID uint32, callback func(grpcStatus uint32, responseSize int)) {
+	currentState.registerGrpcCallOut(calloutID, callback)
+}
+
+func RegisterGrpcStream(streamID uint32, ctx types.GrpcStreamContext) {
+	currentState.registerGrpcStream(streamID, ctx)
+}
+
+func UnregisterGrpcStream(streamID uint32) {
+	currentState.unregisterGrpcStream(streamID)
+}
+
 func (s *state) createPluginContext(contextID uint32) {
 	ctx := s.vmContext.NewPluginContext(contextID)
 	s.pluginContexts[contextID] = &pluginContextState{
 		context:       ctx,
 		httpCallbacks: map[uint32]*httpCallbackAttribute{},
+		grpcCallbacks: map[uint32]*grpcCallbackAttribute{},
+		grpcStreams:   map[uint32]*grpcStreamAttribute{},
 	}
 
 	// NOTE: this is a temporary work around for avoiding nil pointer panic
@@ -111,7 +178,25 @@ func (s *state) createHttpContext(contextID uint32, pluginContextID uint32) bool
 
 func (s *state) registerHttpCallOut(calloutID uint32, callback func(numHeaders, bodySize, numTrailers int)) {
 	r := s.pluginContexts[s.contextIDToRootID[s.activeContextID]]
-	r.httpCallbacks[calloutID] = &httpCallbackAttribute{callback: callback, callerContextID: s.activeContextID}
+	r.httpCallbacks[calloutID] = &httpCallbackAttribute{callback: callback, callerContextID: s.activeContextID,
+		dispatchedInResponse: s.inResponseCallback}
+}
+
+func (s *state) registerGrpcCallOut(calloutID uint32, callback func(grpcStatus uint32, responseSize int)) {
+	r := s.pluginContexts[s.contextIDToRootID[s.activeContextID]]
+	r.grpcCallbacks[calloutID] = &grpcCallbackAttribute{callback: callback, callerContextID: s.activeContextID}
+}
+
+func (s *state) registerGrpcStream(streamID uint32, ctx types.GrpcStreamContext) {
+	r := s.pluginContexts[s.contextIDToRootID[s.activeContextID]]
+	r.grpcStreams[streamID] = &grpcStreamAttribute{context: ctx, callerContextID: s.activeContextID}
+}
+
+func (s *state) unregisterGrpcStream(streamID uint32) {
+	// Streams can be cancelled from any context, so we look up all the plugin contexts.
+	for _, r := range s.pluginContexts {
+		delete(r.grpcStreams, streamID)
+	}
 }
 
 func (s *state) setActiveContextID(contextID uint32) {
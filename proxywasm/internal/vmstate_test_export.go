@@ -19,6 +19,7 @@ package internal
 import "github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
 
 func VMStateReset() {
+	panicPolicy = types.PanicPolicyNone
 	// (@mathetake) I assume that the currentState be protected by lock on hostMux
 	currentState = &state{
 		pluginContexts:    make(map[uint32]*pluginContextState),
@@ -28,6 +29,11 @@ func VMStateReset() {
 	}
 }
 
+// VMStateSetPanicHook sets the function called with every recovered panic in the current VM.
+func VMStateSetPanicHook(hook PanicHook) {
+	currentState.panicHook = hook
+}
+
 func VMStateGetActiveContextID() uint32 {
 	return currentState.activeContextID
 }
@@ -35,3 +41,52 @@ func VMStateGetActiveContextID() uint32 {
 func VMStateSetActiveContextID(contextID uint32) {
 	currentState.activeContextID = contextID
 }
+
+// VMStateGetPluginContextID returns the ID of the plugin context which the given context belongs to.
+// If contextID is a plugin context itself, contextID is returned as-is.
+func VMStateGetPluginContextID(contextID uint32) uint32 {
+	if rootID, ok := currentState.contextIDToRootID[contextID]; ok {
+		return rootID
+	}
+	return contextID
+}
+
+// VMState is an opaque handle of the state of a VM. This is used by proxytest
+// to emulate multiple VMs in a single process by swapping the current state.
+type VMState struct {
+	s *state
+}
+
+// NewVMState returns a new empty VMState.
+func NewVMState() VMState {
+	return VMState{s: &state{
+		pluginContexts:    make(map[uint32]*pluginContextState),
+		httpContexts:      make(map[uint32]types.HttpContext),
+		tcpContexts:       make(map[uint32]types.TcpContext),
+		contextIDToRootID: make(map[uint32]uint32),
+	}}
+}
+
+// VMStateSwap replaces the current state with the given one, and returns the previous one.
+func VMStateSwap(next VMState) (prev VMState) {
+	prev = VMState{s: currentState}
+	currentState = next.s
+	return
+}
+
+// VMStateGetVMContext returns the types.VMContext of the current VM.
+func VMStateGetVMContext() types.VMContext {
+	return currentState.vmContext
+}
+
+// VMStateGetContext returns the plugin, TCP or HTTP context of the given ID, or nil if not found.
+func VMStateGetContext(contextID uint32) interface{} {
+	if ctx, ok := currentState.pluginContexts[contextID]; ok {
+		return ctx.context
+	} else if ctx, ok := currentState.tcpContexts[contextID]; ok {
+		return ctx
+	} else if ctx, ok := currentState.httpContexts[contextID]; ok {
+		return ctx
+	}
+	return nil
+}
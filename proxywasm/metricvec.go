@@ -0,0 +1,185 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxywasm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/internal"
+)
+
+const (
+	// DefaultMaxMetricCardinality is the default maximum number of the label combinations of a metric vector.
+	DefaultMaxMetricCardinality = 100
+	// MetricOverflowLabelValue is the value of all the labels of the metric which counts the label combinations
+	// beyond the maximum cardinality.
+	MetricOverflowLabelValue = "overflow"
+)
+
+// CounterVec is a set of the counters partitioned by the label values. See NewCounterVec.
+type CounterVec struct {
+	vec metricVec
+}
+
+// NewCounterVec returns a CounterVec whose counters are named in the Envoy convention "name.key.value",
+// e.g. NewCounterVec("requests", "method", "status").With("GET", "200") defines the counter
+// "requests.method.GET.status.200". The labels are extracted as the tags of Envoy by stats_tags, e.g.
+//
+//	stats_tags:
+//	  - tag_name: method
+//	    regex: '(\.method\.([^.]+))'
+//
+// The dots in the label values are replaced with underscores so that they don't break the extraction,
+// and the empty values are encoded as "_". Note that this makes some values share the same metric,
+// e.g. "a.b" and "a_b", or "" and "_". The label names must not contain dots, otherwise this panics.
+//
+// The label combinations beyond DefaultMaxMetricCardinality are counted by the counter whose label values are
+// all MetricOverflowLabelValue, so that the values taken from the requests don't exhaust the stats of the host.
+func NewCounterVec(name string, labelNames ...string) *CounterVec {
+	return &CounterVec{vec: newMetricVec(internal.MetricTypeCounter, name, labelNames)}
+}
+
+// WithMaxCardinality returns a new CounterVec which allows up to n label combinations.
+func (v *CounterVec) WithMaxCardinality(n int) *CounterVec {
+	return &CounterVec{vec: v.vec.withMaxCardinality(n)}
+}
+
+// With returns the counter of the label values, which must be given in the order of the label names.
+// The counters are defined on the first use, and cached afterwards.
+func (v *CounterVec) With(labelValues ...string) MetricCounter {
+	return MetricCounter(v.vec.with(labelValues))
+}
+
+// GaugeVec is a set of the gauges partitioned by the label values. See NewCounterVec for the naming.
+type GaugeVec struct {
+	vec metricVec
+}
+
+// NewGaugeVec returns a GaugeVec in the same way as NewCounterVec.
+func NewGaugeVec(name string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{vec: newMetricVec(internal.MetricTypeGauge, name, labelNames)}
+}
+
+// WithMaxCardinality returns a new GaugeVec which allows up to n label combinations.
+func (v *GaugeVec) WithMaxCardinality(n int) *GaugeVec {
+	return &GaugeVec{vec: v.vec.withMaxCardinality(n)}
+}
+
+// With returns the gauge of the label values, which must be given in the order of the label names.
+func (v *GaugeVec) With(labelValues ...string) MetricGauge {
+	return MetricGauge(v.vec.with(labelValues))
+}
+
+// HistogramVec is a set of the histograms partitioned by the label values. See NewCounterVec for the naming.
+type HistogramVec struct {
+	vec metricVec
+}
+
+// NewHistogramVec returns a HistogramVec in the same way as NewCounterVec.
+func NewHistogramVec(name string, labelNames ...string) *HistogramVec {
+	return &HistogramVec{vec: newMetricVec(internal.MetricTypeHistogram, name, labelNames)}
+}
+
+// WithMaxCardinality returns a new HistogramVec which allows up to n label combinations.
+func (v *HistogramVec) WithMaxCardinality(n int) *HistogramVec {
+	return &HistogramVec{vec: v.vec.withMaxCardinality(n)}
+}
+
+// With returns the histogram of the label values, which must be given in the order of the label names.
+func (v *HistogramVec) With(labelValues ...string) MetricHistogram {
+	return MetricHistogram(v.vec.with(labelValues))
+}
+
+type metricVec struct {
+	metricType     internal.MetricType
+	name           string
+	labelNames     []string
+	maxCardinality int
+	// ids is keyed by the full name of the metric. Note that Proxy-Wasm plugins are single threaded.
+	ids        map[string]uint32
+	overflowed bool
+}
+
+func newMetricVec(metricType internal.MetricType, name string, labelNames []string) metricVec {
+	for _, l := range labelNames {
+		if strings.Contains(l, ".") {
+			panic(fmt.Sprintf("metric %s has label name %q containing '.'", name, l))
+		}
+	}
+	return metricVec{
+		metricType:     metricType,
+		name:           name,
+		labelNames:     labelNames,
+		maxCardinality: DefaultMaxMetricCardinality,
+		ids:            map[string]uint32{},
+	}
+}
+
+func (v *metricVec) withMaxCardinality(limit int) metricVec {
+	n := newMetricVec(v.metricType, v.name, v.labelNames)
+	n.maxCardinality = limit
+	return n
+}
+
+func (v *metricVec) with(labelValues []string) uint32 {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metric %s has %d labels but got %d values", v.name, len(v.labelNames), len(labelValues)))
+	}
+	fqn := v.fullName(labelValues)
+	if id, ok := v.ids[fqn]; ok {
+		return id
+	}
+
+	if len(v.ids) >= v.maxCardinality {
+		if !v.overflowed {
+			v.overflowed = true
+			LogWarnf("metric %s exceeded %d label combinations, and the rest are counted as %q",
+				v.name, v.maxCardinality, MetricOverflowLabelValue)
+		}
+		overflow := make([]string, len(labelValues))
+		for i := range overflow {
+			overflow[i] = MetricOverflowLabelValue
+		}
+		fqn = v.fullName(overflow)
+		if id, ok := v.ids[fqn]; ok {
+			return id
+		}
+		// The overflow metric is defined beyond the maximum cardinality, so that it is always available.
+	}
+
+	var id uint32
+	st := internal.ProxyDefineMetric(v.metricType, internal.StringBytePtr(fqn), len(fqn), &id)
+	if err := internal.StatusToError(st); err != nil {
+		panic(fmt.Sprintf("define metric of name %s: %v", fqn, err))
+	}
+	v.ids[fqn] = id
+	return id
+}
+
+func (v *metricVec) fullName(labelValues []string) string {
+	var b strings.Builder
+	b.WriteString(v.name)
+	for i, value := range labelValues {
+		b.WriteByte('.')
+		b.WriteString(v.labelNames[i])
+		b.WriteByte('.')
+		if value == "" {
+			b.WriteByte('_')
+		} else {
+			b.WriteString(strings.ReplaceAll(value, ".", "_"))
+		}
+	}
+	return b.String()
+}
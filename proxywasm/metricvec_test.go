@@ -0,0 +1,68 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxywasm_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/proxytest"
+)
+
+func TestCounterVec(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption())
+	defer reset()
+
+	requests := proxywasm.NewCounterVec("requests", "method", "host").WithMaxCardinality(2)
+	requests.With("GET", "example.com").Increment(1)
+	requests.With("GET", "example.com").Increment(2)
+	requests.With("POST", "").Increment(1)
+	// The combinations beyond the cardinality are counted as the overflow.
+	requests.With("PUT", "a").Increment(1)
+	requests.With("PUT", "b").Increment(1)
+	requests.With("GET", "example.com").Increment(1)
+
+	for name, want := range map[string]uint64{
+		"requests.method.GET.host.example_com":   4,
+		"requests.method.POST.host._":            1,
+		"requests.method.overflow.host.overflow": 2,
+	} {
+		got, err := host.GetCounterMetric(name)
+		require.NoError(t, err, name)
+		require.Equal(t, want, got, name)
+	}
+	_, err := host.GetCounterMetric("requests.method.PUT.host.a")
+	require.Error(t, err)
+	require.Len(t, host.GetWarnLogs(), 1)
+
+	require.Panics(t, func() { requests.With("GET") })
+	require.PanicsWithValue(t, `metric requests has label name "http.method" containing '.'`,
+		func() { proxywasm.NewCounterVec("requests", "http.method") })
+}
+
+func TestGaugeVecAndHistogramVec(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption())
+	defer reset()
+
+	proxywasm.NewGaugeVec("connections", "upstream").With("backend").Add(3)
+	value, err := host.GetGaugeMetric("connections.upstream.backend")
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), value)
+
+	proxywasm.NewHistogramVec("latency", "route").With("api.v1").Record(10)
+	_, err = host.GetHistogramMetric("latency.route.api_v1")
+	require.NoError(t, err)
+}
@@ -0,0 +1,234 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxytest
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/internal"
+)
+
+// ClusterEmulator runs multiple emulated VMs which share the shared data and shared queues
+// in the same way as Envoy worker threads running separate VMs for the same vm_id.
+// This can be used to deterministically test the contention between VMs, e.g.
+// the retry on proxywasm.ErrorStatusCasMismatch or racing consumers of a shared queue.
+// The VMs also share the emulated clock, so HostEmulator.AdvanceTime on any VM executes the ticks of all the VMs.
+type ClusterEmulator interface {
+	// VM switches the current VM to the i-th VM and returns its HostEmulator.
+	// Since only one VM can be current at a time, the returned HostEmulator must not be used
+	// after calling VM with another index. Always call VM(i) to operate on the i-th VM, e.g.
+	// cluster.VM(0).Tick(); cluster.VM(1).Tick().
+	VM(i int) HostEmulator
+	// NumVMs returns the number of VMs in the cluster.
+	NumVMs() int
+}
+
+type (
+	clusterEmulator struct {
+		vms    []*clusterVM
+		active *clusterVM
+	}
+
+	clusterVM struct {
+		host  *hostEmulator
+		state internal.VMState
+	}
+
+	// sharedHostState is the state of the host which is shared among VMs.
+	sharedHostState struct {
+		sharedDataKVS  map[string]*sharedData
+		queues         map[uint32][][]byte
+		queueNameID    map[queueKey]uint32
+		queueConsumers map[uint32][]queueConsumer // key: queueID
+
+		// now is the current time of the emulated clock.
+		now time.Time
+		// vms are the VMs sharing the state in the order of creation.
+		vms []*rootHostEmulator
+
+		// switchVM makes the given VM current, and returns the function to restore the previous one.
+		// This is nil unless the state is shared by a ClusterEmulator.
+		switchVM func(vm *rootHostEmulator) (restore func())
+	}
+
+	queueKey struct {
+		vmID, name string
+	}
+
+	queueConsumer struct {
+		vm              *rootHostEmulator
+		pluginContextID uint32
+	}
+)
+
+// NewClusterEmulator returns a new ClusterEmulator running a VM for each given option.
+// Give WithVMContext a distinct types.VMContext for each option, as the VMs must not share
+// the memory except through the host. The first VM is current when this returns.
+// The emulated clock starts at the time given by EmulatorOption.WithStartTime of the first option.
+func NewClusterEmulator(opts ...*EmulatorOption) (cluster ClusterEmulator, reset func()) {
+	if len(opts) == 0 {
+		panic("at least one EmulatorOption is required")
+	}
+
+	shared := newSharedHostState(opts[0].startTime)
+	c := &clusterEmulator{}
+	shared.switchVM = c.switchVM
+
+	var closeVMs []func()
+	release := internal.RegisterMockWasmHost(nil)
+	for _, opt := range opts {
+		vmContext, closeVM := opt.newVMContext()
+		closeVMs = append(closeVMs, closeVM)
+		vm := &clusterVM{host: newHostEmulator(opt, shared), state: internal.NewVMState()}
+		c.vms = append(c.vms, vm)
+		c.activate(vm)
+		vm.host.initializeVM(vmContext)
+	}
+	c.activate(c.vms[0])
+
+	return c, func() {
+		defer release()
+		defer internal.VMStateReset()
+		for _, closeVM := range closeVMs {
+			closeVM()
+		}
+	}
+}
+
+// impl ClusterEmulator
+func (c *clusterEmulator) VM(i int) HostEmulator {
+	if i < 0 || i >= len(c.vms) {
+		panic(fmt.Sprintf("vm index out of range: %d", i))
+	}
+	vm := c.vms[i]
+	c.activate(vm)
+	return vm.host
+}
+
+// impl ClusterEmulator
+func (c *clusterEmulator) NumVMs() int {
+	return len(c.vms)
+}
+
+func (c *clusterEmulator) activate(vm *clusterVM) {
+	if c.active == vm {
+		return
+	}
+	prev := internal.VMStateSwap(vm.state)
+	if c.active != nil {
+		c.active.state = prev
+	}
+	internal.SwapMockWasmHost(vm.host)
+	c.active = vm
+}
+
+func (c *clusterEmulator) switchVM(r *rootHostEmulator) (restore func()) {
+	prev := c.active
+	for _, vm := range c.vms {
+		if vm.host.rootHostEmulator == r {
+			c.activate(vm)
+			break
+		}
+	}
+	return func() { c.activate(prev) }
+}
+
+// newSharedHostState returns a new sharedHostState whose clock starts at startTime, or now if it is zero.
+func newSharedHostState(startTime time.Time) *sharedHostState {
+	if startTime.IsZero() {
+		startTime = time.Now()
+	}
+	return &sharedHostState{
+		sharedDataKVS:  map[string]*sharedData{},
+		queues:         map[uint32][][]byte{},
+		queueNameID:    map[queueKey]uint32{},
+		queueConsumers: map[uint32][]queueConsumer{},
+		now:            startTime,
+	}
+}
+
+// advanceTime advances the clock by d, and executes the ticks of all the VMs which come due in the meantime
+// in the order of time. The overdue ticks, e.g. left behind by HostEmulator.TickFor, are executed first.
+func (s *sharedHostState) advanceTime(d time.Duration) {
+	target := s.now.Add(d)
+	for {
+		var (
+			vm              *rootHostEmulator
+			pluginContextID uint32
+			at              time.Time
+		)
+		for _, r := range s.vms {
+			if id, next, ok := r.nextTick(); ok && (vm == nil || next.Before(at)) {
+				vm, pluginContextID, at = r, id, next
+			}
+		}
+		if vm == nil || at.After(target) {
+			break
+		}
+		if at.After(s.now) {
+			s.now = at
+		}
+		if s.switchVM != nil {
+			restore := s.switchVM(vm)
+			vm.tick(pluginContextID)
+			restore()
+		} else {
+			vm.tick(pluginContextID)
+		}
+	}
+	s.now = target
+}
+
+// registerQueue registers the given plugin context as the consumer of the queue, and returns the queue ID.
+// As in Envoy, re-registration in the same VM moves the notifications to the latest plugin context.
+func (s *sharedHostState) registerQueue(vm *rootHostEmulator, name string, pluginContextID uint32) uint32 {
+	key := queueKey{vmID: vm.vmID, name: name}
+	id, ok := s.queueNameID[key]
+	if !ok {
+		id = uint32(len(s.queues))
+		s.queues[id] = [][]byte{}
+		s.queueNameID[key] = id
+	}
+
+	consumers := s.queueConsumers[id]
+	for i := range consumers {
+		if consumers[i].vm == vm {
+			consumers[i].pluginContextID = pluginContextID
+			return id
+		}
+	}
+	s.queueConsumers[id] = append(consumers, queueConsumer{vm: vm, pluginContextID: pluginContextID})
+	return id
+}
+
+// notifyQueueReady calls types.PluginContext.OnQueueReady of all the consumers of the queue
+// in the order of registration.
+func (s *sharedHostState) notifyQueueReady(caller *rootHostEmulator, queueID uint32) {
+	for _, consumer := range append([]queueConsumer(nil), s.queueConsumers[queueID]...) {
+		if consumer.vm != caller {
+			restore := s.switchVM(consumer.vm)
+			internal.ProxyOnQueueReady(consumer.pluginContextID, queueID)
+			restore()
+			continue
+		}
+
+		// The notification is delivered synchronously in this emulator, so restore the active context
+		// of the caller, which might be different from the plugin context which owns the queue.
+		activeContextID := internal.VMStateGetActiveContextID()
+		internal.ProxyOnQueueReady(consumer.pluginContextID, queueID)
+		internal.VMStateSetActiveContextID(activeContextID)
+	}
+}
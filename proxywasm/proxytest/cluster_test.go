@@ -0,0 +1,189 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxytest
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+const counterKey = "counter"
+
+// counterPlugin increments the shared counter in two steps across ticks,
+// so that the tests can interleave the read and the write of multiple VMs.
+type counterPlugin struct {
+	types.DefaultVMContext
+}
+
+type counterPluginContext struct {
+	types.DefaultPluginContext
+	pending bool
+	value   uint64
+	cas     uint32
+}
+
+// NewPluginContext implements the same method on types.VMContext.
+func (*counterPlugin) NewPluginContext(uint32) types.PluginContext {
+	return &counterPluginContext{}
+}
+
+// OnTick implements the same method on types.PluginContext.
+func (p *counterPluginContext) OnTick() {
+	if !p.pending {
+		data, cas, err := proxywasm.GetSharedData(counterKey)
+		if err != nil && !errors.Is(err, types.ErrorStatusNotFound) {
+			proxywasm.LogCriticalf("failed to get shared data: %v", err)
+			return
+		}
+		if len(data) == 8 {
+			p.value = binary.LittleEndian.Uint64(data)
+		} else {
+			p.value = 0
+		}
+		p.cas, p.pending = cas, true
+		return
+	}
+
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, p.value+1)
+	p.pending = false
+	if err := proxywasm.SetSharedData(counterKey, buf, p.cas); errors.Is(err, types.ErrorStatusCasMismatch) {
+		proxywasm.LogWarn("cas mismatch")
+	} else if err != nil {
+		proxywasm.LogCriticalf("failed to set shared data: %v", err)
+	} else {
+		proxywasm.LogInfof("counter: %d", p.value+1)
+	}
+}
+
+func TestClusterEmulator_sharedData(t *testing.T) {
+	cluster, reset := NewClusterEmulator(
+		NewEmulatorOption().WithVMContext(&counterPlugin{}),
+		NewEmulatorOption().WithVMContext(&counterPlugin{}),
+	)
+	defer reset()
+	require.Equal(t, 2, cluster.NumVMs())
+
+	// Both VMs read the counter before either of them writes.
+	cluster.VM(0).Tick()
+	cluster.VM(1).Tick()
+	cluster.VM(0).Tick()
+	cluster.VM(1).Tick()
+	require.Equal(t, []string{"counter: 1"}, cluster.VM(0).GetInfoLogs())
+	require.Equal(t, []string{"cas mismatch"}, cluster.VM(1).GetWarnLogs())
+
+	// The retry in VM 1 sees the value written by VM 0.
+	cluster.VM(1).Tick()
+	cluster.VM(1).Tick()
+	require.Equal(t, []string{"counter: 2"}, cluster.VM(1).GetInfoLogs())
+}
+
+// queuePlugin registers the queue "events" on start, and enqueues the data on each tick
+// to the queue resolved with the vm_id given as the plugin configuration.
+type queuePlugin struct {
+	types.DefaultVMContext
+}
+
+type queuePluginContext struct {
+	types.DefaultPluginContext
+}
+
+// NewPluginContext implements the same method on types.VMContext.
+func (*queuePlugin) NewPluginContext(uint32) types.PluginContext {
+	return &queuePluginContext{}
+}
+
+// OnPluginStart implements the same method on types.PluginContext.
+func (*queuePluginContext) OnPluginStart(int) types.OnPluginStartStatus {
+	if _, err := proxywasm.RegisterSharedQueue("events"); err != nil {
+		proxywasm.LogCriticalf("failed to register queue: %v", err)
+		return types.OnPluginStartStatusFailed
+	}
+	return types.OnPluginStartStatusOK
+}
+
+// OnTick implements the same method on types.PluginContext.
+func (*queuePluginContext) OnTick() {
+	vmID, err := proxywasm.GetPluginConfiguration()
+	if err != nil {
+		proxywasm.LogCriticalf("failed to get plugin configuration: %v", err)
+		return
+	}
+	queueID, err := proxywasm.ResolveSharedQueue(string(vmID), "events")
+	if err != nil {
+		proxywasm.LogCriticalf("failed to resolve queue: %v", err)
+		return
+	}
+	if err := proxywasm.EnqueueSharedQueue(queueID, []byte("event")); err != nil {
+		proxywasm.LogCriticalf("failed to enqueue: %v", err)
+	}
+}
+
+// OnQueueReady implements the same method on types.PluginContext.
+func (*queuePluginContext) OnQueueReady(queueID uint32) {
+	data, err := proxywasm.DequeueSharedQueue(queueID)
+	if errors.Is(err, types.ErrorStatusEmpty) {
+		proxywasm.LogInfo("queue already drained")
+		return
+	} else if err != nil {
+		proxywasm.LogCriticalf("failed to dequeue: %v", err)
+		return
+	}
+	proxywasm.LogInfof("dequeued: %s", data)
+}
+
+func TestClusterEmulator_sharedQueue(t *testing.T) {
+	cluster, reset := NewClusterEmulator(
+		NewEmulatorOption().WithVMContext(&queuePlugin{}).WithVMID("consumer").WithPluginConfiguration([]byte("consumer")),
+		NewEmulatorOption().WithVMContext(&queuePlugin{}).WithVMID("consumer").WithPluginConfiguration([]byte("consumer")),
+		NewEmulatorOption().WithVMContext(&queuePlugin{}).WithVMID("producer").WithPluginConfiguration([]byte("consumer")),
+	)
+	defer reset()
+
+	for i := 0; i < cluster.NumVMs(); i++ {
+		require.Equal(t, types.OnPluginStartStatusOK, cluster.VM(i).StartPlugin())
+	}
+
+	// The producer resolves the queue of the other vm_id, and all the consumers
+	// are notified in the order of registration.
+	cluster.VM(2).Tick()
+	require.Equal(t, []string{"dequeued: event"}, cluster.VM(0).GetInfoLogs())
+	require.Equal(t, []string{"queue already drained"}, cluster.VM(1).GetInfoLogs())
+	require.Empty(t, cluster.VM(2).GetInfoLogs())
+	require.Equal(t, 0, cluster.VM(2).GetQueueSize(0))
+}
+
+func TestClusterEmulator_clock(t *testing.T) {
+	cluster, reset := NewClusterEmulator(
+		NewEmulatorOption().WithVMContext(&multiPlugin{}).WithPluginConfiguration([]byte("inbound")),
+		NewEmulatorOption().WithVMContext(&multiPlugin{}).WithPluginConfiguration([]byte("outbound")),
+	)
+	defer reset()
+	require.Equal(t, types.OnPluginStartStatusOK, cluster.VM(0).StartPlugin())
+	require.Equal(t, types.OnPluginStartStatusOK, cluster.VM(1).StartPlugin())
+
+	// Advancing the shared clock executes the ticks of all the VMs.
+	cluster.VM(0).AdvanceTime(200 * time.Millisecond)
+	require.Equal(t, []string{"inbound: tick", "inbound: tick"}, cluster.VM(0).GetInfoLogs())
+	require.Equal(t, []string{"outbound: tick"}, cluster.VM(1).GetInfoLogs())
+	require.Equal(t, cluster.VM(0).GetCurrentTime(), cluster.VM(1).GetCurrentTime())
+}
@@ -0,0 +1,353 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxytest
+
+import (
+	"log"
+	"strings"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/internal"
+)
+
+type (
+	grpcHostEmulator struct {
+		nextCalloutID uint32
+
+		grpcContextIDToCalloutInfos    map[uint32][]GrpcCalloutAttribute // key: contextID
+		grpcCalloutIDToPluginContextID map[uint32]uint32                 // key: calloutID
+
+		grpcContextIDToStreamIDs      map[uint32][]uint32             // key: contextID
+		grpcStreamIDToPluginContextID map[uint32]uint32               // key: streamID
+		grpcStreams                   map[uint32]*GrpcStreamAttribute // key: streamID
+
+		// activeResponse is the response visible to the plugin during the callbacks
+		// for gRPC calls and streams.
+		activeResponse *grpcResponse
+	}
+
+	grpcResponse struct {
+		initialMetadata  [][2]string
+		trailingMetadata [][2]string
+		message          []byte
+	}
+
+	// GrpcCalloutAttribute holds the information of a gRPC call made by proxywasm.DispatchGrpcCall.
+	GrpcCalloutAttribute struct {
+		CalloutID       uint32
+		Upstream        string
+		ServiceName     string
+		Method          string
+		InitialMetadata [][2]string
+		Message         []byte
+	}
+
+	// GrpcStreamAttribute holds the information of a gRPC stream opened by proxywasm.OpenGrpcStream.
+	GrpcStreamAttribute struct {
+		StreamID        uint32
+		Upstream        string
+		ServiceName     string
+		Method          string
+		InitialMetadata [][2]string
+		// SentMessages are the messages sent by the plugin on this stream in order.
+		SentMessages [][]byte
+		// LocalClosed is true if the plugin half-closed the stream by
+		// sending a message with endOfStream or by calling GrpcStream.Close.
+		LocalClosed bool
+		// RemoteClosed is true if CallOnGrpcStreamClose has been called for this stream.
+		RemoteClosed bool
+		// Cancelled is true if the plugin cancelled the stream by calling GrpcStream.Cancel.
+		Cancelled bool
+	}
+)
+
+func newGrpcHostEmulator() *grpcHostEmulator {
+	return &grpcHostEmulator{
+		nextCalloutID:                  1,
+		grpcContextIDToCalloutInfos:    map[uint32][]GrpcCalloutAttribute{},
+		grpcCalloutIDToPluginContextID: map[uint32]uint32{},
+		grpcContextIDToStreamIDs:       map[uint32][]uint32{},
+		grpcStreamIDToPluginContextID:  map[uint32]uint32{},
+		grpcStreams:                    map[uint32]*GrpcStreamAttribute{},
+	}
+}
+
+func (g *grpcHostEmulator) getNextCalloutID() (ret uint32) {
+	ret = g.nextCalloutID
+	g.nextCalloutID++
+	return
+}
+
+// impl internal.ProxyWasmHost
+func (g *grpcHostEmulator) ProxyGrpcCall(grpcServiceData *byte, grpcServiceSize int, serviceNameData *byte, serviceNameSize int,
+	methodNameData *byte, methodNameSize int, initialMetadataData *byte, initialMetadataSize int,
+	messageData *byte, messageSize int, timeout uint32, calloutIDPtr *uint32) internal.Status {
+	upstream := strings.Clone(internal.RawBytePtrToString(grpcServiceData, grpcServiceSize))
+	serviceName := strings.Clone(internal.RawBytePtrToString(serviceNameData, serviceNameSize))
+	method := strings.Clone(internal.RawBytePtrToString(methodNameData, methodNameSize))
+	metadata := deserializeRawBytePtrToMap(initialMetadataData, initialMetadataSize)
+	message := []byte(internal.RawBytePtrToString(messageData, messageSize))
+
+	log.Printf("[grpc callout to %s] timeout: %d", upstream, timeout)
+	log.Printf("[grpc callout to %s] method: %s/%s", upstream, serviceName, method)
+	log.Printf("[grpc callout to %s] initial metadata: %v", upstream, metadata)
+
+	calloutID := g.getNextCalloutID()
+	contextID := internal.VMStateGetActiveContextID()
+	g.grpcCalloutIDToPluginContextID[calloutID] = internal.VMStateGetPluginContextID(contextID)
+	g.grpcContextIDToCalloutInfos[contextID] = append(g.grpcContextIDToCalloutInfos[contextID], GrpcCalloutAttribute{
+		CalloutID:       calloutID,
+		Upstream:        upstream,
+		ServiceName:     serviceName,
+		Method:          method,
+		InitialMetadata: metadata,
+		Message:         message,
+	})
+
+	*calloutIDPtr = calloutID
+	return internal.StatusOK
+}
+
+// impl internal.ProxyWasmHost
+func (g *grpcHostEmulator) ProxyGrpcStream(grpcServiceData *byte, grpcServiceSize int, serviceNameData *byte, serviceNameSize int,
+	methodNameData *byte, methodNameSize int, initialMetadataData *byte, initialMetadataSize int, streamIDPtr *uint32) internal.Status {
+	upstream := strings.Clone(internal.RawBytePtrToString(grpcServiceData, grpcServiceSize))
+	serviceName := strings.Clone(internal.RawBytePtrToString(serviceNameData, serviceNameSize))
+	method := strings.Clone(internal.RawBytePtrToString(methodNameData, methodNameSize))
+	metadata := deserializeRawBytePtrToMap(initialMetadataData, initialMetadataSize)
+
+	log.Printf("[grpc stream to %s] method: %s/%s", upstream, serviceName, method)
+	log.Printf("[grpc stream to %s] initial metadata: %v", upstream, metadata)
+
+	streamID := g.getNextCalloutID()
+	contextID := internal.VMStateGetActiveContextID()
+	g.grpcContextIDToStreamIDs[contextID] = append(g.grpcContextIDToStreamIDs[contextID], streamID)
+	g.grpcStreamIDToPluginContextID[streamID] = internal.VMStateGetPluginContextID(contextID)
+	g.grpcStreams[streamID] = &GrpcStreamAttribute{
+		StreamID:        streamID,
+		Upstream:        upstream,
+		ServiceName:     serviceName,
+		Method:          method,
+		InitialMetadata: metadata,
+	}
+
+	*streamIDPtr = streamID
+	return internal.StatusOK
+}
+
+// impl internal.ProxyWasmHost
+func (g *grpcHostEmulator) ProxyGrpcSend(streamID uint32, messageData *byte, messageSize int, endOfStream bool) internal.Status {
+	stream, ok := g.grpcStreams[streamID]
+	if !ok || stream.Cancelled {
+		log.Printf("grpc stream %d is not found", streamID)
+		return internal.StatusNotFound
+	} else if stream.LocalClosed {
+		log.Printf("grpc stream %d is already closed", streamID)
+		return internal.StatusBadArgument
+	}
+
+	stream.SentMessages = append(stream.SentMessages, []byte(internal.RawBytePtrToString(messageData, messageSize)))
+	stream.LocalClosed = endOfStream
+	return internal.StatusOK
+}
+
+// impl internal.ProxyWasmHost
+func (g *grpcHostEmulator) ProxyGrpcCancel(calloutID uint32) internal.Status {
+	if stream, ok := g.grpcStreams[calloutID]; ok {
+		stream.Cancelled = true
+		return internal.StatusOK
+	} else if _, ok := g.grpcCalloutIDToPluginContextID[calloutID]; ok {
+		delete(g.grpcCalloutIDToPluginContextID, calloutID)
+		return internal.StatusOK
+	}
+	return internal.StatusNotFound
+}
+
+// impl internal.ProxyWasmHost
+func (g *grpcHostEmulator) ProxyGrpcClose(calloutID uint32) internal.Status {
+	if stream, ok := g.grpcStreams[calloutID]; ok {
+		stream.LocalClosed = true
+		return internal.StatusOK
+	} else if _, ok := g.grpcCalloutIDToPluginContextID[calloutID]; ok {
+		delete(g.grpcCalloutIDToPluginContextID, calloutID)
+		return internal.StatusOK
+	}
+	return internal.StatusNotFound
+}
+
+// impl internal.ProxyWasmHost: delegated from hostEmulator
+func (g *grpcHostEmulator) grpcHostEmulatorProxyGetHeaderMapPairs(mapType internal.MapType, returnValueData **byte, returnValueSize *int) internal.Status {
+	res := g.getActiveResponse()
+
+	var raw []byte
+	switch mapType {
+	case internal.MapTypeGrpcReceiveInitialMetadata:
+		raw = internal.SerializeMap(res.initialMetadata)
+	case internal.MapTypeGrpcReceiveTrailingMetadata:
+		raw = internal.SerializeMap(res.trailingMetadata)
+	default:
+		panic("unreachable: maybe a bug in this host emulation or SDK")
+	}
+
+	*returnValueData = &raw[0]
+	*returnValueSize = len(raw)
+	return internal.StatusOK
+}
+
+// impl internal.ProxyWasmHost: delegated from hostEmulator
+func (g *grpcHostEmulator) grpcHostEmulatorProxyGetMapValue(mapType internal.MapType, keyData *byte,
+	keySize int, returnValueData **byte, returnValueSize *int) internal.Status {
+	res := g.getActiveResponse()
+
+	var hs [][2]string
+	switch mapType {
+	case internal.MapTypeGrpcReceiveInitialMetadata:
+		hs = res.initialMetadata
+	case internal.MapTypeGrpcReceiveTrailingMetadata:
+		hs = res.trailingMetadata
+	default:
+		panic("unreachable: maybe a bug in this host emulation or SDK")
+	}
+
+	key := strings.ToLower(internal.RawBytePtrToString(keyData, keySize))
+	for _, h := range hs {
+		if h[0] == key && len(h[1]) > 0 {
+			v := []byte(h[1])
+			*returnValueData = &v[0]
+			*returnValueSize = len(v)
+			return internal.StatusOK
+		}
+	}
+	return internal.StatusNotFound
+}
+
+// impl internal.ProxyWasmHost: delegated from hostEmulator
+func (g *grpcHostEmulator) grpcHostEmulatorProxyGetBufferBytes(start int, maxSize int,
+	returnBufferData **byte, returnBufferSize *int) internal.Status {
+	buf := g.getActiveResponse().message
+	if len(buf) == 0 {
+		return internal.StatusNotFound
+	} else if start >= len(buf) {
+		log.Printf("start index out of range: %d (start) >= %d ", start, len(buf))
+		return internal.StatusBadArgument
+	}
+
+	*returnBufferData = &buf[start]
+	if maxSize > len(buf)-start {
+		*returnBufferSize = len(buf) - start
+	} else {
+		*returnBufferSize = maxSize
+	}
+	return internal.StatusOK
+}
+
+func (g *grpcHostEmulator) getActiveResponse() *grpcResponse {
+	if g.activeResponse == nil {
+		log.Fatalf("grpc response is only available during the callbacks for gRPC calls and streams")
+	}
+	return g.activeResponse
+}
+
+// impl HostEmulator
+func (g *grpcHostEmulator) GetGrpcCalloutAttributesFromContext(contextID uint32) []GrpcCalloutAttribute {
+	return g.grpcContextIDToCalloutInfos[contextID]
+}
+
+// impl HostEmulator
+func (g *grpcHostEmulator) GetGrpcStreamAttributesFromContext(contextID uint32) []GrpcStreamAttribute {
+	ids := g.grpcContextIDToStreamIDs[contextID]
+	ret := make([]GrpcStreamAttribute, 0, len(ids))
+	for _, id := range ids {
+		ret = append(ret, *g.grpcStreams[id])
+	}
+	return ret
+}
+
+// impl HostEmulator
+func (g *grpcHostEmulator) CallOnGrpcCallResponse(calloutID uint32, grpcStatus uint32, trailingMetadata [][2]string, message []byte) {
+	pluginContextID, ok := g.grpcCalloutIDToPluginContextID[calloutID]
+	if !ok {
+		log.Fatalf("invalid grpc callout id: %d", calloutID)
+	}
+
+	defer func() {
+		g.activeResponse = nil
+		delete(g.grpcCalloutIDToPluginContextID, calloutID)
+	}()
+
+	if grpcStatus == internal.GrpcStatusOK {
+		// The trailing metadata is delivered first as on the hosts delivering it. It remains readable from the host
+		// during the callback only so that the plugin running in a compiled wasm binary can be notified of it.
+		g.activeResponse = &grpcResponse{trailingMetadata: cloneWithLowerCaseMapKeys(trailingMetadata), message: message}
+		if trailingMetadata != nil {
+			internal.ProxyOnGrpcReceiveTrailingMetadata(pluginContextID, calloutID, len(trailingMetadata))
+		}
+		internal.ProxyOnGrpcReceive(pluginContextID, calloutID, len(message))
+	} else {
+		internal.ProxyOnGrpcClose(pluginContextID, calloutID, grpcStatus)
+	}
+}
+
+// impl HostEmulator
+func (g *grpcHostEmulator) CallOnGrpcStreamInitialMetadata(streamID uint32, metadata [][2]string) {
+	if !g.isStreamOpen(streamID) {
+		return
+	}
+	g.activeResponse = &grpcResponse{initialMetadata: cloneWithLowerCaseMapKeys(metadata)}
+	defer func() { g.activeResponse = nil }()
+	internal.ProxyOnGrpcReceiveInitialMetadata(g.grpcStreamIDToPluginContextID[streamID], streamID, len(metadata))
+}
+
+// impl HostEmulator
+func (g *grpcHostEmulator) CallOnGrpcStreamMessage(streamID uint32, message []byte) {
+	if !g.isStreamOpen(streamID) {
+		return
+	}
+	g.activeResponse = &grpcResponse{message: message}
+	defer func() { g.activeResponse = nil }()
+	internal.ProxyOnGrpcReceive(g.grpcStreamIDToPluginContextID[streamID], streamID, len(message))
+}
+
+// impl HostEmulator
+func (g *grpcHostEmulator) CallOnGrpcStreamTrailingMetadata(streamID uint32, metadata [][2]string) {
+	if !g.isStreamOpen(streamID) {
+		return
+	}
+	g.activeResponse = &grpcResponse{trailingMetadata: cloneWithLowerCaseMapKeys(metadata)}
+	defer func() { g.activeResponse = nil }()
+	internal.ProxyOnGrpcReceiveTrailingMetadata(g.grpcStreamIDToPluginContextID[streamID], streamID, len(metadata))
+}
+
+// impl HostEmulator
+func (g *grpcHostEmulator) CallOnGrpcStreamClose(streamID uint32, grpcStatus uint32) {
+	if !g.isStreamOpen(streamID) {
+		return
+	}
+	g.grpcStreams[streamID].RemoteClosed = true
+	internal.ProxyOnGrpcClose(g.grpcStreamIDToPluginContextID[streamID], streamID, grpcStatus)
+}
+
+// isStreamOpen returns true if the events can be delivered to the stream.
+// As in Envoy, no events are delivered to the plugin after the stream is cancelled or closed by the remote.
+func (g *grpcHostEmulator) isStreamOpen(streamID uint32) bool {
+	stream, ok := g.grpcStreams[streamID]
+	if !ok {
+		log.Fatalf("invalid grpc stream id: %d", streamID)
+	}
+	if stream.Cancelled || stream.RemoteClosed {
+		log.Printf("grpc stream %d is already closed", streamID)
+		return false
+	}
+	return true
+}
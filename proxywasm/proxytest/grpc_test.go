@@ -0,0 +1,198 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxytest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+type grpcPlugin struct {
+	types.DefaultVMContext
+}
+
+type grpcPluginContext struct {
+	types.DefaultPluginContext
+	stream proxywasm.GrpcStream
+}
+
+type grpcPluginStreamContext struct {
+	types.DefaultGrpcStreamContext
+}
+
+// NewPluginContext implements the same method on types.VMContext.
+func (*grpcPlugin) NewPluginContext(uint32) types.PluginContext {
+	return &grpcPluginContext{}
+}
+
+// OnPluginStart implements the same method on types.PluginContext.
+func (p *grpcPluginContext) OnPluginStart(int) types.OnPluginStartStatus {
+	stream, err := proxywasm.OpenGrpcStream("telemetry", "logs.v1.LogService", "Push",
+		[][2]string{{"X-Tenant", "foo"}}, &grpcPluginStreamContext{})
+	if err != nil {
+		proxywasm.LogCriticalf("failed to open stream: %v", err)
+		return types.OnPluginStartStatusFailed
+	}
+	p.stream = stream
+	return types.OnPluginStartStatusOK
+}
+
+// OnTick implements the same method on types.PluginContext.
+func (p *grpcPluginContext) OnTick() {
+	if err := p.stream.Send([]byte("batch"), false); err != nil {
+		proxywasm.LogErrorf("failed to send: %v", err)
+	}
+
+	_, err := proxywasm.DispatchGrpcCall("authz", "envoy.service.auth.v3.Authorization", "Check",
+		[][2]string{{"X-Request-Id", "1"}}, []byte("request"), 1000, func(grpcStatus uint32, responseSize int) {
+			if grpcStatus != 0 {
+				proxywasm.LogErrorf("grpc call failed: %d", grpcStatus)
+				return
+			}
+			msg, err := proxywasm.GetGrpcCallResponseMessage(0, responseSize)
+			if err != nil {
+				panic(err)
+			}
+			trailers, err := proxywasm.GetGrpcCallResponseTrailingMetadata()
+			if err != nil && !errors.Is(err, types.ErrorStatusNotFound) {
+				panic(err)
+			}
+			proxywasm.LogInfof("grpc call response: %s, trailers: %v", msg, trailers)
+		})
+	if err != nil {
+		proxywasm.LogCriticalf("failed to dispatch grpc call: %v", err)
+	}
+}
+
+// OnGrpcStreamInitialMetadata implements the same method on types.GrpcStreamContext.
+func (*grpcPluginStreamContext) OnGrpcStreamInitialMetadata(int) {
+	md, err := proxywasm.GetGrpcStreamInitialMetadata()
+	if err != nil {
+		panic(err)
+	}
+	proxywasm.LogInfof("initial metadata: %v", md)
+}
+
+// OnGrpcStreamMessage implements the same method on types.GrpcStreamContext.
+func (*grpcPluginStreamContext) OnGrpcStreamMessage(messageSize int) {
+	msg, err := proxywasm.GetGrpcStreamMessage(0, messageSize)
+	if err != nil {
+		panic(err)
+	}
+	proxywasm.LogInfof("message: %s", msg)
+}
+
+// OnGrpcStreamTrailingMetadata implements the same method on types.GrpcStreamContext.
+func (*grpcPluginStreamContext) OnGrpcStreamTrailingMetadata(int) {
+	md, err := proxywasm.GetGrpcStreamTrailingMetadata()
+	if err != nil {
+		panic(err)
+	}
+	proxywasm.LogInfof("trailing metadata: %v", md)
+}
+
+// OnGrpcStreamClose implements the same method on types.GrpcStreamContext.
+func (*grpcPluginStreamContext) OnGrpcStreamClose(grpcStatus uint32) {
+	proxywasm.LogInfof("stream closed: %d", grpcStatus)
+}
+
+func TestGrpcCall(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		host, reset := NewHostEmulator(NewEmulatorOption().WithVMContext(&grpcPlugin{}))
+		defer reset()
+
+		require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+		host.Tick()
+
+		attrs := host.GetGrpcCalloutAttributesFromContext(PluginContextID)
+		require.Equal(t, 1, len(attrs))
+		require.Equal(t, "authz", attrs[0].Upstream)
+		require.Equal(t, "envoy.service.auth.v3.Authorization", attrs[0].ServiceName)
+		require.Equal(t, "Check", attrs[0].Method)
+		require.Equal(t, [][2]string{{"X-Request-Id", "1"}}, attrs[0].InitialMetadata)
+		require.Equal(t, []byte("request"), attrs[0].Message)
+
+		host.CallOnGrpcCallResponse(attrs[0].CalloutID, 0, [][2]string{{"Grpc-Message", "ok"}}, []byte("response"))
+		require.Contains(t, host.GetInfoLogs(), "grpc call response: response, trailers: [[grpc-message ok]]")
+	})
+
+	t.Run("no trailing metadata", func(t *testing.T) {
+		host, reset := NewHostEmulator(NewEmulatorOption().WithVMContext(&grpcPlugin{}))
+		defer reset()
+
+		require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+		host.Tick()
+
+		attrs := host.GetGrpcCalloutAttributesFromContext(PluginContextID)
+		require.Equal(t, 1, len(attrs))
+		host.CallOnGrpcCallResponse(attrs[0].CalloutID, 0, nil, []byte("response"))
+		require.Contains(t, host.GetInfoLogs(), "grpc call response: response, trailers: []")
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		host, reset := NewHostEmulator(NewEmulatorOption().WithVMContext(&grpcPlugin{}))
+		defer reset()
+
+		require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+		host.Tick()
+
+		attrs := host.GetGrpcCalloutAttributesFromContext(PluginContextID)
+		require.Equal(t, 1, len(attrs))
+		host.CallOnGrpcCallResponse(attrs[0].CalloutID, 14, nil, nil)
+		require.Contains(t, host.GetErrorLogs(), "grpc call failed: 14")
+	})
+}
+
+func TestGrpcStream(t *testing.T) {
+	host, reset := NewHostEmulator(NewEmulatorOption().WithVMContext(&grpcPlugin{}))
+	defer reset()
+
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	streams := host.GetGrpcStreamAttributesFromContext(PluginContextID)
+	require.Equal(t, 1, len(streams))
+	stream := streams[0]
+	require.Equal(t, "telemetry", stream.Upstream)
+	require.Equal(t, "logs.v1.LogService", stream.ServiceName)
+	require.Equal(t, "Push", stream.Method)
+	require.Equal(t, [][2]string{{"X-Tenant", "foo"}}, stream.InitialMetadata)
+
+	host.Tick()
+	host.Tick()
+	streams = host.GetGrpcStreamAttributesFromContext(PluginContextID)
+	require.Equal(t, [][]byte{[]byte("batch"), []byte("batch")}, streams[0].SentMessages)
+	require.False(t, streams[0].LocalClosed)
+
+	host.CallOnGrpcStreamInitialMetadata(stream.StreamID, [][2]string{{"Content-Type", "application/grpc"}})
+	host.CallOnGrpcStreamMessage(stream.StreamID, []byte("ack"))
+	host.CallOnGrpcStreamTrailingMetadata(stream.StreamID, [][2]string{{"grpc-status", "0"}})
+	host.CallOnGrpcStreamClose(stream.StreamID, 0)
+
+	logs := host.GetInfoLogs()
+	require.Contains(t, logs, "initial metadata: [[content-type application/grpc]]")
+	require.Contains(t, logs, "message: ack")
+	require.Contains(t, logs, "trailing metadata: [[grpc-status 0]]")
+	require.Contains(t, logs, "stream closed: 0")
+
+	// Events after the remote close are not delivered.
+	host.CallOnGrpcStreamMessage(stream.StreamID, []byte("late"))
+	require.NotContains(t, host.GetInfoLogs(), "message: late")
+	require.True(t, host.GetGrpcStreamAttributesFromContext(PluginContextID)[0].RemoteClosed)
+}
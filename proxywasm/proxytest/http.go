@@ -25,6 +25,8 @@ import (
 type (
 	httpHostEmulator struct {
 		httpStreams map[uint32]*httpStreamState
+		// bufferLimitBytes is the limit of the body buffered by the host. Zero means unlimited.
+		bufferLimitBytes int
 	}
 	httpStreamState struct {
 		requestHeaders, responseHeaders   [][2]string
@@ -39,8 +41,22 @@ type (
 		// content of body is sent to the upstream or downstream.
 		requestBody, responseBody []byte
 
+		// requestHeld and responseHeld keep the body and trailers which the host holds without calling
+		// the plugin while the headers callback stops all the iteration, e.g. by returning
+		// types.ActionStopAllIterationAndBuffer. These are delivered to the plugin when the stream is resumed.
+		requestHeld, responseHeld *heldHttpData
+
 		action            types.Action
 		sentLocalResponse *LocalHttpResponse
+		// reset is true if the plugin has reset the stream.
+		reset bool
+	}
+	heldHttpData struct {
+		action      types.Action
+		body        []byte
+		endOfStream bool
+		trailers    [][2]string
+		hasTrailers bool
 	}
 	LocalHttpResponse struct {
 		StatusCode       uint32
@@ -51,8 +67,8 @@ type (
 	}
 )
 
-func newHttpHostEmulator() *httpHostEmulator {
-	host := &httpHostEmulator{httpStreams: map[uint32]*httpStreamState{}}
+func newHttpHostEmulator(bufferLimitBytes int) *httpHostEmulator {
+	host := &httpHostEmulator{httpStreams: map[uint32]*httpStreamState{}, bufferLimitBytes: bufferLimitBytes}
 	return host
 }
 
@@ -327,13 +343,81 @@ func (h *httpHostEmulator) ProxySetHeaderMapPairs(mapType internal.MapType, mapD
 }
 
 // impl internal.ProxyWasmHost
-func (h *httpHostEmulator) ProxyContinueStream(internal.StreamType) internal.Status {
+func (h *httpHostEmulator) ProxyContinueStream(streamType internal.StreamType) internal.Status {
 	active := internal.VMStateGetActiveContextID()
 	stream := h.httpStreams[active]
 	stream.action = types.ActionContinue
+
+	var held *heldHttpData
+	switch streamType {
+	case internal.StreamTypeRequest:
+		held, stream.requestHeld = stream.requestHeld, nil
+	case internal.StreamTypeResponse:
+		held, stream.responseHeld = stream.responseHeld, nil
+	}
+	if held != nil {
+		h.deliverHeldHttpData(active, streamType, held)
+	}
+	return internal.StatusOK
+}
+
+// impl internal.ProxyWasmHost: delegated from hostEmulator
+func (h *httpHostEmulator) httpHostEmulatorProxyCloseStream() internal.Status {
+	active := internal.VMStateGetActiveContextID()
+	stream, ok := h.httpStreams[active]
+	if !ok {
+		return internal.StatusBadArgument
+	}
+	// Envoy resets the whole stream regardless of the direction, and discards the held data.
+	stream.reset = true
+	stream.requestHeld, stream.responseHeld = nil, nil
 	return internal.StatusOK
 }
 
+// deliverHeldHttpData synchronously calls the plugin with the body and trailers held while the stream was stopped,
+// in the same way as Envoy does on resumption.
+func (h *httpHostEmulator) deliverHeldHttpData(contextID uint32, streamType internal.StreamType, held *heldHttpData) {
+	if len(held.body) > 0 || held.endOfStream {
+		if streamType == internal.StreamTypeRequest {
+			h.CallOnRequestBody(contextID, held.body, held.endOfStream)
+		} else {
+			h.CallOnResponseBody(contextID, held.body, held.endOfStream)
+		}
+	}
+	if held.hasTrailers {
+		if streamType == internal.StreamTypeRequest {
+			h.CallOnRequestTrailers(contextID, held.trailers)
+		} else {
+			h.CallOnResponseTrailers(contextID, held.trailers)
+		}
+	}
+}
+
+// holdBody buffers the body in the host while the stream is stopped. If the buffer exceeds the limit,
+// the stream fails with a local response unless the plugin asked for flow control with
+// types.ActionStopAllIterationAndWatermark.
+func (h *httpHostEmulator) holdBody(stream *httpStreamState, held *heldHttpData, body []byte, endOfStream bool,
+	streamType internal.StreamType) {
+	held.body = append(held.body, body...)
+	held.endOfStream = endOfStream
+	if h.bufferLimitBytes == 0 || len(held.body) <= h.bufferLimitBytes ||
+		held.action != types.ActionStopAllIterationAndBuffer || stream.sentLocalResponse != nil {
+		return
+	}
+
+	if streamType == internal.StreamTypeRequest {
+		stream.sentLocalResponse = &LocalHttpResponse{StatusCode: 413,
+			StatusCodeDetail: "request_payload_too_large", Data: []byte("Payload Too Large"), GRPCStatus: -1}
+	} else {
+		stream.sentLocalResponse = &LocalHttpResponse{StatusCode: 500,
+			StatusCodeDetail: "response_payload_too_large", Data: []byte("Internal Server Error"), GRPCStatus: -1}
+	}
+}
+
+func isStopAllIteration(action types.Action) bool {
+	return action == types.ActionStopAllIterationAndBuffer || action == types.ActionStopAllIterationAndWatermark
+}
+
 // impl internal.ProxyWasmHost
 func (h *httpHostEmulator) ProxySendLocalResponse(statusCode uint32,
 	statusCodeDetailData *byte, statusCodeDetailsSize int, bodyData *byte, bodySize int,
@@ -352,8 +436,13 @@ func (h *httpHostEmulator) ProxySendLocalResponse(statusCode uint32,
 
 // impl HostEmulator
 func (h *httpHostEmulator) InitializeHttpContext() (contextID uint32) {
+	return h.InitializeHttpContextFor(PluginContextID)
+}
+
+// impl HostEmulator
+func (h *httpHostEmulator) InitializeHttpContextFor(pluginContextID uint32) (contextID uint32) {
 	contextID = getNextContextID()
-	internal.ProxyOnContextCreate(contextID, PluginContextID)
+	internal.ProxyOnContextCreate(contextID, pluginContextID)
 	h.httpStreams[contextID] = &httpStreamState{action: types.ActionContinue}
 	return
 }
@@ -368,6 +457,9 @@ func (h *httpHostEmulator) CallOnRequestHeaders(contextID uint32, headers [][2]s
 	cs.requestHeaders = cloneWithLowerCaseMapKeys(headers)
 	cs.action = internal.ProxyOnRequestHeaders(contextID,
 		len(headers), endOfStream)
+	if isStopAllIteration(cs.action) {
+		cs.requestHeld = &heldHttpData{action: cs.action}
+	}
 	return cs.action
 }
 
@@ -380,6 +472,9 @@ func (h *httpHostEmulator) CallOnResponseHeaders(contextID uint32, headers [][2]
 
 	cs.responseHeaders = cloneWithLowerCaseMapKeys(headers)
 	cs.action = internal.ProxyOnResponseHeaders(contextID, len(headers), endOfStream)
+	if isStopAllIteration(cs.action) {
+		cs.responseHeld = &heldHttpData{action: cs.action}
+	}
 	return cs.action
 }
 
@@ -390,6 +485,11 @@ func (h *httpHostEmulator) CallOnRequestTrailers(contextID uint32, trailers [][2
 		log.Fatalf("invalid context id: %d", contextID)
 	}
 
+	if held := cs.requestHeld; held != nil {
+		held.trailers, held.hasTrailers = cloneWithLowerCaseMapKeys(trailers), true
+		return cs.action
+	}
+
 	cs.requestTrailers = cloneWithLowerCaseMapKeys(trailers)
 	cs.action = internal.ProxyOnRequestTrailers(contextID, len(trailers))
 	return cs.action
@@ -402,6 +502,11 @@ func (h *httpHostEmulator) CallOnResponseTrailers(contextID uint32, trailers [][
 		log.Fatalf("invalid context id: %d", contextID)
 	}
 
+	if held := cs.responseHeld; held != nil {
+		held.trailers, held.hasTrailers = cloneWithLowerCaseMapKeys(trailers), true
+		return cs.action
+	}
+
 	cs.responseTrailers = cloneWithLowerCaseMapKeys(trailers)
 	cs.action = internal.ProxyOnResponseTrailers(contextID, len(trailers))
 	return cs.action
@@ -414,10 +519,15 @@ func (h *httpHostEmulator) CallOnRequestBody(contextID uint32, body []byte, endO
 		log.Fatalf("invalid context id: %d", contextID)
 	}
 
+	if held := cs.requestHeld; held != nil {
+		h.holdBody(cs, held, body, endOfStream, internal.StreamTypeRequest)
+		return cs.action
+	}
+
 	cs.requestBody = append(cs.requestBodyBuffer, body...)
 	cs.action = internal.ProxyOnRequestBody(contextID,
 		len(cs.requestBody), endOfStream)
-	if cs.action == types.ActionPause {
+	if cs.action != types.ActionContinue {
 		// Buffering requested
 		cs.requestBodyBuffer = cs.requestBody
 	} else {
@@ -433,10 +543,15 @@ func (h *httpHostEmulator) CallOnResponseBody(contextID uint32, body []byte, end
 		log.Fatalf("invalid context id: %d", contextID)
 	}
 
+	if held := cs.responseHeld; held != nil {
+		h.holdBody(cs, held, body, endOfStream, internal.StreamTypeResponse)
+		return cs.action
+	}
+
 	cs.responseBody = append(cs.responseBodyBuffer, body...)
 	cs.action = internal.ProxyOnResponseBody(contextID,
 		len(cs.responseBody), endOfStream)
-	if cs.action == types.ActionPause {
+	if cs.action != types.ActionContinue {
 		// Buffering requested
 		cs.responseBodyBuffer = cs.responseBody
 	} else {
@@ -448,7 +563,7 @@ func (h *httpHostEmulator) CallOnResponseBody(contextID uint32, body []byte, end
 // impl HostEmulator
 func (h *httpHostEmulator) CompleteHttpContext(contextID uint32) {
 	internal.ProxyOnLog(contextID)
-	internal.ProxyOnDelete(contextID)
+	deleteContext(contextID)
 }
 
 // impl HostEmulator
@@ -501,6 +616,11 @@ func (h *httpHostEmulator) GetSentLocalResponse(contextID uint32) *LocalHttpResp
 	return h.httpStreams[contextID].sentLocalResponse
 }
 
+// impl HostEmulator
+func (h *httpHostEmulator) IsHttpStreamReset(contextID uint32) bool {
+	return h.httpStreams[contextID].reset
+}
+
 // impl HostEmulator
 func (h *httpHostEmulator) GetProperty(path []string) ([]byte, error) {
 	if len(path) == 0 {
@@ -124,6 +124,121 @@ func TestBodyBuffering(t *testing.T) {
 	}
 }
 
+// stopAllPlugin stops all the iteration on the request headers until the response of the HTTP call arrives.
+type stopAllPlugin struct {
+	types.DefaultVMContext
+	action types.Action
+}
+
+type stopAllPluginContext struct {
+	types.DefaultPluginContext
+	action types.Action
+}
+
+type stopAllHttpContext struct {
+	types.DefaultHttpContext
+	action types.Action
+}
+
+// NewPluginContext implements the same method on types.VMContext.
+func (p *stopAllPlugin) NewPluginContext(uint32) types.PluginContext {
+	return &stopAllPluginContext{action: p.action}
+}
+
+// NewHttpContext implements the same method on types.PluginContext.
+func (p *stopAllPluginContext) NewHttpContext(uint32) types.HttpContext {
+	return &stopAllHttpContext{action: p.action}
+}
+
+// OnHttpRequestHeaders implements the same method on types.HttpContext.
+func (h *stopAllHttpContext) OnHttpRequestHeaders(int, bool) types.Action {
+	if _, err := proxywasm.DispatchHttpCall("verifier", [][2]string{{":path", "/"}}, nil, nil, 1000,
+		func(int, int, int) {
+			if err := proxywasm.ResumeHttpRequest(); err != nil {
+				panic(err)
+			}
+		}); err != nil {
+		panic(err)
+	}
+	return h.action
+}
+
+// OnHttpRequestBody implements the same method on types.HttpContext.
+func (h *stopAllHttpContext) OnHttpRequestBody(bodySize int, endOfStream bool) types.Action {
+	body, err := proxywasm.GetHttpRequestBody(0, bodySize)
+	if err != nil {
+		panic(err)
+	}
+	proxywasm.LogInfof("request body:%s end_of_stream:%t", body, endOfStream)
+	return types.ActionContinue
+}
+
+// OnHttpRequestTrailers implements the same method on types.HttpContext.
+func (h *stopAllHttpContext) OnHttpRequestTrailers(numTrailers int) types.Action {
+	proxywasm.LogInfof("request trailers:%d", numTrailers)
+	return types.ActionContinue
+}
+
+func TestStopAllIteration(t *testing.T) {
+	t.Run("held until resumed", func(t *testing.T) {
+		host, reset := NewHostEmulator(NewEmulatorOption().
+			WithVMContext(&stopAllPlugin{action: types.ActionStopAllIterationAndBuffer}))
+		defer reset()
+
+		id := host.InitializeHttpContext()
+		require.Equal(t, types.ActionStopAllIterationAndBuffer, host.CallOnRequestHeaders(id, nil, false))
+
+		// The body and trailers are held by the host without calling the plugin.
+		require.Equal(t, types.ActionStopAllIterationAndBuffer, host.CallOnRequestBody(id, []byte("11111"), false))
+		require.Equal(t, types.ActionStopAllIterationAndBuffer, host.CallOnRequestBody(id, []byte("22222"), false))
+		require.Equal(t, types.ActionStopAllIterationAndBuffer, host.CallOnRequestTrailers(id, [][2]string{{"key", "value"}}))
+		require.Empty(t, host.GetInfoLogs())
+
+		// Resuming delivers the held data at once.
+		callouts := host.GetCalloutAttributesFromContext(id)
+		require.Len(t, callouts, 1)
+		host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "200"}}, nil, nil)
+		require.Equal(t, []string{
+			"request body:1111122222 end_of_stream:false",
+			"request trailers:1",
+		}, host.GetInfoLogs())
+		require.Equal(t, types.ActionContinue, host.GetCurrentHttpStreamAction(id))
+
+		// The subsequent data is delivered as usual.
+		require.Equal(t, types.ActionContinue, host.CallOnRequestBody(id, []byte("33333"), true))
+	})
+
+	for _, tc := range []struct {
+		action   types.Action
+		rejected bool
+	}{
+		{action: types.ActionStopAllIterationAndBuffer, rejected: true},
+		{action: types.ActionStopAllIterationAndWatermark, rejected: false},
+	} {
+		tc := tc
+		t.Run(fmt.Sprintf("buffer limit with action %d", tc.action), func(t *testing.T) {
+			host, reset := NewHostEmulator(NewEmulatorOption().
+				WithVMContext(&stopAllPlugin{action: tc.action}).
+				WithBufferLimitBytes(8))
+			defer reset()
+
+			id := host.InitializeHttpContext()
+			require.Equal(t, tc.action, host.CallOnRequestHeaders(id, nil, false))
+			host.CallOnRequestBody(id, []byte("11111"), false)
+			require.Nil(t, host.GetSentLocalResponse(id))
+			host.CallOnRequestBody(id, []byte("22222"), true)
+
+			res := host.GetSentLocalResponse(id)
+			if tc.rejected {
+				require.NotNil(t, res)
+				require.Equal(t, uint32(413), res.StatusCode)
+			} else {
+				require.Nil(t, res)
+			}
+		})
+	}
+}
+
 func TestProperties(t *testing.T) {
 	t.Run("Set and get properties", func(t *testing.T) {
 		host, reset := NewHostEmulator(NewEmulatorOption().WithVMContext(&testPlugin{}))
@@ -150,3 +265,110 @@ func TestProperties(t *testing.T) {
 		require.Equal(t, err, internal.StatusToError(internal.StatusNotFound))
 	})
 }
+
+type panicPlugin struct {
+	types.DefaultVMContext
+}
+
+type panicPluginContext struct {
+	types.DefaultPluginContext
+}
+
+type panicHttpContext struct {
+	types.DefaultHttpContext
+}
+
+// NewPluginContext implements the same method on types.VMContext.
+func (*panicPlugin) NewPluginContext(uint32) types.PluginContext {
+	return &panicPluginContext{}
+}
+
+// NewHttpContext implements the same method on types.PluginContext.
+func (*panicPluginContext) NewHttpContext(uint32) types.HttpContext {
+	return &panicHttpContext{}
+}
+
+// OnHttpRequestHeaders implements the same method on types.HttpContext.
+func (*panicHttpContext) OnHttpRequestHeaders(int, bool) types.Action {
+	panic("boom")
+}
+
+// OnHttpResponseHeaders implements the same method on types.HttpContext.
+func (*panicHttpContext) OnHttpResponseHeaders(int, bool) types.Action {
+	if _, err := proxywasm.DispatchHttpCall("cluster", [][2]string{{":method", "GET"}}, nil, nil, 1000,
+		func(int, int, int) { panic("boom") }); err != nil {
+		panic(err)
+	}
+	return types.ActionPause
+}
+
+// OnHttpResponseBody implements the same method on types.HttpContext.
+func (*panicHttpContext) OnHttpResponseBody(int, bool) types.Action {
+	panic("boom")
+}
+
+func TestPanicPolicy(t *testing.T) {
+	newHost := func(t *testing.T, policy types.PanicPolicy) (HostEmulator, uint32) {
+		proxywasm.SetPanicPolicy(policy)
+		host, reset := NewHostEmulator(NewEmulatorOption().WithVMContext(&panicPlugin{}))
+		t.Cleanup(reset)
+		return host, host.InitializeHttpContext()
+	}
+
+	t.Run("fail open", func(t *testing.T) {
+		host, id := newHost(t, types.PanicPolicyFailOpen)
+		require.Equal(t, types.ActionContinue, host.CallOnRequestHeaders(id, nil, false))
+		require.Nil(t, host.GetSentLocalResponse(id))
+
+		require.Equal(t, []RecoveredPanic{{ContextID: id, Callback: "OnHttpRequestHeaders", Value: "boom"}},
+			host.GetRecoveredPanics())
+		logs := host.GetCriticalLogs()
+		require.Len(t, logs, 1)
+		require.Contains(t, logs[0], fmt.Sprintf("panic in OnHttpRequestHeaders of context %d: boom\n", id))
+		count, err := host.GetCounterMetric(proxywasm.PanicMetricName)
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), count)
+	})
+
+	t.Run("fail closed", func(t *testing.T) {
+		host, id := newHost(t, types.PanicPolicyFailClosed)
+		require.Equal(t, types.ActionPause, host.CallOnRequestHeaders(id, nil, false))
+		resp := host.GetSentLocalResponse(id)
+		require.NotNil(t, resp)
+		require.Equal(t, uint32(500), resp.StatusCode)
+		require.Len(t, host.GetRecoveredPanics(), 1)
+	})
+
+	t.Run("fail closed in response", func(t *testing.T) {
+		host, id := newHost(t, types.PanicPolicyFailClosed)
+		require.Equal(t, types.ActionPause, host.CallOnResponseBody(id, []byte("body"), false))
+		require.Nil(t, host.GetSentLocalResponse(id))
+		require.True(t, host.IsHttpStreamReset(id))
+		require.Len(t, host.GetRecoveredPanics(), 1)
+	})
+
+	t.Run("fail closed in http call dispatched in response", func(t *testing.T) {
+		host, id := newHost(t, types.PanicPolicyFailClosed)
+		require.Equal(t, types.ActionPause, host.CallOnResponseHeaders(id, nil, false))
+		callouts := host.GetCalloutAttributesFromContext(id)
+		require.Len(t, callouts, 1)
+		host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "200"}}, nil, nil)
+		require.Nil(t, host.GetSentLocalResponse(id))
+		require.True(t, host.IsHttpStreamReset(id))
+		require.Equal(t, []RecoveredPanic{{ContextID: id, Callback: "http call response callback", Value: "boom"}},
+			host.GetRecoveredPanics())
+	})
+
+	t.Run("repanic", func(t *testing.T) {
+		host, id := newHost(t, types.PanicPolicyRepanic)
+		require.PanicsWithValue(t, "boom", func() { host.CallOnRequestHeaders(id, nil, false) })
+		require.Len(t, host.GetRecoveredPanics(), 1)
+		require.Len(t, host.GetCriticalLogs(), 1)
+	})
+
+	t.Run("none", func(t *testing.T) {
+		host, id := newHost(t, types.PanicPolicyNone)
+		require.PanicsWithValue(t, "boom", func() { host.CallOnRequestHeaders(id, nil, false) })
+		require.Empty(t, host.GetRecoveredPanics())
+	})
+}
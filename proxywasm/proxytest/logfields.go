@@ -0,0 +1,106 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxytest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseLogFields parses a structured log line encoded as a JSON object or logfmt into the fields keyed by their names.
+// Every logfmt pair must have a value, which is either bare or quoted with the Go syntax.
+// The values are returned as strings, e.g. "403" for the number 403 and "true" for the boolean true,
+// so that the fields of both encodings can be asserted in the same way.
+func ParseLogFields(line string) (map[string]string, error) {
+	if strings.HasPrefix(strings.TrimSpace(line), "{") {
+		return parseJSONLogFields(line)
+	}
+	return parseLogfmtFields(line)
+}
+
+func parseJSONLogFields(line string) (map[string]string, error) {
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("invalid json log: %w", err)
+	}
+	fields := make(map[string]string, len(obj))
+	for k, v := range obj {
+		switch v := v.(type) {
+		case string:
+			fields[k] = v
+		case nil:
+			fields[k] = "null"
+		case json.Number, bool:
+			fields[k] = fmt.Sprint(v)
+		default:
+			raw, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			fields[k] = string(raw)
+		}
+	}
+	return fields, nil
+}
+
+func parseLogfmtFields(line string) (map[string]string, error) {
+	fields := map[string]string{}
+	for s := strings.TrimSpace(line); s != ""; s = strings.TrimLeft(s, " ") {
+		end := strings.IndexAny(s, "= ")
+		if end <= 0 || s[end] != '=' {
+			return nil, fmt.Errorf("invalid logfmt log: expected key=value at %q", s)
+		}
+
+		key, rest := s[:end], s[end+1:]
+		if strings.HasPrefix(rest, `"`) {
+			quoted, err := strconv.QuotedPrefix(rest)
+			if err != nil {
+				return nil, fmt.Errorf("invalid logfmt log: value of %q: %w", key, err)
+			}
+			value, err := strconv.Unquote(quoted)
+			if err != nil {
+				return nil, fmt.Errorf("invalid logfmt log: value of %q: %w", key, err)
+			}
+			fields[key] = value
+			s = rest[len(quoted):]
+			if s != "" && s[0] != ' ' {
+				return nil, errors.New("invalid logfmt log: missing space after quoted value")
+			}
+			continue
+		}
+		if i := strings.IndexByte(rest, ' '); i >= 0 {
+			fields[key], s = rest[:i], rest[i:]
+		} else {
+			fields[key], s = rest, ""
+		}
+	}
+	return fields, nil
+}
+
+// parseLogs parses the structured logs, and skips the lines which cannot be parsed.
+func parseLogs(lines []string) []map[string]string {
+	var ret []map[string]string
+	for _, line := range lines {
+		if fields, err := ParseLogFields(line); err == nil {
+			ret = append(ret, fields)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,45 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxytest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLogFields(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		exp  map[string]string
+	}{
+		{line: `msg=hello`, exp: map[string]string{"msg": "hello"}},
+		{line: `msg="a \"b\" c"  n=1 ok=true`, exp: map[string]string{"msg": `a "b" c`, "n": "1", "ok": "true"}},
+		{line: `{"msg":"hello","n":1.5,"ok":true,"nested":{"a":1}}`,
+			exp: map[string]string{"msg": "hello", "n": "1.5", "ok": "true", "nested": `{"a":1}`}},
+	} {
+		t.Run(tc.line, func(t *testing.T) {
+			actual, err := ParseLogFields(tc.line)
+			require.NoError(t, err)
+			require.Equal(t, tc.exp, actual)
+		})
+	}
+
+	for _, line := range []string{`hello world`, `=1`, `msg="unterminated`, `msg="a"b`, `{"msg":`} {
+		t.Run(line, func(t *testing.T) {
+			_, err := ParseLogFields(line)
+			require.Error(t, err)
+		})
+	}
+}
@@ -114,8 +114,13 @@ func (n *networkHostEmulator) CallOnDownstreamData(contextID uint32, data []byte
 
 // impl HostEmulator
 func (n *networkHostEmulator) InitializeConnection() (contextID uint32, action types.Action) {
+	return n.InitializeConnectionFor(PluginContextID)
+}
+
+// impl HostEmulator
+func (n *networkHostEmulator) InitializeConnectionFor(pluginContextID uint32) (contextID uint32, action types.Action) {
 	contextID = getNextContextID()
-	internal.ProxyOnContextCreate(contextID, PluginContextID)
+	internal.ProxyOnTcpContextCreate(contextID, pluginContextID)
 	action = internal.ProxyOnNewConnection(contextID)
 	n.streamStates[contextID] = &streamState{}
 	return
@@ -134,6 +139,6 @@ func (n *networkHostEmulator) CloseDownstreamConnection(contextID uint32) {
 // impl HostEmulator
 func (n *networkHostEmulator) CompleteConnection(contextID uint32) {
 	internal.ProxyOnLog(contextID)
-	internal.ProxyOnDelete(contextID)
+	deleteContext(contextID)
 	delete(n.streamStates, contextID)
 }
@@ -15,16 +15,37 @@
 package proxytest
 
 import (
+	"fmt"
+	"os"
+	"time"
+
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/internal"
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
 )
 
+// WasmBinaryEnv is the environment variable to specify the path to the compiled wasm binary
+// which is used in place of the types.VMContext given by EmulatorOption.WithVMContext
+// when the option is created with EmulatorOption.WithWasmBinaryFromEnv.
+// This allows running the same tests both natively and as compiled wasm, e.g.
+//
+//	tinygo build -o main.wasm -scheduler=none -target=wasi ./main.go
+//	PROXYTEST_WASM_BINARY=main.wasm go test ./...
+//
+// EmulatorOption.WithWasmBinary takes precedence over this.
+const WasmBinaryEnv = "PROXYTEST_WASM_BINARY"
+
 // EmulatorOption is an option that can be passed to NewHostEmulator.
 type EmulatorOption struct {
-	pluginConfiguration []byte
-	vmConfiguration     []byte
-	vmContext           types.VMContext
-	properties          map[string][]byte
+	vmID                 string
+	pluginConfigurations [][]byte
+	vmConfiguration      []byte
+	vmContext            types.VMContext
+	wasmBinaryPath       string
+	wasmBinaryFromEnv    bool
+	bufferLimitBytes     int
+	startTime            time.Time
+	logLevel             types.LogLevel
+	properties           map[string][]byte
 }
 
 // NewEmulatorOption creates a new EmulatorOption.
@@ -38,9 +59,56 @@ func (o *EmulatorOption) WithVMContext(context types.VMContext) *EmulatorOption
 	return o
 }
 
+// WithWasmBinary sets the path to the compiled wasm binary. If set, the plugin is executed
+// within the binary via NewWasmVMContext instead of the types.VMContext given by WithVMContext,
+// and the binary is closed by the reset function returned by NewHostEmulator.
+func (o *EmulatorOption) WithWasmBinary(path string) *EmulatorOption {
+	o.wasmBinaryPath = path
+	return o
+}
+
+// WithWasmBinaryFromEnv makes the emulator read the path to the compiled wasm binary from WasmBinaryEnv,
+// as if given by WithWasmBinary. If the variable is not set, the types.VMContext given by WithVMContext is used.
+func (o *EmulatorOption) WithWasmBinaryFromEnv() *EmulatorOption {
+	o.wasmBinaryFromEnv = true
+	return o
+}
+
+// WithBufferLimitBytes sets the limit of the HTTP body buffered by the host while the stream is stopped by
+// types.ActionStopAllIterationAndBuffer, like per_connection_buffer_limit_bytes in Envoy. When the limit is exceeded,
+// the host sends the local response 413 for the request or 500 for the response. Zero, the default, means unlimited.
+func (o *EmulatorOption) WithBufferLimitBytes(limit int) *EmulatorOption {
+	o.bufferLimitBytes = limit
+	return o
+}
+
+// WithStartTime sets the time at which the emulated clock starts, e.g. to test the expiry of a fixed token.
+// Defaults to the time when the emulator is created.
+func (o *EmulatorOption) WithStartTime(t time.Time) *EmulatorOption {
+	o.startTime = t
+	return o
+}
+
+// WithLogLevel sets the initial log level of the host, which is returned by proxywasm.GetLogLevel.
+// Unlike HostEmulator.SetLogLevel, the plugin is not notified, as with the hosts which don't notify the changes.
+// Defaults to types.LogLevelTrace.
+func (o *EmulatorOption) WithLogLevel(level types.LogLevel) *EmulatorOption {
+	o.logLevel = level
+	return o
+}
+
 // WithPluginConfiguration sets the plugin configuration.
 func (o *EmulatorOption) WithPluginConfiguration(data []byte) *EmulatorOption {
-	o.pluginConfiguration = data
+	o.pluginConfigurations = [][]byte{data}
+	return o
+}
+
+// WithPluginConfigurations sets the configurations of multiple plugin contexts sharing the VM,
+// e.g. the inbound and outbound filters configured with the same vm_id. A plugin context is
+// created for each configuration in order, and the first one is given PluginContextID.
+// Use HostEmulator.PluginContextIDs to get the IDs of the others.
+func (o *EmulatorOption) WithPluginConfigurations(data ...[]byte) *EmulatorOption {
+	o.pluginConfigurations = data
 	return o
 }
 
@@ -50,6 +118,13 @@ func (o *EmulatorOption) WithVMConfiguration(data []byte) *EmulatorOption {
 	return o
 }
 
+// WithVMID sets the vm_id of the VM, which is used by proxywasm.ResolveSharedQueue
+// to look up the queues registered by the VM. Defaults to the empty string.
+func (o *EmulatorOption) WithVMID(vmID string) *EmulatorOption {
+	o.vmID = vmID
+	return o
+}
+
 // WithProperty sets a property. If the property already exists, it will be overwritten.
 func (o *EmulatorOption) WithProperty(path []string, value []byte) *EmulatorOption {
 	if o.properties == nil {
@@ -58,3 +133,25 @@ func (o *EmulatorOption) WithProperty(path []string, value []byte) *EmulatorOpti
 	o.properties[string(internal.SerializePropertyPath(path))] = value
 	return o
 }
+
+// newVMContext returns the types.VMContext to run, and the function to release it.
+// This panics if the wasm binary is specified but cannot be loaded, as tests cannot proceed.
+func (o *EmulatorOption) newVMContext() (vmContext types.VMContext, release func()) {
+	path := o.wasmBinaryPath
+	if path == "" && o.wasmBinaryFromEnv {
+		path = os.Getenv(WasmBinaryEnv)
+	}
+	if path == "" {
+		return o.vmContext, func() {}
+	}
+
+	wasm, err := os.ReadFile(path)
+	if err != nil {
+		panic(fmt.Sprintf("failed to read wasm binary: %v", err))
+	}
+	vm, err := NewWasmVMContext(wasm)
+	if err != nil {
+		panic(fmt.Sprintf("failed to load wasm binary %s: %v", path, err))
+	}
+	return vm, func() { _ = vm.Close() }
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/internal"
@@ -30,15 +31,48 @@ import (
 type HostEmulator interface {
 	// StartVM executes types.VMContext.OnVMStart in the plugin.
 	StartVM() types.OnVMStartStatus
-	// StartPlugin executes types.PluginContext.OnPluginStart in the plugin.
+	// StartPlugin executes types.PluginContext.OnPluginStart in the plugin for all the plugin contexts
+	// in the order of configurations. It stops at and returns the first status which is not OK.
 	StartPlugin() types.OnPluginStartStatus
-	// FinishVM executes types.PluginContext.OnPluginDone in the plugin.
+	// StartPluginFor executes types.PluginContext.OnPluginStart in the plugin for the given plugin context.
+	StartPluginFor(pluginContextID uint32) types.OnPluginStartStatus
+	// ReconfigurePlugin replaces the plugin configuration of the given plugin context, and executes
+	// types.PluginContext.OnPluginStart again as hosts do when the configuration is updated.
+	ReconfigurePlugin(pluginContextID uint32, configuration []byte) types.OnPluginStartStatus
+	// PluginContextIDs returns the IDs of the plugin contexts in the order of
+	// configurations given by EmulatorOption.WithPluginConfigurations.
+	PluginContextIDs() []uint32
+	// FinishVM executes types.PluginContext.OnPluginDone in the plugin for all the plugin contexts,
+	// and returns true if all of them are done.
 	FinishVM() bool
 	// GetCalloutAttributesFromContext returns the current HTTP callout attributes for the given HTTP context in the
 	// host.
 	GetCalloutAttributesFromContext(contextID uint32) []HttpCalloutAttribute
 	// CallOnHttpCallResponse executes the callback for the HTTP call with ID calloutID in the plugin.
 	CallOnHttpCallResponse(calloutID uint32, headers [][2]string, trailers [][2]string, body []byte)
+	// GetGrpcCalloutAttributesFromContext returns the gRPC calls made by proxywasm.DispatchGrpcCall
+	// from the given context in the host.
+	GetGrpcCalloutAttributesFromContext(contextID uint32) []GrpcCalloutAttribute
+	// CallOnGrpcCallResponse executes the callback for the gRPC call with ID calloutID in the plugin.
+	// If grpcStatus is 0 (OK), the trailing metadata and message are visible in the plugin for methods like
+	// proxywasm.GetGrpcCallResponseMessage. The trailing metadata is delivered before the message, unless it's nil.
+	// Otherwise, the call is considered failed with the given status.
+	CallOnGrpcCallResponse(calloutID uint32, grpcStatus uint32, trailingMetadata [][2]string, message []byte)
+	// GetGrpcStreamAttributesFromContext returns the gRPC streams opened by proxywasm.OpenGrpcStream
+	// from the given context in the host, including the messages the plugin has sent on each stream.
+	GetGrpcStreamAttributesFromContext(contextID uint32) []GrpcStreamAttribute
+	// CallOnGrpcStreamInitialMetadata executes types.GrpcStreamContext.OnGrpcStreamInitialMetadata in the plugin.
+	// The content of metadata is visible in the plugin for proxywasm.GetGrpcStreamInitialMetadata.
+	CallOnGrpcStreamInitialMetadata(streamID uint32, metadata [][2]string)
+	// CallOnGrpcStreamMessage executes types.GrpcStreamContext.OnGrpcStreamMessage in the plugin.
+	// The content of message is visible in the plugin for proxywasm.GetGrpcStreamMessage.
+	CallOnGrpcStreamMessage(streamID uint32, message []byte)
+	// CallOnGrpcStreamTrailingMetadata executes types.GrpcStreamContext.OnGrpcStreamTrailingMetadata in the plugin.
+	// The content of metadata is visible in the plugin for proxywasm.GetGrpcStreamTrailingMetadata.
+	CallOnGrpcStreamTrailingMetadata(streamID uint32, metadata [][2]string)
+	// CallOnGrpcStreamClose executes types.GrpcStreamContext.OnGrpcStreamClose in the plugin.
+	// No further events can be delivered to the stream after this call.
+	CallOnGrpcStreamClose(streamID uint32, grpcStatus uint32)
 	// GetCounterMetric returns the value for the counter in the host.
 	GetCounterMetric(name string) (uint64, error)
 	// GetGaugeMetric returns the value for the gauge in the host.
@@ -57,17 +91,52 @@ type HostEmulator interface {
 	GetErrorLogs() []string
 	// GetCriticalLogs returns the critical logs that have been collected in the host.
 	GetCriticalLogs() []string
-	// GetTickPeriod returns the current tick period in the host.
+	// GetLogFields returns the fields of the structured logs of the given level collected in the host,
+	// which are parsed by ParseLogFields. The logs which cannot be parsed are skipped.
+	GetLogFields(level types.LogLevel) []map[string]string
+	// GetRecoveredPanics returns the panics recovered in the plugin according to proxywasm.SetPanicPolicy.
+	GetRecoveredPanics() []RecoveredPanic
+	// SetLogLevel sets the log level of the host, and notifies the plugin of the change.
+	// The logs below the level are discarded by the host, and thus not returned by the Get*Logs methods.
+	// See EmulatorOption.WithLogLevel for the host which doesn't notify the change.
+	SetLogLevel(level types.LogLevel)
+	// GetTickPeriod returns the current tick period of the plugin context with PluginContextID in the host.
 	GetTickPeriod() uint32
-	// Tick executes types.PluginContext.OnTick in the plugin.
+	// GetTickPeriodFor returns the current tick period of the given plugin context in the host.
+	GetTickPeriodFor(pluginContextID uint32) uint32
+	// Tick executes types.PluginContext.OnTick in the plugin for the plugin context with PluginContextID.
+	// See TickFor for the emulated clock.
 	Tick()
+	// TickFor executes types.PluginContext.OnTick in the plugin for the given plugin context, after advancing
+	// the emulated clock by its tick period. The ticks of the other plugin contexts are not executed
+	// even if they come due, until AdvanceTime is called.
+	TickFor(pluginContextID uint32)
+	// AdvanceTime advances the emulated clock by d, and executes types.PluginContext.OnTick in the plugin
+	// for every tick which comes due in the meantime, in the order of time. The tick of each plugin context
+	// starts when the plugin sets its tick period.
+	AdvanceTime(d time.Duration)
+	// GetCurrentTime returns the current time of the emulated clock, which is returned by proxywasm.GetCurrentTime.
+	// The clock starts at the time given by EmulatorOption.WithStartTime, and advances only with AdvanceTime,
+	// Tick and TickFor.
+	GetCurrentTime() time.Time
 	// GetQueueSize gets the current size of the queue in the host.
 	GetQueueSize(queueID uint32) int
 	// RegisterForeignFunction registers the foreign function in the host.
 	RegisterForeignFunction(name string, f func([]byte) []byte)
+	// CallOnForeignFunction executes types.ForeignFunctionHandler.OnForeignFunction in the plugin
+	// for the plugin context with PluginContextID if it implements it. The given arg is visible in the plugin
+	// via proxywasm.GetForeignFunctionCallData.
+	CallOnForeignFunction(functionID uint32, arg []byte)
+	// CallOnForeignFunctionFor is the same as CallOnForeignFunction except that the function is called
+	// on the given plugin context.
+	CallOnForeignFunctionFor(pluginContextID uint32, functionID uint32, arg []byte)
 
 	// InitializeConnection executes types.TcpContext.OnNewConnection in the plugin.
+	// The connection is created by the plugin context with PluginContextID.
 	InitializeConnection() (contextID uint32, action types.Action)
+	// InitializeConnectionFor is the same as InitializeConnection except that
+	// the connection is created by the given plugin context.
+	InitializeConnectionFor(pluginContextID uint32) (contextID uint32, action types.Action)
 	// CallOnUpstreamData executes types.TcpContext.OnUpstreamData in the plugin.
 	CallOnUpstreamData(contextID uint32, data []byte) types.Action
 	// CallOnDownstreamData executes types.TcpContext.OnDownstreamData in the plugin.
@@ -80,7 +149,11 @@ type HostEmulator interface {
 	CompleteConnection(contextID uint32)
 
 	// InitializeHttpContext executes types.PluginContext.NewHttpContext in the plugin.
+	// The HTTP stream is created by the plugin context with PluginContextID.
 	InitializeHttpContext() (contextID uint32)
+	// InitializeHttpContextFor is the same as InitializeHttpContext except that
+	// the HTTP stream is created by the given plugin context.
+	InitializeHttpContextFor(pluginContextID uint32) (contextID uint32)
 	// CallOnResponseHeaders executes types.HttpContext.OnHttpResponseHeaders in the plugin.
 	// The number of headers and endOfStream are passed to the plugin and the content of headers are visible in
 	// the plugin for methods like proxywasm.GetHttpResponseHeaders.
@@ -126,6 +199,9 @@ type HostEmulator interface {
 	// host. This contains the arguments passed to proxywasm.SendHttpResponse in the plugin. If
 	// proxywasm.SendHttpResponse hasn't been invoked by the plugin, this will return nil.
 	GetSentLocalResponse(contextID uint32) *LocalHttpResponse
+	// IsHttpStreamReset returns true if the HTTP stream with ID contextID has been reset by
+	// proxywasm.ResetHttpStream in the plugin.
+	IsHttpStreamReset(contextID uint32) bool
 	// GetProperty returns property data from the host, for a given path.
 	GetProperty(path []string) ([]byte, error)
 	// SetProperty sets property data on the host, for a given path.
@@ -133,7 +209,8 @@ type HostEmulator interface {
 }
 
 const (
-	PluginContextID uint32 = 1 // TODO: support multiple pluginContext
+	// PluginContextID is the ID of the plugin context created for the first plugin configuration.
+	PluginContextID uint32 = 1
 )
 
 var nextContextID = PluginContextID + 1
@@ -142,6 +219,7 @@ type hostEmulator struct {
 	*rootHostEmulator
 	*networkHostEmulator
 	*httpHostEmulator
+	*grpcHostEmulator
 
 	effectiveContextID uint32
 	properties         map[string][]byte
@@ -151,13 +229,29 @@ type hostEmulator struct {
 // often involve calling methods on HostEmulator to invoke methods in the plugin while checking
 // the state within the host after plugin execution.
 func NewHostEmulator(opt *EmulatorOption) (host HostEmulator, reset func()) {
-	root := newRootHostEmulator(opt.pluginConfiguration, opt.vmConfiguration)
+	vmContext, closeVM := opt.newVMContext()
+	emulator := newHostEmulator(opt, newSharedHostState(opt.startTime))
+	release := internal.RegisterMockWasmHost(emulator)
+	emulator.initializeVM(vmContext)
+
+	return emulator, func() {
+		defer release()
+		defer internal.VMStateReset()
+		defer closeVM()
+	}
+}
+
+func newHostEmulator(opt *EmulatorOption, shared *sharedHostState) *hostEmulator {
+	root := newRootHostEmulator(shared, opt.vmID, opt.pluginConfigurations, opt.vmConfiguration)
+	root.logLevel = internal.LogLevel(opt.logLevel)
 	network := newNetworkHostEmulator()
-	http := newHttpHostEmulator()
+	http := newHttpHostEmulator(opt.bufferLimitBytes)
+	grpc := newGrpcHostEmulator()
 	emulator := &hostEmulator{
 		root,
 		network,
 		http,
+		grpc,
 		0,
 		make(map[string][]byte),
 	}
@@ -165,18 +259,17 @@ func NewHostEmulator(opt *EmulatorOption) (host HostEmulator, reset func()) {
 	for key, value := range opt.properties {
 		emulator.properties[key] = value
 	}
+	return emulator
+}
 
-	release := internal.RegisterMockWasmHost(emulator)
-
-	// set up state
-	proxywasm.SetVMContext(opt.vmContext)
-
-	// create plugin context: TODO: support multiple plugin contexts
-	internal.ProxyOnContextCreate(PluginContextID, 0)
+// initializeVM sets up the state of the VM which is currently registered to the internal package.
+func (h *hostEmulator) initializeVM(vmContext types.VMContext) {
+	proxywasm.SetVMContext(vmContext)
+	internal.VMStateSetPanicHook(h.recordPanic)
 
-	return emulator, func() {
-		defer release()
-		defer internal.VMStateReset()
+	// create plugin contexts
+	for _, id := range h.pluginContextIDs {
+		internal.ProxyOnContextCreate(id, 0)
 	}
 }
 
@@ -202,16 +295,39 @@ func getNextContextID() (ret uint32) {
 	return
 }
 
+// logLevelChangeHandler is implemented by the VM contexts which need to be notified of proxy_on_log_level_changed,
+// e.g. the VM context delegating to a compiled wasm binary.
+type logLevelChangeHandler interface {
+	onLogLevelChanged(level internal.LogLevel)
+}
+
+// contextDeleter is implemented by the contexts which need to be notified of proxy_on_delete,
+// e.g. the contexts delegating to a compiled wasm binary.
+type contextDeleter interface {
+	onDelete()
+}
+
+func deleteContext(contextID uint32) {
+	ctx := internal.VMStateGetContext(contextID)
+	internal.ProxyOnDelete(contextID)
+	if d, ok := ctx.(contextDeleter); ok {
+		d.onDelete()
+	}
+}
+
 // impl internal.ProxyWasmHost
 func (h *hostEmulator) ProxyGetBufferBytes(bt internal.BufferType, start int, maxSize int,
 	returnBufferData **byte, returnBufferSize *int) internal.Status {
 	switch bt {
-	case internal.BufferTypePluginConfiguration, internal.BufferTypeVMConfiguration, internal.BufferTypeHttpCallResponseBody:
+	case internal.BufferTypePluginConfiguration, internal.BufferTypeVMConfiguration, internal.BufferTypeHttpCallResponseBody,
+		internal.BufferTypeCallData:
 		return h.rootHostEmulatorProxyGetBufferBytes(bt, start, maxSize, returnBufferData, returnBufferSize)
 	case internal.BufferTypeDownstreamData, internal.BufferTypeUpstreamData:
 		return h.networkHostEmulatorProxyGetBufferBytes(bt, start, maxSize, returnBufferData, returnBufferSize)
 	case internal.BufferTypeHttpRequestBody, internal.BufferTypeHttpResponseBody:
 		return h.httpHostEmulatorProxyGetBufferBytes(bt, start, maxSize, returnBufferData, returnBufferSize)
+	case internal.BufferTypeGrpcReceiveBuffer:
+		return h.grpcHostEmulatorProxyGetBufferBytes(start, maxSize, returnBufferData, returnBufferSize)
 	default:
 		panic("unreachable: maybe a bug in this host emulation or SDK")
 	}
@@ -238,6 +354,9 @@ func (h *hostEmulator) ProxyGetHeaderMapValue(mapType internal.MapType, keyData
 	case internal.MapTypeHttpCallResponseHeaders, internal.MapTypeHttpCallResponseTrailers:
 		return h.rootHostEmulatorProxyGetMapValue(mapType, keyData,
 			keySize, returnValueData, returnValueSize)
+	case internal.MapTypeGrpcReceiveInitialMetadata, internal.MapTypeGrpcReceiveTrailingMetadata:
+		return h.grpcHostEmulatorProxyGetMapValue(mapType, keyData,
+			keySize, returnValueData, returnValueSize)
 	default:
 		panic("unreachable: maybe a bug in this host emulation or SDK")
 	}
@@ -252,6 +371,8 @@ func (h *hostEmulator) ProxyGetHeaderMapPairs(mapType internal.MapType, returnVa
 		return h.httpHostEmulatorProxyGetHeaderMapPairs(mapType, returnValueData, returnValueSize)
 	case internal.MapTypeHttpCallResponseHeaders, internal.MapTypeHttpCallResponseTrailers:
 		return h.rootHostEmulatorProxyGetHeaderMapPairs(mapType, returnValueData, returnValueSize)
+	case internal.MapTypeGrpcReceiveInitialMetadata, internal.MapTypeGrpcReceiveTrailingMetadata:
+		return h.grpcHostEmulatorProxyGetHeaderMapPairs(mapType, returnValueData, returnValueSize)
 	default:
 		panic("unreachable: maybe a bug in this host emulation or SDK")
 	}
@@ -288,14 +409,12 @@ func (h *hostEmulator) ProxyGetProperty(pathPtr *byte, pathSize int, dataPtrPtr
 	return internal.StatusOK
 }
 
-// impl internal.ProxyWasmHost
-func (h *hostEmulator) ProxyResolveSharedQueue(vmIDData *byte, vmIDSize int, nameData *byte, nameSize int, returnID *uint32) internal.Status {
-	log.Printf("ProxyResolveSharedQueue not implemented in the host emulator yet")
-	return 0
-}
-
 // impl internal.ProxyWasmHost
 func (h *hostEmulator) ProxyCloseStream(streamType internal.StreamType) internal.Status {
+	switch streamType {
+	case internal.StreamTypeRequest, internal.StreamTypeResponse:
+		return h.httpHostEmulatorProxyCloseStream()
+	}
 	log.Printf("ProxyCloseStream not implemented in the host emulator yet")
 	return 0
 }
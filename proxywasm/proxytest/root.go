@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/internal"
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
@@ -26,17 +27,27 @@ import (
 type (
 	rootHostEmulator struct {
 		activeCalloutID  uint32
+		logLevel         internal.LogLevel
 		logs             [internal.LogLevelMax][]string
-		tickPeriod       uint32
+		recoveredPanics  []RecoveredPanic
 		foreignFunctions map[string]func([]byte) []byte
+		foreignCallData  []byte
 
-		queues        map[uint32][][]byte
-		queueNameID   map[string]uint32
-		sharedDataKVS map[string]*sharedData
+		// pluginContextIDs are the IDs of plugin contexts in the order of configurations.
+		pluginContextIDs     []uint32
+		pluginConfigurations map[uint32][]byte // key: pluginContextID
+		tickPeriods          map[uint32]uint32 // key: pluginContextID
 
-		httpContextIDToCalloutInfos map[uint32][]HttpCalloutAttribute // key: contextID
-		httpCalloutIDToContextID    map[uint32]uint32                 // key: calloutID
-		httpCalloutResponse         map[uint32]struct {               // key: calloutID
+		// nextTicks are the times of the next ticks on the emulated clock. key: pluginContextID
+		nextTicks map[uint32]time.Time
+
+		// shared holds the shared data and shared queues, which are shared among
+		// the VMs in a ClusterEmulator.
+		shared *sharedHostState
+
+		httpContextIDToCalloutInfos    map[uint32][]HttpCalloutAttribute // key: contextID
+		httpCalloutIDToPluginContextID map[uint32]uint32                 // key: calloutID
+		httpCalloutResponse            map[uint32]struct {               // key: calloutID
 			headers  [][2]string
 			trailers [][2]string
 			body     []byte
@@ -46,7 +57,18 @@ type (
 		metricNameToID  map[string]uint32
 		metricIDToValue map[uint32]uint64
 
-		pluginConfiguration, vmConfiguration []byte
+		vmID            string
+		vmConfiguration []byte
+	}
+
+	// RecoveredPanic is a panic recovered in the plugin according to proxywasm.SetPanicPolicy.
+	RecoveredPanic struct {
+		// ContextID is the ID of the context whose callback panicked.
+		ContextID uint32
+		// Callback is the name of the callback which panicked, e.g. "OnHttpRequestHeaders".
+		Callback string
+		// Value is the value passed to panic.
+		Value interface{}
 	}
 
 	HttpCalloutAttribute struct {
@@ -63,62 +85,104 @@ type (
 	}
 )
 
-func newRootHostEmulator(pluginConfiguration, vmConfiguration []byte) *rootHostEmulator {
+func newRootHostEmulator(shared *sharedHostState, vmID string, pluginConfigurations [][]byte, vmConfiguration []byte) *rootHostEmulator {
 	host := &rootHostEmulator{
-		foreignFunctions:            map[string]func([]byte) []byte{},
-		queues:                      map[uint32][][]byte{},
-		queueNameID:                 map[string]uint32{},
-		sharedDataKVS:               map[string]*sharedData{},
-		metricIDToValue:             map[uint32]uint64{},
-		metricIDToType:              map[uint32]internal.MetricType{},
-		metricNameToID:              map[string]uint32{},
-		httpContextIDToCalloutInfos: map[uint32][]HttpCalloutAttribute{},
-		httpCalloutIDToContextID:    map[uint32]uint32{},
+		foreignFunctions:               map[string]func([]byte) []byte{},
+		pluginConfigurations:           map[uint32][]byte{},
+		tickPeriods:                    map[uint32]uint32{},
+		nextTicks:                      map[uint32]time.Time{},
+		metricIDToValue:                map[uint32]uint64{},
+		metricIDToType:                 map[uint32]internal.MetricType{},
+		metricNameToID:                 map[string]uint32{},
+		httpContextIDToCalloutInfos:    map[uint32][]HttpCalloutAttribute{},
+		httpCalloutIDToPluginContextID: map[uint32]uint32{},
 		httpCalloutResponse: map[uint32]struct {
 			headers  [][2]string
 			trailers [][2]string
 			body     []byte
 		}{},
 
-		pluginConfiguration: pluginConfiguration,
-		vmConfiguration:     vmConfiguration,
+		shared:          shared,
+		vmID:            vmID,
+		vmConfiguration: vmConfiguration,
+	}
+	shared.vms = append(shared.vms, host)
+
+	if len(pluginConfigurations) == 0 {
+		pluginConfigurations = [][]byte{nil}
+	}
+	for i, configuration := range pluginConfigurations {
+		id := PluginContextID
+		if i > 0 {
+			id = getNextContextID()
+		}
+		host.pluginContextIDs = append(host.pluginContextIDs, id)
+		host.pluginConfigurations[id] = configuration
 	}
 	return host
 }
 
+// activePluginContextID returns the ID of the plugin context which the currently active context belongs to.
+func activePluginContextID() uint32 {
+	return internal.VMStateGetPluginContextID(internal.VMStateGetActiveContextID())
+}
+
 // impl internal.ProxyWasmHost
 func (r *rootHostEmulator) ProxyLog(logLevel internal.LogLevel, messageData *byte, messageSize int) internal.Status {
-	str := internal.RawBytePtrToString(messageData, messageSize)
+	// Like Envoy, the logs below the log level are discarded.
+	if logLevel < r.logLevel {
+		return internal.StatusOK
+	}
+	// Copy the message since the memory of the guest running in a wasm binary is reused.
+	str := strings.Clone(internal.RawBytePtrToString(messageData, messageSize))
 
 	log.Printf("proxy_%s_log: %s", logLevel, str)
 	r.logs[logLevel] = append(r.logs[logLevel], str)
 	return internal.StatusOK
 }
 
+// impl internal.ProxyWasmHost
+func (r *rootHostEmulator) ProxyGetLogLevel(returnLogLevel *internal.LogLevel) internal.Status {
+	*returnLogLevel = r.logLevel
+	return internal.StatusOK
+}
+
 // impl internal.ProxyWasmHost
 func (r *rootHostEmulator) ProxySetTickPeriodMilliseconds(period uint32) internal.Status {
-	r.tickPeriod = period
+	id := activePluginContextID()
+	r.tickPeriods[id] = period
+	// Like Envoy, the tick restarts from now when the period is set.
+	if period == 0 {
+		delete(r.nextTicks, id)
+	} else {
+		r.nextTicks[id] = r.shared.now.Add(time.Duration(period) * time.Millisecond)
+	}
 	return internal.StatusOK
 }
 
 // impl internal.ProxyWasmHost
 func (r *rootHostEmulator) ProxyRegisterSharedQueue(nameData *byte, nameSize int, returnID *uint32) internal.Status {
 	name := internal.RawBytePtrToString(nameData, nameSize)
-	if id, ok := r.queueNameID[name]; ok {
-		*returnID = id
-		return internal.StatusOK
-	}
+	*returnID = r.shared.registerQueue(r, name, activePluginContextID())
+	return internal.StatusOK
+}
 
-	id := uint32(len(r.queues))
-	r.queues[id] = [][]byte{}
-	r.queueNameID[name] = id
+// impl internal.ProxyWasmHost
+func (r *rootHostEmulator) ProxyResolveSharedQueue(vmIDData *byte, vmIDSize int, nameData *byte, nameSize int, returnID *uint32) internal.Status {
+	vmID := internal.RawBytePtrToString(vmIDData, vmIDSize)
+	name := internal.RawBytePtrToString(nameData, nameSize)
+	id, ok := r.shared.queueNameID[queueKey{vmID: vmID, name: name}]
+	if !ok {
+		log.Printf("queue %s is not found in vm %q", name, vmID)
+		return internal.StatusNotFound
+	}
 	*returnID = id
 	return internal.StatusOK
 }
 
 // impl internal.ProxyWasmHost
 func (r *rootHostEmulator) ProxyDequeueSharedQueue(queueID uint32, returnValueData **byte, returnValueSize *int) internal.Status {
-	queue, ok := r.queues[queueID]
+	queue, ok := r.shared.queues[queueID]
 	if !ok {
 		log.Printf("queue %d is not found", queueID)
 		return internal.StatusNotFound
@@ -130,20 +194,20 @@ func (r *rootHostEmulator) ProxyDequeueSharedQueue(queueID uint32, returnValueDa
 	data := queue[0]
 	*returnValueData = &data[0]
 	*returnValueSize = len(data)
-	r.queues[queueID] = queue[1:]
+	r.shared.queues[queueID] = queue[1:]
 	return internal.StatusOK
 }
 
 // impl internal.ProxyWasmHost
 func (r *rootHostEmulator) ProxyEnqueueSharedQueue(queueID uint32, valueData *byte, valueSize int) internal.Status {
-	queue, ok := r.queues[queueID]
+	queue, ok := r.shared.queues[queueID]
 	if !ok {
 		log.Printf("queue %d is not found", queueID)
 		return internal.StatusNotFound
 	}
 
-	r.queues[queueID] = append(queue, internal.RawBytePtrToByteSlice(valueData, valueSize))
-	internal.ProxyOnQueueReady(PluginContextID, queueID)
+	r.shared.queues[queueID] = append(queue, internal.RawBytePtrToByteSlice(valueData, valueSize))
+	r.shared.notifyQueueReady(r, queueID)
 	return internal.StatusOK
 }
 
@@ -152,7 +216,7 @@ func (r *rootHostEmulator) ProxyGetSharedData(keyData *byte, keySize int,
 	returnValueData **byte, returnValueSize *int, returnCas *uint32) internal.Status {
 	key := internal.RawBytePtrToString(keyData, keySize)
 
-	value, ok := r.sharedDataKVS[key]
+	value, ok := r.shared.sharedDataKVS[key]
 	if !ok {
 		return internal.StatusNotFound
 	}
@@ -175,9 +239,9 @@ func (r *rootHostEmulator) ProxySetSharedData(keyData *byte, keySize int,
 	value := make([]byte, len(v))
 	copy(value, v)
 
-	prev, ok := r.sharedDataKVS[key]
+	prev, ok := r.shared.sharedDataKVS[key]
 	if !ok {
-		r.sharedDataKVS[key] = &sharedData{
+		r.shared.sharedDataKVS[key] = &sharedData{
 			data: value,
 			cas:  cas + 1,
 		}
@@ -188,8 +252,8 @@ func (r *rootHostEmulator) ProxySetSharedData(keyData *byte, keySize int,
 		return internal.StatusCasMismatch
 	}
 
-	r.sharedDataKVS[key].cas = cas + 1
-	r.sharedDataKVS[key].data = value
+	r.shared.sharedDataKVS[key].cas = cas + 1
+	r.shared.sharedDataKVS[key].data = value
 	return internal.StatusOK
 }
 
@@ -252,9 +316,9 @@ func (r *rootHostEmulator) ProxyHttpCall(upstreamData *byte, upstreamSize int, h
 	log.Printf("[http callout to %s] body: %s", upstream, body)
 	log.Printf("[http callout to %s] trailers: %v", upstream, trailers)
 
-	calloutID := uint32(len(r.httpCalloutIDToContextID))
+	calloutID := uint32(len(r.httpCalloutIDToPluginContextID))
 	contextID := internal.VMStateGetActiveContextID()
-	r.httpCalloutIDToContextID[calloutID] = contextID
+	r.httpCalloutIDToPluginContextID[calloutID] = internal.VMStateGetPluginContextID(contextID)
 	r.httpContextIDToCalloutInfos[contextID] = append(r.httpContextIDToCalloutInfos[contextID], HttpCalloutAttribute{
 		CalloutID: calloutID,
 		Upstream:  upstream,
@@ -351,7 +415,7 @@ func (r *rootHostEmulator) rootHostEmulatorProxyGetBufferBytes(bt internal.Buffe
 	var buf []byte
 	switch bt {
 	case internal.BufferTypePluginConfiguration:
-		buf = r.pluginConfiguration
+		buf = r.pluginConfigurations[activePluginContextID()]
 	case internal.BufferTypeVMConfiguration:
 		buf = r.vmConfiguration
 	case internal.BufferTypeHttpCallResponseBody:
@@ -361,6 +425,8 @@ func (r *rootHostEmulator) rootHostEmulatorProxyGetBufferBytes(bt internal.Buffe
 			log.Fatalf("callout response unregistered for %d", activeID)
 		}
 		buf = res.body
+	case internal.BufferTypeCallData:
+		buf = r.foreignCallData
 	default:
 		panic("unreachable: maybe a bug in this host emulation or SDK")
 	}
@@ -415,19 +481,89 @@ func (r *rootHostEmulator) getLogs(level internal.LogLevel) []string {
 	return r.logs[level]
 }
 
+// impl HostEmulator
+func (r *rootHostEmulator) GetLogFields(level types.LogLevel) []map[string]string {
+	return parseLogs(r.getLogs(internal.LogLevel(level)))
+}
+
+// impl HostEmulator
+func (r *rootHostEmulator) GetRecoveredPanics() []RecoveredPanic {
+	return r.recoveredPanics
+}
+
+func (r *rootHostEmulator) recordPanic(contextID uint32, callback string, value interface{}) {
+	r.recoveredPanics = append(r.recoveredPanics, RecoveredPanic{ContextID: contextID, Callback: callback, Value: value})
+}
+
+// impl HostEmulator
+func (r *rootHostEmulator) SetLogLevel(level types.LogLevel) {
+	r.logLevel = internal.LogLevel(level)
+	internal.ProxyOnLogLevelChanged(r.logLevel)
+	if h, ok := internal.VMStateGetVMContext().(logLevelChangeHandler); ok {
+		h.onLogLevelChanged(r.logLevel)
+	}
+}
+
 // impl HostEmulator
 func (r *rootHostEmulator) GetTickPeriod() uint32 {
-	return r.tickPeriod
+	return r.GetTickPeriodFor(PluginContextID)
+}
+
+// impl HostEmulator
+func (r *rootHostEmulator) GetTickPeriodFor(pluginContextID uint32) uint32 {
+	return r.tickPeriods[pluginContextID]
 }
 
 // impl HostEmulator
 func (r *rootHostEmulator) Tick() {
-	internal.ProxyOnTick(PluginContextID)
+	r.TickFor(PluginContextID)
+}
+
+// impl HostEmulator
+func (r *rootHostEmulator) TickFor(pluginContextID uint32) {
+	r.shared.now = r.shared.now.Add(time.Duration(r.tickPeriods[pluginContextID]) * time.Millisecond)
+	r.tick(pluginContextID)
+}
+
+// impl HostEmulator
+func (r *rootHostEmulator) AdvanceTime(d time.Duration) {
+	r.shared.advanceTime(d)
+}
+
+// impl HostEmulator
+func (r *rootHostEmulator) GetCurrentTime() time.Time {
+	return r.shared.now
+}
+
+// nextTick returns the plugin context whose tick comes first. Ties are broken by the order of pluginContextIDs.
+func (r *rootHostEmulator) nextTick() (pluginContextID uint32, at time.Time, ok bool) {
+	for _, id := range r.pluginContextIDs {
+		next, scheduled := r.nextTicks[id]
+		if scheduled && (!ok || next.Before(at)) {
+			pluginContextID, at, ok = id, next, true
+		}
+	}
+	return
+}
+
+// tick schedules the next tick of the plugin context, and executes types.PluginContext.OnTick.
+func (r *rootHostEmulator) tick(pluginContextID uint32) {
+	// Scheduled before the tick, so that the period set in OnTick takes precedence.
+	if period := r.tickPeriods[pluginContextID]; period > 0 {
+		r.nextTicks[pluginContextID] = r.shared.now.Add(time.Duration(period) * time.Millisecond)
+	}
+	internal.ProxyOnTick(pluginContextID)
+}
+
+// impl internal.ProxyWasmHost
+func (r *rootHostEmulator) ProxyGetCurrentTimeNanoseconds(returnTime *int64) internal.Status {
+	*returnTime = r.shared.now.UnixNano()
+	return internal.StatusOK
 }
 
 // impl HostEmulator
 func (r *rootHostEmulator) GetQueueSize(queueID uint32) int {
-	return len(r.queues[queueID])
+	return len(r.shared.queues[queueID])
 }
 
 // impl HostEmulator
@@ -441,9 +577,33 @@ func (r *rootHostEmulator) StartVM() types.OnVMStartStatus {
 	return internal.ProxyOnVMStart(PluginContextID, len(r.vmConfiguration))
 }
 
+// impl HostEmulator
+func (r *rootHostEmulator) PluginContextIDs() []uint32 {
+	return append([]uint32(nil), r.pluginContextIDs...)
+}
+
 // impl HostEmulator
 func (r *rootHostEmulator) StartPlugin() types.OnPluginStartStatus {
-	return internal.ProxyOnConfigure(PluginContextID, len(r.pluginConfiguration))
+	for _, id := range r.pluginContextIDs {
+		if status := r.StartPluginFor(id); status != types.OnPluginStartStatusOK {
+			return status
+		}
+	}
+	return types.OnPluginStartStatusOK
+}
+
+// impl HostEmulator
+func (r *rootHostEmulator) StartPluginFor(pluginContextID uint32) types.OnPluginStartStatus {
+	return internal.ProxyOnConfigure(pluginContextID, len(r.pluginConfigurations[pluginContextID]))
+}
+
+// impl HostEmulator
+func (r *rootHostEmulator) ReconfigurePlugin(pluginContextID uint32, configuration []byte) types.OnPluginStartStatus {
+	if _, ok := r.pluginConfigurations[pluginContextID]; !ok {
+		log.Fatalf("invalid plugin context id: %d", pluginContextID)
+	}
+	r.pluginConfigurations[pluginContextID] = configuration
+	return r.StartPluginFor(pluginContextID)
 }
 
 // impl HostEmulator
@@ -454,18 +614,39 @@ func (r *rootHostEmulator) CallOnHttpCallResponse(calloutID uint32, headers, tra
 	}{headers: cloneWithLowerCaseMapKeys(headers), trailers: cloneWithLowerCaseMapKeys(trailers), body: body}
 
 	// PluginContextID, calloutID uint32, numHeaders, bodySize, numTrailers in
+	pluginContextID := r.httpCalloutIDToPluginContextID[calloutID]
 	r.activeCalloutID = calloutID
 	defer func() {
 		r.activeCalloutID = 0
 		delete(r.httpCalloutResponse, calloutID)
-		delete(r.httpCalloutIDToContextID, calloutID)
+		delete(r.httpCalloutIDToPluginContextID, calloutID)
 	}()
-	internal.ProxyOnHttpCallResponse(PluginContextID, calloutID, len(headers), len(body), len(trailers))
+	internal.ProxyOnHttpCallResponse(pluginContextID, calloutID, len(headers), len(body), len(trailers))
+}
+
+// impl HostEmulator
+func (r *rootHostEmulator) CallOnForeignFunction(functionID uint32, arg []byte) {
+	r.CallOnForeignFunctionFor(PluginContextID, functionID, arg)
+}
+
+// impl HostEmulator
+func (r *rootHostEmulator) CallOnForeignFunctionFor(pluginContextID uint32, functionID uint32, arg []byte) {
+	r.foreignCallData = arg
+	defer func() {
+		r.foreignCallData = nil
+	}()
+	internal.ProxyOnForeignFunction(pluginContextID, functionID, len(arg))
 }
 
 // impl HostEmulator
 func (r *rootHostEmulator) FinishVM() bool {
-	return internal.ProxyOnDone(PluginContextID)
+	done := true
+	for _, id := range r.pluginContextIDs {
+		if !internal.ProxyOnDone(id) {
+			done = false
+		}
+	}
+	return done
 }
 
 func (r *rootHostEmulator) GetCounterMetric(name string) (uint64, error) {
@@ -0,0 +1,277 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxytest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+type foreignFunctionPlugin struct {
+	types.DefaultVMContext
+}
+
+type foreignFunctionPluginContext struct {
+	types.DefaultPluginContext
+}
+
+// NewPluginContext implements the same method on types.VMContext.
+func (*foreignFunctionPlugin) NewPluginContext(uint32) types.PluginContext {
+	return &foreignFunctionPluginContext{}
+}
+
+// OnForeignFunction implements the same method on types.ForeignFunctionHandler.
+func (*foreignFunctionPluginContext) OnForeignFunction(functionID uint32, argSize int) {
+	arg, err := proxywasm.GetForeignFunctionCallData()
+	if err != nil {
+		proxywasm.LogErrorf("failed to get call data: %v", err)
+		return
+	}
+	proxywasm.LogInfof("foreign function %d called with %d bytes: %s", functionID, argSize, arg)
+}
+
+func TestCallOnForeignFunction(t *testing.T) {
+	t.Run("handler", func(t *testing.T) {
+		host, reset := NewHostEmulator(NewEmulatorOption().WithVMContext(&foreignFunctionPlugin{}))
+		defer reset()
+
+		require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+		host.CallOnForeignFunction(3, []byte("hello"))
+		require.Equal(t, []string{"foreign function 3 called with 5 bytes: hello"}, host.GetInfoLogs())
+	})
+
+	t.Run("no handler", func(t *testing.T) {
+		host, reset := NewHostEmulator(NewEmulatorOption().WithVMContext(&types.DefaultVMContext{}))
+		defer reset()
+
+		require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+		host.CallOnForeignFunction(3, []byte("hello"))
+		require.Empty(t, host.GetInfoLogs())
+	})
+}
+
+type multiPlugin struct {
+	types.DefaultVMContext
+	// queueID is shared among the plugin contexts in the VM.
+	queueID uint32
+}
+
+type multiPluginContext struct {
+	types.DefaultPluginContext
+	vm   *multiPlugin
+	name string
+}
+
+type multiPluginHttpContext struct {
+	types.DefaultHttpContext
+	vm   *multiPlugin
+	name string
+}
+
+// NewPluginContext implements the same method on types.VMContext.
+func (vm *multiPlugin) NewPluginContext(uint32) types.PluginContext {
+	return &multiPluginContext{vm: vm}
+}
+
+// OnPluginStart implements the same method on types.PluginContext.
+func (p *multiPluginContext) OnPluginStart(int) types.OnPluginStartStatus {
+	config, err := proxywasm.GetPluginConfiguration()
+	if err != nil {
+		proxywasm.LogCriticalf("failed to get plugin configuration: %v", err)
+		return types.OnPluginStartStatusFailed
+	}
+	p.name = string(config)
+
+	if p.name == "inbound" {
+		if err := proxywasm.SetTickPeriodMilliSeconds(100); err != nil {
+			return types.OnPluginStartStatusFailed
+		}
+		queueID, err := proxywasm.RegisterSharedQueue("events")
+		if err != nil {
+			return types.OnPluginStartStatusFailed
+		}
+		p.vm.queueID = queueID
+	} else {
+		if err := proxywasm.SetTickPeriodMilliSeconds(200); err != nil {
+			return types.OnPluginStartStatusFailed
+		}
+	}
+	return types.OnPluginStartStatusOK
+}
+
+// OnTick implements the same method on types.PluginContext.
+func (p *multiPluginContext) OnTick() {
+	proxywasm.LogInfof("%s: tick", p.name)
+}
+
+// OnQueueReady implements the same method on types.PluginContext.
+func (p *multiPluginContext) OnQueueReady(uint32) {
+	proxywasm.LogInfof("%s: queue ready", p.name)
+}
+
+// OnForeignFunction implements the same method on types.ForeignFunctionHandler.
+func (p *multiPluginContext) OnForeignFunction(functionID uint32, _ int) {
+	proxywasm.LogInfof("%s: foreign function %d", p.name, functionID)
+}
+
+// NewHttpContext implements the same method on types.PluginContext.
+func (p *multiPluginContext) NewHttpContext(uint32) types.HttpContext {
+	return &multiPluginHttpContext{vm: p.vm, name: p.name}
+}
+
+// OnHttpRequestHeaders implements the same method on types.HttpContext.
+func (h *multiPluginHttpContext) OnHttpRequestHeaders(int, bool) types.Action {
+	if h.name == "outbound" {
+		if err := proxywasm.EnqueueSharedQueue(h.vm.queueID, []byte("event")); err != nil {
+			proxywasm.LogCriticalf("failed to enqueue: %v", err)
+		}
+	}
+
+	name := h.name
+	if _, err := proxywasm.DispatchHttpCall("upstream", [][2]string{{":method", "GET"}}, nil, nil, 1000,
+		func(int, int, int) {
+			proxywasm.LogInfof("%s: callout response", name)
+		}); err != nil {
+		proxywasm.LogCriticalf("failed to dispatch http call: %v", err)
+	}
+	return types.ActionPause
+}
+
+func TestMultiplePluginContexts(t *testing.T) {
+	opt := NewEmulatorOption().WithVMContext(&multiPlugin{}).
+		WithPluginConfigurations([]byte("inbound"), []byte("outbound"))
+	host, reset := NewHostEmulator(opt)
+	defer reset()
+
+	ids := host.PluginContextIDs()
+	require.Equal(t, 2, len(ids))
+	require.Equal(t, PluginContextID, ids[0])
+	inbound, outbound := ids[0], ids[1]
+
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+	require.Equal(t, uint32(100), host.GetTickPeriodFor(inbound))
+	require.Equal(t, uint32(200), host.GetTickPeriodFor(outbound))
+	require.Equal(t, host.GetTickPeriodFor(inbound), host.GetTickPeriod())
+
+	host.TickFor(outbound)
+	host.Tick()
+	require.Equal(t, []string{"outbound: tick", "inbound: tick"}, host.GetInfoLogs())
+
+	host.CallOnForeignFunctionFor(outbound, 1, nil)
+	host.CallOnForeignFunction(2, nil)
+	require.Equal(t, []string{"outbound: tick", "inbound: tick", "outbound: foreign function 1", "inbound: foreign function 2"},
+		host.GetInfoLogs())
+
+	// The queue registered by the inbound plugin context is notified there,
+	// even though the outbound plugin context enqueues the data.
+	contextID := host.InitializeHttpContextFor(outbound)
+	require.Equal(t, types.ActionPause, host.CallOnRequestHeaders(contextID, nil, false))
+	require.Contains(t, host.GetInfoLogs(), "inbound: queue ready")
+
+	// The response to the callout is delivered to the plugin context of the caller.
+	attrs := host.GetCalloutAttributesFromContext(contextID)
+	require.Equal(t, 1, len(attrs))
+	host.CallOnHttpCallResponse(attrs[0].CalloutID, nil, nil, nil)
+	require.Contains(t, host.GetInfoLogs(), "outbound: callout response")
+}
+
+func TestAdvanceTime(t *testing.T) {
+	opt := NewEmulatorOption().WithVMContext(&multiPlugin{}).
+		WithPluginConfigurations([]byte("inbound"), []byte("outbound"))
+	host, reset := NewHostEmulator(opt)
+	defer reset()
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	host.AdvanceTime(99 * time.Millisecond)
+	require.Empty(t, host.GetInfoLogs())
+
+	// The ticks at the same time are in the order of the plugin contexts.
+	host.AdvanceTime(101 * time.Millisecond)
+	require.Equal(t, []string{"inbound: tick", "inbound: tick", "outbound: tick"}, host.GetInfoLogs())
+
+	host.AdvanceTime(100 * time.Millisecond)
+	require.Equal(t, []string{"inbound: tick", "inbound: tick", "outbound: tick", "inbound: tick"}, host.GetInfoLogs())
+}
+
+func TestGetCurrentTime(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	opt := NewEmulatorOption().WithVMContext(&multiPlugin{}).
+		WithPluginConfigurations([]byte("inbound"), []byte("outbound")).WithStartTime(start)
+	host, reset := NewHostEmulator(opt)
+	defer reset()
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	now, err := proxywasm.GetCurrentTime()
+	require.NoError(t, err)
+	require.Equal(t, start, now.UTC())
+
+	// Tick advances the clock by the tick period.
+	host.Tick()
+	require.Equal(t, start.Add(100*time.Millisecond), host.GetCurrentTime())
+	host.TickFor(host.PluginContextIDs()[1])
+	require.Equal(t, start.Add(300*time.Millisecond), host.GetCurrentTime())
+	require.Equal(t, []string{"inbound: tick", "outbound: tick"}, host.GetInfoLogs())
+
+	// The overdue tick of the inbound plugin context at 200ms is executed first.
+	host.AdvanceTime(50 * time.Millisecond)
+	require.Equal(t, []string{"inbound: tick", "outbound: tick", "inbound: tick"}, host.GetInfoLogs())
+	require.Equal(t, start.Add(350*time.Millisecond), host.GetCurrentTime())
+}
+
+func TestLogLevel(t *testing.T) {
+	host, reset := NewHostEmulator(NewEmulatorOption().WithLogLevel(types.LogLevelInfo))
+	defer reset()
+
+	level, err := proxywasm.GetLogLevel()
+	require.NoError(t, err)
+	require.Equal(t, types.LogLevelInfo, level)
+	proxywasm.LogDebug("debug")
+	proxywasm.LogInfof("info")
+	require.Empty(t, host.GetDebugLogs())
+	require.Equal(t, []string{"info"}, host.GetInfoLogs())
+
+	host.SetLogLevel(types.LogLevelDebug)
+	level, err = proxywasm.GetLogLevel()
+	require.NoError(t, err)
+	require.Equal(t, types.LogLevelDebug, level)
+	proxywasm.LogDebugf("debug")
+	require.Equal(t, []string{"debug"}, host.GetDebugLogs())
+}
+
+func TestWithWasmBinary(t *testing.T) {
+	t.Run("not found", func(t *testing.T) {
+		opt := NewEmulatorOption().WithVMContext(&types.DefaultVMContext{}).WithWasmBinary("not-found.wasm")
+		require.PanicsWithValue(t, "failed to read wasm binary: open not-found.wasm: no such file or directory", func() {
+			NewHostEmulator(opt)
+		})
+	})
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv(WasmBinaryEnv, "not-found.wasm")
+		opt := NewEmulatorOption().WithVMContext(&types.DefaultVMContext{}).WithWasmBinaryFromEnv()
+		require.Panics(t, func() { NewHostEmulator(opt) })
+	})
+
+	t.Run("env without opt-in", func(t *testing.T) {
+		t.Setenv(WasmBinaryEnv, "not-found.wasm")
+		_, reset := NewHostEmulator(NewEmulatorOption().WithVMContext(&types.DefaultVMContext{}))
+		reset()
+	})
+}
@@ -30,19 +30,33 @@ import (
 )
 
 type guestABI struct {
-	proxyOnVMStart          api.Function
-	proxyOnContextCreate    api.Function
-	proxyOnConfigure        api.Function
-	proxyOnDone             api.Function
-	proxyOnQueueReady       api.Function
-	proxyOnTick             api.Function
-	proxyOnRequestHeaders   api.Function
-	proxyOnRequestBody      api.Function
-	proxyOnRequestTrailers  api.Function
-	proxyOnResponseHeaders  api.Function
-	proxyOnResponseBody     api.Function
-	proxyOnResponseTrailers api.Function
-	proxyOnLog              api.Function
+	proxyOnVMStart                   api.Function
+	proxyOnContextCreate             api.Function
+	proxyOnConfigure                 api.Function
+	proxyOnDone                      api.Function
+	proxyOnQueueReady                api.Function
+	proxyOnTick                      api.Function
+	proxyOnNewConnection             api.Function
+	proxyOnDownstreamData            api.Function
+	proxyOnDownstreamConnectionClose api.Function
+	proxyOnUpstreamData              api.Function
+	proxyOnUpstreamConnectionClose   api.Function
+	proxyOnRequestHeaders            api.Function
+	proxyOnRequestBody               api.Function
+	proxyOnRequestTrailers           api.Function
+	proxyOnResponseHeaders           api.Function
+	proxyOnResponseBody              api.Function
+	proxyOnResponseTrailers          api.Function
+	proxyOnLog                       api.Function
+	proxyOnDelete                    api.Function
+	proxyOnHttpCallResponse          api.Function
+	proxyOnForeignFunction           api.Function
+	proxyOnLogLevelChanged           api.Function
+
+	proxyOnGrpcReceiveInitialMetadata  api.Function
+	proxyOnGrpcReceive                 api.Function
+	proxyOnGrpcReceiveTrailingMetadata api.Function
+	proxyOnGrpcClose                   api.Function
 }
 
 // WasmVMContext is a VMContext that delegates execution to a compiled wasm binary.
@@ -81,8 +95,6 @@ type vmContext struct {
 //		require.NoError(t, err)
 //		vm = v
 //	}
-//
-// Note: Currently only HTTP plugins are supported.
 func NewWasmVMContext(wasm []byte) (WasmVMContext, error) {
 	ctx := context.Background()
 	r := wazero.NewRuntime(ctx)
@@ -109,25 +121,40 @@ func NewWasmVMContext(wasm []byte) (WasmVMContext, error) {
 	}
 
 	abi := guestABI{
-		proxyOnVMStart:          mod.ExportedFunction("proxy_on_vm_start"),
-		proxyOnContextCreate:    mod.ExportedFunction("proxy_on_context_create"),
-		proxyOnConfigure:        mod.ExportedFunction("proxy_on_configure"),
-		proxyOnDone:             mod.ExportedFunction("proxy_on_done"),
-		proxyOnQueueReady:       mod.ExportedFunction("proxy_on_queue_ready"),
-		proxyOnTick:             mod.ExportedFunction("proxy_on_tick"),
-		proxyOnRequestHeaders:   mod.ExportedFunction("proxy_on_request_headers"),
-		proxyOnRequestBody:      mod.ExportedFunction("proxy_on_request_body"),
-		proxyOnRequestTrailers:  mod.ExportedFunction("proxy_on_request_trailers"),
-		proxyOnResponseHeaders:  mod.ExportedFunction("proxy_on_response_headers"),
-		proxyOnResponseBody:     mod.ExportedFunction("proxy_on_response_body"),
-		proxyOnResponseTrailers: mod.ExportedFunction("proxy_on_response_trailers"),
-		proxyOnLog:              mod.ExportedFunction("proxy_on_log"),
+		proxyOnVMStart:                   mod.ExportedFunction("proxy_on_vm_start"),
+		proxyOnContextCreate:             mod.ExportedFunction("proxy_on_context_create"),
+		proxyOnConfigure:                 mod.ExportedFunction("proxy_on_configure"),
+		proxyOnDone:                      mod.ExportedFunction("proxy_on_done"),
+		proxyOnQueueReady:                mod.ExportedFunction("proxy_on_queue_ready"),
+		proxyOnTick:                      mod.ExportedFunction("proxy_on_tick"),
+		proxyOnNewConnection:             mod.ExportedFunction("proxy_on_new_connection"),
+		proxyOnDownstreamData:            mod.ExportedFunction("proxy_on_downstream_data"),
+		proxyOnDownstreamConnectionClose: mod.ExportedFunction("proxy_on_downstream_connection_close"),
+		proxyOnUpstreamData:              mod.ExportedFunction("proxy_on_upstream_data"),
+		proxyOnUpstreamConnectionClose:   mod.ExportedFunction("proxy_on_upstream_connection_close"),
+		proxyOnRequestHeaders:            mod.ExportedFunction("proxy_on_request_headers"),
+		proxyOnRequestBody:               mod.ExportedFunction("proxy_on_request_body"),
+		proxyOnRequestTrailers:           mod.ExportedFunction("proxy_on_request_trailers"),
+		proxyOnResponseHeaders:           mod.ExportedFunction("proxy_on_response_headers"),
+		proxyOnResponseBody:              mod.ExportedFunction("proxy_on_response_body"),
+		proxyOnResponseTrailers:          mod.ExportedFunction("proxy_on_response_trailers"),
+		proxyOnLog:                       mod.ExportedFunction("proxy_on_log"),
+		proxyOnDelete:                    mod.ExportedFunction("proxy_on_delete"),
+		proxyOnHttpCallResponse:          mod.ExportedFunction("proxy_on_http_call_response"),
+		proxyOnForeignFunction:           mod.ExportedFunction("proxy_on_foreign_function"),
+		proxyOnLogLevelChanged:           mod.ExportedFunction("proxy_on_log_level_changed"),
+
+		proxyOnGrpcReceiveInitialMetadata:  mod.ExportedFunction("proxy_on_grpc_receive_initial_metadata"),
+		proxyOnGrpcReceive:                 mod.ExportedFunction("proxy_on_grpc_receive"),
+		proxyOnGrpcReceiveTrailingMetadata: mod.ExportedFunction("proxy_on_grpc_receive_trailing_metadata"),
+		proxyOnGrpcClose:                   mod.ExportedFunction("proxy_on_grpc_close"),
 	}
 
 	return &vmContext{
 		runtime: r,
 		abi:     abi,
-		ctx:     ctx,
+		// Host functions calling back into the guest, e.g. on the completion of callouts, look up the exports from ctx.
+		ctx: withGuestABI(ctx, abi),
 	}, nil
 }
 
@@ -139,14 +166,24 @@ func (v *vmContext) OnVMStart(vmConfigurationSize int) types.OnVMStartStatus {
 	return res[0] == 1
 }
 
+// onLogLevelChanged implements logLevelChangeHandler.
+func (v *vmContext) onLogLevelChanged(level internal.LogLevel) {
+	if v.abi.proxyOnLogLevelChanged == nil {
+		return // The guest is built with the SDK not supporting proxy_on_log_level_changed.
+	}
+	_, err := v.abi.proxyOnLogLevelChanged.Call(v.ctx, uint64(level))
+	handleErr(err)
+}
+
 // NewPluginContext implements the same method on types.VMContext.
 func (v *vmContext) NewPluginContext(contextID uint32) types.PluginContext {
 	_, err := v.abi.proxyOnContextCreate.Call(v.ctx, uint64(contextID), 0)
 	handleErr(err)
 	return &pluginContext{
-		id:  uint64(contextID),
-		abi: v.abi,
-		ctx: withPluginContextID(v.ctx, contextID),
+		id:       uint64(contextID),
+		abi:      v.abi,
+		ctx:      withPluginContextID(v.ctx, contextID),
+		contexts: map[uint32]contextKind{},
 	}
 }
 
@@ -160,8 +197,17 @@ type pluginContext struct {
 	id  uint64
 	abi guestABI
 	ctx context.Context
+	// contexts records the kind of the contexts created in the guest, so that the guest is asked only once.
+	contexts map[uint32]contextKind
 }
 
+type contextKind int
+
+const (
+	contextKindHttp contextKind = iota
+	contextKindTcp
+)
+
 // OnPluginStart implements the same method on types.PluginContext.
 func (p *pluginContext) OnPluginStart(pluginConfigurationSize int) types.OnPluginStartStatus {
 	res, err := p.abi.proxyOnConfigure.Call(p.ctx, p.id, uint64(pluginConfigurationSize))
@@ -188,15 +234,32 @@ func (p *pluginContext) OnTick() {
 	handleErr(err)
 }
 
+// OnForeignFunction implements the same method on types.ForeignFunctionHandler.
+func (p *pluginContext) OnForeignFunction(functionID uint32, argSize int) {
+	if p.abi.proxyOnForeignFunction == nil {
+		return // The guest is built with the SDK not supporting proxy_on_foreign_function.
+	}
+	_, err := p.abi.proxyOnForeignFunction.Call(p.ctx, p.id, uint64(functionID), uint64(argSize))
+	handleErr(err)
+}
+
 // NewTcpContext implements the same method on types.PluginContext.
-func (p *pluginContext) NewTcpContext(uint32) types.TcpContext {
-	return nil
+func (p *pluginContext) NewTcpContext(contextID uint32) types.TcpContext {
+	if !p.createContext(contextID, contextKindTcp) {
+		return nil
+	}
+	return &tcpContext{
+		id:  uint64(contextID),
+		abi: p.abi,
+		ctx: p.ctx,
+	}
 }
 
 // NewHttpContext implements the same method on types.PluginContext.
 func (p *pluginContext) NewHttpContext(contextID uint32) types.HttpContext {
-	_, err := p.abi.proxyOnContextCreate.Call(p.ctx, uint64(contextID), p.id)
-	handleErr(err)
+	if !p.createContext(contextID, contextKindHttp) {
+		return nil
+	}
 	return &httpContext{
 		id:  uint64(contextID),
 		abi: p.abi,
@@ -204,6 +267,70 @@ func (p *pluginContext) NewHttpContext(contextID uint32) types.HttpContext {
 	}
 }
 
+// createContext creates the context in the guest on the first call for contextID, and returns true
+// if the context is of the given kind. proxy_on_context_create doesn't tell which kind of context the guest
+// created, so the kind is the one requested first, which the emulator requests explicitly for TCP contexts.
+func (p *pluginContext) createContext(contextID uint32, kind contextKind) bool {
+	if created, ok := p.contexts[contextID]; ok {
+		return created == kind
+	}
+	_, err := p.abi.proxyOnContextCreate.Call(p.ctx, uint64(contextID), p.id)
+	handleErr(err)
+	p.contexts[contextID] = kind
+	return true
+}
+
+// tcpContext implements types.TcpContext.
+type tcpContext struct {
+	id  uint64
+	abi guestABI
+	ctx context.Context
+}
+
+// OnNewConnection implements the same method on types.TcpContext.
+func (t *tcpContext) OnNewConnection() types.Action {
+	res, err := t.abi.proxyOnNewConnection.Call(t.ctx, t.id)
+	handleErr(err)
+	return types.Action(res[0])
+}
+
+// OnDownstreamData implements the same method on types.TcpContext.
+func (t *tcpContext) OnDownstreamData(dataSize int, endOfStream bool) types.Action {
+	res, err := t.abi.proxyOnDownstreamData.Call(t.ctx, t.id, uint64(dataSize), wasmBool(endOfStream))
+	handleErr(err)
+	return types.Action(res[0])
+}
+
+// OnDownstreamClose implements the same method on types.TcpContext.
+func (t *tcpContext) OnDownstreamClose(peerType types.PeerType) {
+	_, err := t.abi.proxyOnDownstreamConnectionClose.Call(t.ctx, t.id, uint64(peerType))
+	handleErr(err)
+}
+
+// OnUpstreamData implements the same method on types.TcpContext.
+func (t *tcpContext) OnUpstreamData(dataSize int, endOfStream bool) types.Action {
+	res, err := t.abi.proxyOnUpstreamData.Call(t.ctx, t.id, uint64(dataSize), wasmBool(endOfStream))
+	handleErr(err)
+	return types.Action(res[0])
+}
+
+// OnUpstreamClose implements the same method on types.TcpContext.
+func (t *tcpContext) OnUpstreamClose(peerType types.PeerType) {
+	_, err := t.abi.proxyOnUpstreamConnectionClose.Call(t.ctx, t.id, uint64(peerType))
+	handleErr(err)
+}
+
+// OnStreamDone implements the same method on types.TcpContext.
+func (t *tcpContext) OnStreamDone() {
+	_, err := t.abi.proxyOnLog.Call(t.ctx, t.id)
+	handleErr(err)
+}
+
+// onDelete implements contextDeleter.
+func (t *tcpContext) onDelete() {
+	callOnDelete(t.ctx, t.abi, t.id)
+}
+
 // httpContext implements types.HttpContext.
 type httpContext struct {
 	id  uint64
@@ -259,6 +386,48 @@ func (h *httpContext) OnHttpStreamDone() {
 	handleErr(err)
 }
 
+// onDelete implements contextDeleter.
+func (h *httpContext) onDelete() {
+	callOnDelete(h.ctx, h.abi, h.id)
+}
+
+func callOnDelete(ctx context.Context, abi guestABI, contextID uint64) {
+	_, err := abi.proxyOnDelete.Call(ctx, contextID)
+	handleErr(err)
+}
+
+// grpcStreamContext implements types.GrpcStreamContext by forwarding the events
+// of the stream opened by the guest to the guest.
+type grpcStreamContext struct {
+	streamID uint64
+	abi      guestABI
+	ctx      context.Context
+}
+
+// OnGrpcStreamInitialMetadata implements the same method on types.GrpcStreamContext.
+func (g *grpcStreamContext) OnGrpcStreamInitialMetadata(numHeaders int) {
+	_, err := g.abi.proxyOnGrpcReceiveInitialMetadata.Call(g.ctx, uint64(getPluginContextID(g.ctx)), g.streamID, uint64(numHeaders))
+	handleErr(err)
+}
+
+// OnGrpcStreamMessage implements the same method on types.GrpcStreamContext.
+func (g *grpcStreamContext) OnGrpcStreamMessage(messageSize int) {
+	_, err := g.abi.proxyOnGrpcReceive.Call(g.ctx, uint64(getPluginContextID(g.ctx)), g.streamID, uint64(messageSize))
+	handleErr(err)
+}
+
+// OnGrpcStreamTrailingMetadata implements the same method on types.GrpcStreamContext.
+func (g *grpcStreamContext) OnGrpcStreamTrailingMetadata(numTrailers int) {
+	_, err := g.abi.proxyOnGrpcReceiveTrailingMetadata.Call(g.ctx, uint64(getPluginContextID(g.ctx)), g.streamID, uint64(numTrailers))
+	handleErr(err)
+}
+
+// OnGrpcStreamClose implements the same method on types.GrpcStreamContext.
+func (g *grpcStreamContext) OnGrpcStreamClose(grpcStatus uint32) {
+	_, err := g.abi.proxyOnGrpcClose.Call(g.ctx, uint64(getPluginContextID(g.ctx)), g.streamID, uint64(grpcStatus))
+	handleErr(err)
+}
+
 func handleErr(err error) {
 	if err != nil {
 		panic(err)
@@ -324,6 +493,17 @@ func exportHostABI(ctx context.Context, r wazero.Runtime) error {
 			return uint32(internal.ProxyLog(internal.LogLevel(logLevel), messageDataPtr, int(messageSize)))
 		}).
 		Export("proxy_log").
+		// proxy_get_log_level returns the current log level of the host.
+		NewFunctionBuilder().
+		WithParameterNames("return_log_level").
+		WithResultNames("call_result").
+		WithFunc(func(ctx context.Context, mod api.Module, returnLogLevel uint32) uint32 {
+			var level internal.LogLevel
+			ret := uint32(internal.ProxyGetLogLevel(&level))
+			handleMemoryStatus(mod.Memory().WriteUint32Le(returnLogLevel, uint32(level)))
+			return ret
+		}).
+		Export("proxy_get_log_level").
 		// proxy_set_property sets a property value.
 		// See https://github.com/proxy-wasm/spec/tree/master/abi-versions/vNEXT#proxy_set_property
 		NewFunctionBuilder().
@@ -611,16 +791,115 @@ func exportHostABI(ctx context.Context, r wazero.Runtime) error {
 			// Finishing proxy_http_call executes a callback, not a plugin lifecycle method, unlike every other host function which would then end up in wasm.
 			// We can work around this by registering a callback here to go back to the wasm.
 			internal.RegisterHttpCallout(calloutID, func(numHeaders, bodySize, numTrailers int) {
-				proxyOnHttpCallResponse := mod.ExportedFunction("proxy_on_http_call_response")
-				_, err := proxyOnHttpCallResponse.Call(ctx, uint64(getPluginContextID(ctx)), uint64(calloutID), uint64(numHeaders), uint64(bodySize), uint64(numTrailers))
-				if err != nil {
-					panic(err)
-				}
+				_, err := getGuestABI(ctx).proxyOnHttpCallResponse.Call(ctx, uint64(getPluginContextID(ctx)), uint64(calloutID), uint64(numHeaders), uint64(bodySize), uint64(numTrailers))
+				handleErr(err)
 			})
 
 			return ret
 		}).
 		Export("proxy_http_call").
+		// proxy_grpc_call dispatches a unary gRPC call to upstream. Once the response is returned to the host,
+		// proxy_on_grpc_receive or proxy_on_grpc_close will be called with a unique call identifier (return_callout_id).
+		//
+		// Note: proxy-wasm-spec calls this proxy_dispatch_grpc_call. See
+		// https://github.com/proxy-wasm/spec/tree/master/abi-versions/vNEXT#proxy_dispatch_grpc_call
+		NewFunctionBuilder().
+		WithParameterNames("grpc_service_data", "grpc_service_size", "service_name_data", "service_name_size",
+			"method_name_data", "method_name_size", "initial_metadata_map_data", "initial_metadata_map_size",
+			"grpc_message_data", "grpc_message_size", "timeout_milliseconds", "return_callout_id").
+		WithResultNames("call_result").
+		WithFunc(func(ctx context.Context, mod api.Module, grpcServiceData, grpcServiceSize, serviceNameData, serviceNameSize,
+			methodNameData, methodNameSize, initialMetadataData, initialMetadataSize, messageData, messageSize,
+			timeout, calloutIDPtr uint32) uint32 {
+			grpcServicePtr := wasmBytePtr(mod, grpcServiceData, grpcServiceSize)
+			serviceNamePtr := wasmBytePtr(mod, serviceNameData, serviceNameSize)
+			methodNamePtr := wasmBytePtr(mod, methodNameData, methodNameSize)
+			initialMetadataPtr := wasmBytePtr(mod, initialMetadataData, initialMetadataSize)
+			messagePtr := wasmBytePtr(mod, messageData, messageSize)
+			var calloutID uint32
+			ret := uint32(internal.ProxyGrpcCall(grpcServicePtr, int(grpcServiceSize), serviceNamePtr, int(serviceNameSize),
+				methodNamePtr, int(methodNameSize), initialMetadataPtr, int(initialMetadataSize), messagePtr, int(messageSize),
+				timeout, &calloutID))
+			handleMemoryStatus(mod.Memory().WriteUint32Le(calloutIDPtr, calloutID))
+
+			// As with proxy_http_call, register a callback here to go back to the wasm.
+			internal.RegisterGrpcCallout(calloutID, func(grpcStatus uint32, responseSize int) {
+				abi := getGuestABI(ctx)
+				var err error
+				if grpcStatus == internal.GrpcStatusOK {
+					if md := internal.GetGrpcCallTrailingMetadata(); md != nil {
+						_, err = abi.proxyOnGrpcReceiveTrailingMetadata.Call(ctx, uint64(getPluginContextID(ctx)), uint64(calloutID), uint64(len(md)))
+						handleErr(err)
+					}
+					_, err = abi.proxyOnGrpcReceive.Call(ctx, uint64(getPluginContextID(ctx)), uint64(calloutID), uint64(responseSize))
+				} else {
+					_, err = abi.proxyOnGrpcClose.Call(ctx, uint64(getPluginContextID(ctx)), uint64(calloutID), uint64(grpcStatus))
+				}
+				handleErr(err)
+			})
+			return ret
+		}).
+		Export("proxy_grpc_call").
+		// proxy_grpc_stream opens a bidirectional gRPC stream to upstream. The events on the stream are notified via
+		// proxy_on_grpc_receive_initial_metadata, proxy_on_grpc_receive, proxy_on_grpc_receive_trailing_metadata and
+		// proxy_on_grpc_close with the returned stream identifier (return_stream_id).
+		//
+		// Note: proxy-wasm-spec calls this proxy_open_grpc_stream. See
+		// https://github.com/proxy-wasm/spec/tree/master/abi-versions/vNEXT#proxy_open_grpc_stream
+		NewFunctionBuilder().
+		WithParameterNames("grpc_service_data", "grpc_service_size", "service_name_data", "service_name_size",
+			"method_name_data", "method_name_size", "initial_metadata_map_data", "initial_metadata_map_size",
+			"return_stream_id").
+		WithResultNames("call_result").
+		WithFunc(func(ctx context.Context, mod api.Module, grpcServiceData, grpcServiceSize, serviceNameData, serviceNameSize,
+			methodNameData, methodNameSize, initialMetadataData, initialMetadataSize, streamIDPtr uint32) uint32 {
+			grpcServicePtr := wasmBytePtr(mod, grpcServiceData, grpcServiceSize)
+			serviceNamePtr := wasmBytePtr(mod, serviceNameData, serviceNameSize)
+			methodNamePtr := wasmBytePtr(mod, methodNameData, methodNameSize)
+			initialMetadataPtr := wasmBytePtr(mod, initialMetadataData, initialMetadataSize)
+			var streamID uint32
+			ret := uint32(internal.ProxyGrpcStream(grpcServicePtr, int(grpcServiceSize), serviceNamePtr, int(serviceNameSize),
+				methodNamePtr, int(methodNameSize), initialMetadataPtr, int(initialMetadataSize), &streamID))
+			handleMemoryStatus(mod.Memory().WriteUint32Le(streamIDPtr, streamID))
+
+			internal.RegisterGrpcStream(streamID, &grpcStreamContext{streamID: uint64(streamID), abi: getGuestABI(ctx), ctx: ctx})
+			return ret
+		}).
+		Export("proxy_grpc_stream").
+		// proxy_grpc_send sends a message on the gRPC stream.
+		//
+		// Note: proxy-wasm-spec calls this proxy_send_grpc_stream_message. See
+		// https://github.com/proxy-wasm/spec/tree/master/abi-versions/vNEXT#proxy_send_grpc_stream_message
+		NewFunctionBuilder().
+		WithParameterNames("stream_id", "grpc_message_data", "grpc_message_size", "end_of_stream").
+		WithResultNames("call_result").
+		WithFunc(func(ctx context.Context, mod api.Module, streamID, messageData, messageSize, endOfStream uint32) uint32 {
+			messagePtr := wasmBytePtr(mod, messageData, messageSize)
+			return uint32(internal.ProxyGrpcSend(streamID, messagePtr, int(messageSize), endOfStream != 0))
+		}).
+		Export("proxy_grpc_send").
+		// proxy_grpc_cancel cancels the gRPC call or stream. No further callbacks are made for it.
+		//
+		// Note: proxy-wasm-spec calls this proxy_cancel_grpc_call and proxy_cancel_grpc_stream. See
+		// https://github.com/proxy-wasm/spec/tree/master/abi-versions/vNEXT#proxy_cancel_grpc_call
+		NewFunctionBuilder().
+		WithParameterNames("callout_id").
+		WithResultNames("call_result").
+		WithFunc(func(calloutID uint32) uint32 {
+			return uint32(internal.ProxyGrpcCancel(calloutID))
+		}).
+		Export("proxy_grpc_cancel").
+		// proxy_grpc_close half-closes the gRPC stream from the local side.
+		//
+		// Note: proxy-wasm-spec calls this proxy_close_grpc_stream. See
+		// https://github.com/proxy-wasm/spec/tree/master/abi-versions/vNEXT#proxy_close_grpc_stream
+		NewFunctionBuilder().
+		WithParameterNames("callout_id").
+		WithResultNames("call_result").
+		WithFunc(func(calloutID uint32) uint32 {
+			return uint32(internal.ProxyGrpcClose(calloutID))
+		}).
+		Export("proxy_grpc_close").
 		// proxy_call_foreign_function calls a registered foreign function.
 		//
 		// See https://github.com/proxy-wasm/spec/tree/master/abi-versions/vNEXT#proxy_call_foreign_function
@@ -651,6 +930,18 @@ func exportHostABI(ctx context.Context, r wazero.Runtime) error {
 			return uint32(internal.ProxySetTickPeriodMilliseconds(period))
 		}).
 		Export("proxy_set_tick_period_milliseconds").
+		// proxy_get_current_time_nanoseconds returns the current time of the emulated clock
+		// as nanoseconds since the Unix epoch.
+		NewFunctionBuilder().
+		WithParameterNames("return_time").
+		WithResultNames("call_result").
+		WithFunc(func(ctx context.Context, mod api.Module, returnTime uint32) uint32 {
+			var now int64
+			ret := uint32(internal.ProxyGetCurrentTimeNanoseconds(&now))
+			handleMemoryStatus(mod.Memory().WriteUint64Le(returnTime, uint64(now)))
+			return ret
+		}).
+		Export("proxy_get_current_time_nanoseconds").
 		// proxy_set_effective_context changes the effective context. This function is usually used to change the
 		// context after receiving proxy_on_http_call_response, proxy_on_grpc_call_response or proxy_on_queue_ready.
 		//
@@ -737,3 +1028,16 @@ func getPluginContextID(ctx context.Context) uint32 {
 	id, _ := ctx.Value(pluginContextIDKey).(uint32)
 	return id
 }
+
+type guestABIKeyType struct{}
+
+var guestABIKey = guestABIKeyType{}
+
+func withGuestABI(ctx context.Context, abi guestABI) context.Context {
+	return context.WithValue(ctx, guestABIKey, abi)
+}
+
+func getGuestABI(ctx context.Context) guestABI {
+	abi, _ := ctx.Value(guestABIKey).(guestABI)
+	return abi
+}
@@ -0,0 +1,307 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxytest
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+// The opcodes and types of wasm used by the guest below.
+const (
+	wasmI32      = 0x7f
+	wasmEnd      = 0x0b
+	wasmIf       = 0x04
+	wasmVoid     = 0x40
+	wasmDrop     = 0x1a
+	wasmCall     = 0x10
+	wasmLocalGet = 0x20
+	wasmI32Const = 0x41
+)
+
+// wasmGuestDataOffset is where the data of the guest is placed in its memory.
+const wasmGuestDataOffset = 1024
+
+type wasmFunc struct {
+	name    string
+	params  int
+	results int
+	body    []byte
+}
+
+type wasmImport struct {
+	name            string
+	params, results int
+}
+
+// wasmGuest is a minimal plugin built without TinyGo, so that the tests of the wasm runner always run.
+// All the parameters and results are i32, and the data is placed at wasmGuestDataOffset.
+type wasmGuest struct {
+	imports []wasmImport
+	funcs   []wasmFunc
+	data    []byte
+}
+
+// importFunc imports the host function, and returns its index.
+func (g *wasmGuest) importFunc(name string, params, results int) byte {
+	g.imports = append(g.imports, wasmImport{name: name, params: params, results: results})
+	return byte(len(g.imports) - 1)
+}
+
+func (g *wasmGuest) exportFunc(name string, params, results int, body ...byte) {
+	g.funcs = append(g.funcs, wasmFunc{name: name, params: params, results: results, body: body})
+}
+
+// addData appends the data, and returns its offset in the memory.
+func (g *wasmGuest) addData(data string) int {
+	off := wasmGuestDataOffset + len(g.data)
+	g.data = append(g.data, data...)
+	return off
+}
+
+func (g *wasmGuest) binary() []byte {
+	// Each function has its own type, which is fine for the tests.
+	var types, imports, funcs, exports, code []byte
+	var typeCount int
+	addType := func(params, results int) {
+		types = append(types, 0x60)
+		types = appendWasmU32(types, uint32(params))
+		for i := 0; i < params; i++ {
+			types = append(types, wasmI32)
+		}
+		types = appendWasmU32(types, uint32(results))
+		for i := 0; i < results; i++ {
+			types = append(types, wasmI32)
+		}
+	}
+
+	for _, imp := range g.imports {
+		addType(imp.params, imp.results)
+		imports = appendWasmName(imports, "env")
+		imports = appendWasmName(imports, imp.name)
+		imports = append(imports, 0x00)
+		imports = appendWasmU32(imports, uint32(typeCount))
+		typeCount++
+	}
+	for i, f := range g.funcs {
+		addType(f.params, f.results)
+		funcs = appendWasmU32(funcs, uint32(typeCount))
+		typeCount++
+
+		exports = appendWasmName(exports, f.name)
+		exports = append(exports, 0x00)
+		exports = appendWasmU32(exports, uint32(len(g.imports)+i))
+
+		body := append([]byte{0x00}, f.body...) // No locals.
+		body = append(body, wasmEnd)
+		code = appendWasmU32(code, uint32(len(body)))
+		code = append(code, body...)
+	}
+	exports = appendWasmName(exports, "memory")
+	exports = append(exports, 0x02, 0x00)
+
+	data := []byte{0x00, wasmI32Const}
+	data = appendWasmI32(data, wasmGuestDataOffset)
+	data = append(data, wasmEnd)
+	data = appendWasmU32(data, uint32(len(g.data)))
+	data = append(data, g.data...)
+
+	bin := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	bin = appendWasmSection(bin, 1, typeCount, types)
+	bin = appendWasmSection(bin, 2, len(g.imports), imports)
+	bin = appendWasmSection(bin, 3, len(g.funcs), funcs)
+	bin = appendWasmSection(bin, 5, 1, []byte{0x00, 0x01}) // A memory of a page.
+	bin = appendWasmSection(bin, 7, len(g.funcs)+1, exports)
+	bin = appendWasmSection(bin, 10, len(g.funcs), code)
+	bin = appendWasmSection(bin, 11, 1, data)
+	return bin
+}
+
+func appendWasmSection(dst []byte, id byte, count int, contents []byte) []byte {
+	vec := appendWasmU32(nil, uint32(count))
+	vec = append(vec, contents...)
+	dst = append(dst, id)
+	dst = appendWasmU32(dst, uint32(len(vec)))
+	return append(dst, vec...)
+}
+
+func appendWasmName(dst []byte, name string) []byte {
+	dst = appendWasmU32(dst, uint32(len(name)))
+	return append(dst, name...)
+}
+
+func appendWasmU32(dst []byte, v uint32) []byte {
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 {
+			return append(dst, b)
+		}
+		dst = append(dst, b|0x80)
+	}
+}
+
+func appendWasmI32(dst []byte, v int32) []byte {
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0) {
+			return append(dst, b)
+		}
+		dst = append(dst, b|0x80)
+	}
+}
+
+// i32Const returns the instruction pushing v.
+func i32Const(v int) []byte {
+	return appendWasmI32([]byte{wasmI32Const}, int32(v))
+}
+
+// newLoggingWasmGuest returns the guest which logs the given message at the info level in each callback
+// of the contexts, and continues the streams.
+func newLoggingWasmGuest() *wasmGuest {
+	g := &wasmGuest{}
+	proxyLog := g.importFunc("proxy_log", 3, 1)
+	logInfo := func(msg string) []byte {
+		off := g.addData(msg)
+		code := append(i32Const(int(types.LogLevelInfo)), i32Const(off)...)
+		code = append(code, i32Const(len(msg))...)
+		return append(code, wasmCall, proxyLog, wasmDrop)
+	}
+	cat := func(codes ...[]byte) []byte {
+		var ret []byte
+		for _, c := range codes {
+			ret = append(ret, c...)
+		}
+		return ret
+	}
+
+	g.exportFunc("proxy_on_memory_allocate", 1, 1, i32Const(4096)...)
+	g.exportFunc("proxy_on_vm_start", 2, 1, i32Const(1)...)
+	g.exportFunc("proxy_on_configure", 2, 1, i32Const(1)...)
+	g.exportFunc("proxy_on_done", 1, 1, i32Const(1)...)
+	g.exportFunc("proxy_on_delete", 1, 0)
+	g.exportFunc("proxy_on_log", 1, 0, logInfo("log")...)
+	// Only the contexts other than the plugin contexts are logged.
+	g.exportFunc("proxy_on_context_create", 2, 0,
+		cat([]byte{wasmLocalGet, 1, wasmIf, wasmVoid}, logInfo("context create"), []byte{wasmEnd})...)
+	g.exportFunc("proxy_on_new_connection", 1, 1, cat(logInfo("new connection"), i32Const(0))...)
+	g.exportFunc("proxy_on_downstream_data", 3, 1, cat(logInfo("downstream data"), i32Const(0))...)
+	g.exportFunc("proxy_on_upstream_data", 3, 1, cat(logInfo("upstream data"), i32Const(0))...)
+	g.exportFunc("proxy_on_request_headers", 3, 1, cat(logInfo("request headers"), i32Const(0))...)
+	return g
+}
+
+// newClockWasmGuest returns the guest which logs the raw 8 bytes of the current time on each tick.
+func newClockWasmGuest() *wasmGuest {
+	g := &wasmGuest{}
+	proxyLog := g.importFunc("proxy_log", 3, 1)
+	getCurrentTime := g.importFunc("proxy_get_current_time_nanoseconds", 1, 1)
+	off := g.addData("01234567") // The buffer of the time.
+
+	g.exportFunc("proxy_on_memory_allocate", 1, 1, i32Const(4096)...)
+	g.exportFunc("proxy_on_vm_start", 2, 1, i32Const(1)...)
+	g.exportFunc("proxy_on_configure", 2, 1, i32Const(1)...)
+	g.exportFunc("proxy_on_context_create", 2, 0)
+	tick := append(i32Const(off), wasmCall, getCurrentTime, wasmDrop)
+	tick = append(tick, i32Const(int(types.LogLevelInfo))...)
+	tick = append(tick, i32Const(off)...)
+	tick = append(tick, i32Const(8)...)
+	tick = append(tick, wasmCall, proxyLog, wasmDrop)
+	g.exportFunc("proxy_on_tick", 1, 0, tick...)
+	return g
+}
+
+// newLogLevelWasmGuest returns the guest which logs at the notified level when the log level is changed.
+func newLogLevelWasmGuest() *wasmGuest {
+	g := &wasmGuest{}
+	proxyLog := g.importFunc("proxy_log", 3, 1)
+	msg := "log level changed"
+	off := g.addData(msg)
+
+	g.exportFunc("proxy_on_memory_allocate", 1, 1, i32Const(4096)...)
+	g.exportFunc("proxy_on_vm_start", 2, 1, i32Const(1)...)
+	g.exportFunc("proxy_on_configure", 2, 1, i32Const(1)...)
+	g.exportFunc("proxy_on_context_create", 2, 0)
+	changed := append([]byte{wasmLocalGet, 0}, i32Const(off)...)
+	changed = append(changed, i32Const(len(msg))...)
+	changed = append(changed, wasmCall, proxyLog, wasmDrop)
+	g.exportFunc("proxy_on_log_level_changed", 1, 0, changed...)
+	return g
+}
+
+func newWasmGuestOption(t *testing.T, g *wasmGuest) *EmulatorOption {
+	vm, err := NewWasmVMContext(g.binary())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = vm.Close() })
+	return NewEmulatorOption().WithVMContext(vm)
+}
+
+func TestWasmVMContext_contexts(t *testing.T) {
+	host, reset := NewHostEmulator(newWasmGuestOption(t, newLoggingWasmGuest()))
+	defer reset()
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	t.Run("tcp", func(t *testing.T) {
+		contextID, action := host.InitializeConnection()
+		require.Equal(t, types.ActionContinue, action)
+		require.Equal(t, types.ActionContinue, host.CallOnDownstreamData(contextID, []byte("ping")))
+		require.Equal(t, types.ActionContinue, host.CallOnUpstreamData(contextID, []byte("pong")))
+		host.CompleteConnection(contextID)
+		require.Equal(t, []string{"context create", "new connection", "downstream data", "upstream data", "log"},
+			host.GetInfoLogs())
+	})
+
+	t.Run("http", func(t *testing.T) {
+		contextID := host.InitializeHttpContext()
+		require.Equal(t, types.ActionContinue, host.CallOnRequestHeaders(contextID, nil, true))
+		require.Equal(t, []string{"context create", "new connection", "downstream data", "upstream data", "log",
+			"context create", "request headers"}, host.GetInfoLogs())
+	})
+}
+
+func TestWasmVMContext_currentTime(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	host, reset := NewHostEmulator(newWasmGuestOption(t, newClockWasmGuest()).WithStartTime(start))
+	defer reset()
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	host.Tick()
+	host.AdvanceTime(1500 * time.Millisecond)
+	host.Tick()
+
+	logs := host.GetInfoLogs()
+	require.Len(t, logs, 2)
+	for i, want := range []time.Time{start, start.Add(1500 * time.Millisecond)} {
+		require.Len(t, logs[i], 8)
+		require.Equal(t, want.UnixNano(), int64(binary.LittleEndian.Uint64([]byte(logs[i]))))
+	}
+}
+
+func TestWasmVMContext_logLevel(t *testing.T) {
+	host, reset := NewHostEmulator(newWasmGuestOption(t, newLogLevelWasmGuest()))
+	defer reset()
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	host.SetLogLevel(types.LogLevelWarn)
+	require.Equal(t, []string{"log level changed"}, host.GetWarnLogs())
+	host.SetLogLevel(types.LogLevelError)
+	require.Equal(t, []string{"log level changed"}, host.GetErrorLogs())
+}
@@ -0,0 +1,150 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxywasm
+
+import (
+	"sort"
+	"time"
+)
+
+// Scheduler runs multiple timers on the single tick of a plugin context. Create one for each types.PluginContext,
+// and call OnTick from types.PluginContext.OnTick. The scheduler sets the tick period with SetTickPeriodMilliSeconds
+// to the time until the earliest deadline, and disables the tick when there is no timer,
+// so the plugin must not set the tick period by itself.
+//
+// The deadlines are measured with GetCurrentTime, so timers never fire early, and proxytest.HostEmulator.AdvanceTime
+// fires them deterministically in tests.
+type Scheduler struct {
+	timers  []*Timer
+	nextSeq uint64
+	period  time.Duration
+}
+
+// Timer is a timer scheduled by Scheduler.AfterFunc or Scheduler.Every.
+type Timer struct {
+	s        *Scheduler
+	seq      uint64
+	fn       func()
+	deadline time.Time
+	// interval is zero for the one-shot timers.
+	interval time.Duration
+	active   bool
+}
+
+// NewScheduler returns a new Scheduler.
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// AfterFunc calls fn once after the duration d.
+func (s *Scheduler) AfterFunc(d time.Duration, fn func()) *Timer {
+	return s.add(d, 0, fn)
+}
+
+// Every calls fn every duration d until the returned Timer is stopped. d is rounded up to milliseconds.
+func (s *Scheduler) Every(d time.Duration, fn func()) *Timer {
+	d = roundUpToMillisecond(d)
+	return s.add(d, d, fn)
+}
+
+// Stop stops the timer. This returns false if the timer has already been stopped or fired.
+func (t *Timer) Stop() bool {
+	if !t.active {
+		return false
+	}
+	t.s.remove(t)
+	t.s.updatePeriod(Now())
+	return true
+}
+
+// OnTick fires the timers whose deadlines have passed, in the order of the deadlines.
+func (s *Scheduler) OnTick() {
+	now := Now()
+
+	var due []*Timer
+	for _, t := range s.timers {
+		if !t.deadline.After(now) {
+			due = append(due, t)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].deadline.Equal(due[j].deadline) {
+			return due[i].deadline.Before(due[j].deadline)
+		}
+		return due[i].seq < due[j].seq
+	})
+
+	for _, t := range due {
+		// The timer might have been stopped by the previous one.
+		if !t.active {
+			continue
+		}
+		if t.interval > 0 {
+			t.deadline = t.deadline.Add(t.interval)
+			if !t.deadline.After(now) {
+				t.deadline = now.Add(t.interval)
+			}
+		} else {
+			s.remove(t)
+		}
+		t.fn()
+	}
+	s.updatePeriod(now)
+}
+
+func (s *Scheduler) add(d, interval time.Duration, fn func()) *Timer {
+	now := Now()
+	t := &Timer{s: s, seq: s.nextSeq, fn: fn, deadline: now.Add(d), interval: interval, active: true}
+	s.nextSeq++
+	s.timers = append(s.timers, t)
+	s.updatePeriod(now)
+	return t
+}
+
+func (s *Scheduler) remove(t *Timer) {
+	t.active = false
+	for i, e := range s.timers {
+		if e == t {
+			s.timers = append(s.timers[:i], s.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+// updatePeriod sets the tick period to the time until the earliest deadline.
+// The host restarts the tick when the period is changed, so the next tick comes at the deadline.
+func (s *Scheduler) updatePeriod(now time.Time) {
+	var period time.Duration
+	for i, t := range s.timers {
+		if d := roundUpToMillisecond(t.deadline.Sub(now)); i == 0 || d < period {
+			period = d
+		}
+	}
+	if period == s.period {
+		return
+	}
+	s.period = period
+	if err := SetTickPeriodMilliSeconds(uint32(period / time.Millisecond)); err != nil {
+		LogErrorf("failed to set tick period: %v", err)
+	}
+}
+
+// roundUpToMillisecond rounds d up to milliseconds, which is the unit of the tick period, and at least 1ms.
+func roundUpToMillisecond(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return time.Millisecond
+	}
+	return (d + time.Millisecond - 1) / time.Millisecond * time.Millisecond
+}
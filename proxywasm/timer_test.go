@@ -0,0 +1,108 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxywasm_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+type timerVMContext struct {
+	types.DefaultVMContext
+	plugin *timerPluginContext
+}
+
+type timerPluginContext struct {
+	types.DefaultPluginContext
+	scheduler *proxywasm.Scheduler
+}
+
+// NewPluginContext implements the same method on types.VMContext.
+func (vm *timerVMContext) NewPluginContext(uint32) types.PluginContext {
+	vm.plugin = &timerPluginContext{scheduler: proxywasm.NewScheduler()}
+	return vm.plugin
+}
+
+// OnTick implements the same method on types.PluginContext.
+func (ctx *timerPluginContext) OnTick() {
+	ctx.scheduler.OnTick()
+}
+
+func TestScheduler(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	vm := &timerVMContext{}
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithStartTime(start))
+	defer reset()
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+	s := vm.plugin.scheduler
+
+	var fired []string
+	record := func(name string) func() {
+		return func() {
+			now, err := proxywasm.GetCurrentTime()
+			require.NoError(t, err)
+			fired = append(fired, fmt.Sprintf("%s@%s", name, now.Sub(start)))
+		}
+	}
+	flush := s.Every(5*time.Second, record("flush"))
+	require.Equal(t, uint32(5000), host.GetTickPeriod())
+	s.Every(10*time.Minute, record("refresh"))
+	require.Equal(t, uint32(5000), host.GetTickPeriod())
+
+	// The tick period follows the earliest deadline.
+	host.AdvanceTime(3 * time.Second)
+	once := s.AfterFunc(time.Second, record("once"))
+	require.Equal(t, uint32(1000), host.GetTickPeriod())
+
+	host.AdvanceTime(7 * time.Second)
+	require.Equal(t, []string{"once@4s", "flush@5s", "flush@10s"}, fired)
+	require.False(t, once.Stop())
+	require.Equal(t, uint32(5000), host.GetTickPeriod())
+
+	fired = nil
+	require.True(t, flush.Stop())
+	require.False(t, flush.Stop())
+	require.Equal(t, uint32(590000), host.GetTickPeriod())
+	host.AdvanceTime(10 * time.Minute)
+	require.Equal(t, []string{"refresh@10m0s"}, fired)
+	require.Equal(t, uint32(600000), host.GetTickPeriod())
+
+	t.Run("stop in callback", func(t *testing.T) {
+		fired = nil
+		var second *proxywasm.Timer
+		s.AfterFunc(time.Minute, func() {
+			fired = append(fired, "first")
+			second.Stop()
+		})
+		second = s.AfterFunc(time.Minute, func() { fired = append(fired, "second") })
+		host.AdvanceTime(time.Minute)
+		require.Equal(t, []string{"first"}, fired)
+	})
+
+	t.Run("disabled without timers", func(t *testing.T) {
+		s := proxywasm.NewScheduler()
+		timer := s.Every(time.Second, func() {})
+		require.Equal(t, uint32(1000), host.GetTickPeriod())
+		timer.Stop()
+		require.Equal(t, uint32(0), host.GetTickPeriod())
+	})
+}
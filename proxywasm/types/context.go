@@ -102,6 +102,16 @@ type PluginContext interface {
 	NewHttpContext(contextID uint32) HttpContext
 }
 
+// ForeignFunctionHandler is an optional interface which can be implemented by PluginContext
+// in order to receive events pushed by host extensions via proxy_on_foreign_function.
+// Plugin contexts which do not implement this interface silently ignore such events.
+type ForeignFunctionHandler interface {
+	// OnForeignFunction is called when the host invokes the foreign function of the given functionID
+	// on this plugin context. The argument is available via proxywasm.GetForeignFunctionCallData
+	// during this call.
+	OnForeignFunction(functionID uint32, argSize int)
+}
+
 // TcpContext corresponds to each Tcp stream and is created by PluginContext via NewTcpContext.
 type TcpContext interface {
 	// OnNewConnection is called when the Tcp connection is established between downstream and upstream.
@@ -129,6 +139,8 @@ type TcpContext interface {
 type HttpContext interface {
 	// OnHttpRequestHeaders is called when request headers arrive.
 	// Return types.ActionPause if you want to stop sending headers to the upstream.
+	// Return types.ActionStopAllIterationAndBuffer or types.ActionStopAllIterationAndWatermark if you also want
+	// the host to buffer the body and trailers without calling this context until the stream is resumed.
 	OnHttpRequestHeaders(numHeaders int, endOfStream bool) Action
 
 	// OnHttpRequestBody is called when a request body *frame* arrives.
@@ -143,6 +155,8 @@ type HttpContext interface {
 
 	// OnHttpResponseHeaders is called when response headers arrive.
 	// Return types.ActionPause if you want to stop sending headers to downstream.
+	// Return types.ActionStopAllIterationAndBuffer or types.ActionStopAllIterationAndWatermark if you also want
+	// the host to buffer the body and trailers without calling this context until the stream is resumed.
 	OnHttpResponseHeaders(numHeaders int, endOfStream bool) Action
 
 	// OnHttpResponseBody is called when a response body *frame* arrives.
@@ -161,6 +175,28 @@ type HttpContext interface {
 	OnHttpStreamDone()
 }
 
+// GrpcStreamContext corresponds to each gRPC stream opened via proxywasm.OpenGrpcStream,
+// and receives the events on the stream.
+type GrpcStreamContext interface {
+	// OnGrpcStreamInitialMetadata is called when the initial metadata arrives from the remote.
+	// The metadata is available via proxywasm.GetGrpcStreamInitialMetadata during this call.
+	OnGrpcStreamInitialMetadata(numHeaders int)
+
+	// OnGrpcStreamMessage is called when a message arrives from the remote.
+	// Note that this is potentially called multiple times until the stream is closed.
+	// The message is available via proxywasm.GetGrpcStreamMessage during this call.
+	OnGrpcStreamMessage(messageSize int)
+
+	// OnGrpcStreamTrailingMetadata is called when the trailing metadata arrives from the remote.
+	// The metadata is available via proxywasm.GetGrpcStreamTrailingMetadata during this call.
+	OnGrpcStreamTrailingMetadata(numTrailers int)
+
+	// OnGrpcStreamClose is called when the stream is closed by the remote.
+	// grpcStatus is the gRPC status code of the stream, and 0 means OK.
+	// No further events are delivered for this stream after this call.
+	OnGrpcStreamClose(grpcStatus uint32)
+}
+
 // DefaultContexts are a no-op implementation of contexts.
 // Users can embed them into their custom contexts, so that
 // they only have to implement methods they want.
@@ -176,6 +212,9 @@ type (
 
 	// DefaultHttpContext provides the no-op implementation of the HttpContext interface.
 	DefaultHttpContext struct{}
+
+	// DefaultGrpcStreamContext provides the no-op implementation of the GrpcStreamContext interface.
+	DefaultGrpcStreamContext struct{}
 )
 
 // impl VMContext
@@ -215,9 +254,17 @@ func (*DefaultHttpContext) OnHttpResponseBody(int, bool) Action    { return Acti
 func (*DefaultHttpContext) OnHttpResponseTrailers(int) Action      { return ActionContinue }
 func (*DefaultHttpContext) OnHttpStreamDone()                      {}
 
+// impl GrpcStreamContext
+
+func (*DefaultGrpcStreamContext) OnGrpcStreamInitialMetadata(int)  {}
+func (*DefaultGrpcStreamContext) OnGrpcStreamMessage(int)          {}
+func (*DefaultGrpcStreamContext) OnGrpcStreamTrailingMetadata(int) {}
+func (*DefaultGrpcStreamContext) OnGrpcStreamClose(uint32)         {}
+
 var (
-	_ VMContext     = &DefaultVMContext{}
-	_ PluginContext = &DefaultPluginContext{}
-	_ TcpContext    = &DefaultTcpContext{}
-	_ HttpContext   = &DefaultHttpContext{}
+	_ VMContext         = &DefaultVMContext{}
+	_ PluginContext     = &DefaultPluginContext{}
+	_ TcpContext        = &DefaultTcpContext{}
+	_ HttpContext       = &DefaultHttpContext{}
+	_ GrpcStreamContext = &DefaultGrpcStreamContext{}
 )
@@ -0,0 +1,246 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Headers is the list of the HTTP header (or trailer) key-value pairs in the same format as
+// the ones returned by proxywasm.GetHttpRequestHeaders and friends, so the conversion is free both ways, e.g.
+//
+//	pairs, _ := proxywasm.GetHttpRequestHeaders()
+//	headers := types.Headers(pairs)
+//	headers.Set("x-foo", "bar")
+//	_ = proxywasm.ReplaceHttpRequestHeaders(headers)
+//
+// Keys are compared case-insensitively, and the keys added by Set and Add are lower-cased as hosts do.
+// The same key can appear multiple times, in which case Values returns all of them in order.
+type Headers [][2]string
+
+// IsPseudoHeader returns true if the key is an HTTP/2 pseudo-header such as ":path" and ":authority".
+func IsPseudoHeader(key string) bool {
+	return strings.HasPrefix(key, ":")
+}
+
+// Get returns the first value associated with the key, or empty string if there is none.
+func (h Headers) Get(key string) string {
+	for _, kv := range h {
+		if strings.EqualFold(kv[0], key) {
+			return kv[1]
+		}
+	}
+	return ""
+}
+
+// Has returns true if the key exists.
+func (h Headers) Has(key string) bool {
+	for _, kv := range h {
+		if strings.EqualFold(kv[0], key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Values returns all the values associated with the key in order.
+func (h Headers) Values(key string) []string {
+	var values []string
+	for _, kv := range h {
+		if strings.EqualFold(kv[0], key) {
+			values = append(values, kv[1])
+		}
+	}
+	return values
+}
+
+// Joined returns all the values associated with the key joined into one, in the way allowed by RFC 9110
+// for the headers defined as a list: "; " for "cookie", and ", " for the others.
+// Note that "set-cookie" cannot be joined, so use Values for it.
+func (h Headers) Joined(key string) string {
+	sep := ", "
+	if strings.EqualFold(key, "cookie") {
+		sep = "; "
+	}
+	return strings.Join(h.Values(key), sep)
+}
+
+// Set sets the value of the key, replacing all the existing values.
+func (h *Headers) Set(key, value string) {
+	key = strings.ToLower(key)
+	for i, kv := range *h {
+		if strings.EqualFold(kv[0], key) {
+			(*h)[i] = [2]string{key, value}
+			h.del(key, i+1)
+			return
+		}
+	}
+	h.insert(key, value)
+}
+
+// Add adds the value to the key, keeping the existing values.
+func (h *Headers) Add(key, value string) {
+	h.insert(strings.ToLower(key), value)
+}
+
+// Del deletes all the values associated with the key.
+func (h *Headers) Del(key string) {
+	h.del(key, 0)
+}
+
+// Clone returns a copy of the headers.
+func (h Headers) Clone() Headers {
+	if h == nil {
+		return nil
+	}
+	return append(Headers{}, h...)
+}
+
+// insert appends the key-value pair, but pseudo-headers are inserted before the regular headers
+// as required by HTTP/2.
+func (h *Headers) insert(key, value string) {
+	i := len(*h)
+	if IsPseudoHeader(key) {
+		for i = 0; i < len(*h) && IsPseudoHeader((*h)[i][0]); i++ {
+		}
+	}
+	*h = append(*h, [2]string{})
+	copy((*h)[i+1:], (*h)[i:])
+	(*h)[i] = [2]string{key, value}
+}
+
+func (h *Headers) del(key string, from int) {
+	r := (*h)[:from]
+	for _, kv := range (*h)[from:] {
+		if !strings.EqualFold(kv[0], key) {
+			r = append(r, kv)
+		}
+	}
+	*h = r
+}
+
+// Method returns the value of the ":method" pseudo-header.
+func (h Headers) Method() string { return h.Get(":method") }
+
+// Path returns the value of the ":path" pseudo-header, which includes the query string.
+func (h Headers) Path() string { return h.Get(":path") }
+
+// Authority returns the value of the ":authority" pseudo-header.
+func (h Headers) Authority() string { return h.Get(":authority") }
+
+// Scheme returns the value of the ":scheme" pseudo-header.
+func (h Headers) Scheme() string { return h.Get(":scheme") }
+
+// Status returns the value of the ":status" pseudo-header of responses.
+func (h Headers) Status() string { return h.Get(":status") }
+
+// Query parses the query string of the ":path" pseudo-header.
+func (h Headers) Query() (url.Values, error) {
+	path := h.Path()
+	i := strings.IndexByte(path, '?')
+	if i < 0 {
+		return url.Values{}, nil
+	}
+	query := path[i+1:]
+	if j := strings.IndexByte(query, '#'); j >= 0 {
+		query = query[:j]
+	}
+	return url.ParseQuery(query)
+}
+
+// Cookie returns the value of the cookie of the given name in the "cookie" headers.
+// Unlike keys of headers, names of cookies are case-sensitive.
+func (h Headers) Cookie(name string) (string, bool) {
+	for _, c := range h.Cookies() {
+		if c[0] == name {
+			return c[1], true
+		}
+	}
+	return "", false
+}
+
+// Cookies returns the name-value pairs of the cookies in the "cookie" headers in order.
+// The values are returned as they are, i.e. surrounding double quotes are not removed.
+func (h Headers) Cookies() [][2]string {
+	var cookies [][2]string
+	for _, header := range h.Values("cookie") {
+		for _, c := range strings.Split(header, ";") {
+			c = strings.TrimSpace(c)
+			if c == "" {
+				continue
+			}
+			name, value, _ := strings.Cut(c, "=")
+			cookies = append(cookies, [2]string{name, value})
+		}
+	}
+	return cookies
+}
+
+// ContentType parses the "content-type" header, and returns the lower-cased media type (e.g. "application/json")
+// and the parameters (e.g. "charset"). Parameter names are lower-cased, and quoted values are unquoted.
+// The media type is empty if the header doesn't exist.
+func (h Headers) ContentType() (mediaType string, params map[string]string) {
+	v := h.Get("content-type")
+	mediaType, rest, _ := strings.Cut(v, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	params = map[string]string{}
+	for rest != "" {
+		var param string
+		param, rest = cutParam(rest)
+		name, value, ok := strings.Cut(param, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = unquote(value[1 : len(value)-1])
+		}
+		params[name] = value
+	}
+	return mediaType, params
+}
+
+// cutParam cuts the first parameter delimited by ";" which is not in a quoted string.
+func cutParam(s string) (param, rest string) {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && quoted:
+			i++
+		case c == '"':
+			quoted = !quoted
+		case c == ';' && !quoted:
+			return s[:i], s[i+1:]
+		}
+	}
+	return s, ""
+}
+
+// unquote removes the backslashes of the quoted-pairs in a quoted string.
+func unquote(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,97 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaders(t *testing.T) {
+	h := Headers{{":method", "GET"}, {":path", "/a?x=1&y=2&x=3"}, {"Accept", "text/html"}, {"accept", "*/*"}}
+
+	require.Equal(t, "text/html", h.Get("ACCEPT"))
+	require.Equal(t, []string{"text/html", "*/*"}, h.Values("accept"))
+	require.Equal(t, "text/html, */*", h.Joined("accept"))
+	require.True(t, h.Has("Accept"))
+	require.False(t, h.Has("x-missing"))
+	require.Equal(t, "", h.Get("x-missing"))
+	require.Equal(t, "GET", h.Method())
+	require.Equal(t, "/a?x=1&y=2&x=3", h.Path())
+
+	query, err := h.Query()
+	require.NoError(t, err)
+	require.Equal(t, url.Values{"x": {"1", "3"}, "y": {"2"}}, query)
+
+	orig := h.Clone()
+	h.Set("Accept", "application/json")
+	require.Equal(t, Headers{{":method", "GET"}, {":path", "/a?x=1&y=2&x=3"}, {"accept", "application/json"}}, h)
+	require.Equal(t, "*/*", orig.Values("accept")[1])
+
+	// Pseudo-headers are kept before the regular headers.
+	h.Add(":authority", "example.com")
+	h.Add("X-Foo", "1")
+	h.Add("x-foo", "2")
+	require.Equal(t, Headers{
+		{":method", "GET"}, {":path", "/a?x=1&y=2&x=3"}, {":authority", "example.com"},
+		{"accept", "application/json"}, {"x-foo", "1"}, {"x-foo", "2"},
+	}, h)
+	require.Equal(t, "example.com", h.Authority())
+
+	h.Del("X-FOO")
+	require.False(t, h.Has("x-foo"))
+	require.Len(t, h, 4)
+}
+
+func TestHeaders_Cookies(t *testing.T) {
+	h := Headers{{"cookie", "a=1; b=2"}, {"Cookie", "c=\"3\";d"}}
+	require.Equal(t, [][2]string{{"a", "1"}, {"b", "2"}, {"c", `"3"`}, {"d", ""}}, h.Cookies())
+	require.Equal(t, "a=1; b=2; c=\"3\";d", h.Joined("cookie"))
+
+	v, ok := h.Cookie("b")
+	require.True(t, ok)
+	require.Equal(t, "2", v)
+	_, ok = h.Cookie("B")
+	require.False(t, ok)
+}
+
+func TestHeaders_ContentType(t *testing.T) {
+	for _, tc := range []struct {
+		value     string
+		mediaType string
+		params    map[string]string
+	}{
+		{value: "", mediaType: "", params: map[string]string{}},
+		{value: "application/json", mediaType: "application/json", params: map[string]string{}},
+		{value: "Text/HTML; Charset=UTF-8", mediaType: "text/html", params: map[string]string{"charset": "UTF-8"}},
+		{
+			value:     `multipart/form-data; boundary="a;b\"c"; charset=utf-8`,
+			mediaType: "multipart/form-data",
+			params:    map[string]string{"boundary": `a;b"c`, "charset": "utf-8"},
+		},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			var h Headers
+			if tc.value != "" {
+				h.Set("Content-Type", tc.value)
+			}
+			mediaType, params := h.ContentType()
+			require.Equal(t, tc.mediaType, mediaType)
+			require.Equal(t, tc.params, params)
+		})
+	}
+}
@@ -24,6 +24,16 @@ const (
 	ActionContinue Action = 0
 	// ActionPause means that the host pauses the processing.
 	ActionPause Action = 1
+	// ActionStopAllIterationAndBuffer means that the host pauses the processing of headers, and
+	// also stops delivering the subsequent body and trailers to the plugin, buffering them in the host
+	// until the stream is resumed, e.g. by proxywasm.ResumeHttpRequest. The stream fails if the buffer
+	// exceeds the host's limit. This is only meaningful for the headers callbacks of types.HttpContext,
+	// and is equivalent to ActionPause if returned from the other callbacks.
+	ActionStopAllIterationAndBuffer Action = 3
+	// ActionStopAllIterationAndWatermark is the same as ActionStopAllIterationAndBuffer,
+	// except that the host applies flow control to the peer instead of failing the stream
+	// when the buffer exceeds the host's limit.
+	ActionStopAllIterationAndWatermark Action = 4
 )
 
 // PeerType represents the type of a peer of a connection.
@@ -38,6 +48,56 @@ const (
 	PeerTypeRemote PeerType = 2
 )
 
+// PanicPolicy determines how panics in the callbacks of types.HttpContext are handled.
+// See proxywasm.SetPanicPolicy.
+type PanicPolicy uint32
+
+const (
+	// PanicPolicyNone means that panics are not recovered, which aborts the VM. This is the default.
+	PanicPolicyNone PanicPolicy = 0
+	// PanicPolicyRepanic means that panics are recovered to be reported, and then panic again to abort the VM.
+	PanicPolicyRepanic PanicPolicy = 1
+	// PanicPolicyFailOpen means that panics are reported, and the stream continues as if the callback
+	// returned ActionContinue.
+	PanicPolicyFailOpen PanicPolicy = 2
+	// PanicPolicyFailClosed means that panics are reported, and the stream is replied with
+	// the local response 500. In the response body and trailers callbacks, the stream is reset instead
+	// since the response headers have possibly been sent to the downstream.
+	PanicPolicyFailClosed PanicPolicy = 3
+)
+
+// LogLevel represents the log level of the host.
+type LogLevel uint32
+
+const (
+	LogLevelTrace    LogLevel = 0
+	LogLevelDebug    LogLevel = 1
+	LogLevelInfo     LogLevel = 2
+	LogLevelWarn     LogLevel = 3
+	LogLevelError    LogLevel = 4
+	LogLevelCritical LogLevel = 5
+)
+
+// String implements fmt.Stringer.
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelTrace:
+		return "trace"
+	case LogLevelDebug:
+		return "debug"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelWarn:
+		return "warn"
+	case LogLevelError:
+		return "error"
+	case LogLevelCritical:
+		return "critical"
+	default:
+		return "unknown"
+	}
+}
+
 // OnVMStartStatus is the type of status returned by OnVMStart
 type OnVMStartStatus bool
 
@@ -0,0 +1,168 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ratelimit
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/properties"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+// Descriptor extracts a part of the key of the request, e.g. the client address.
+// Returning types.ErrorStatusNotFound exempts the request from the limit.
+type Descriptor func() (string, error)
+
+// RemoteAddress returns the Descriptor of the IP address of the downstream connection without the port.
+func RemoteAddress() Descriptor {
+	return func() (string, error) {
+		addr, err := properties.GetDownstreamRemoteAddress()
+		if err != nil {
+			return "", err
+		}
+		return stripPort(addr), nil
+	}
+}
+
+// Header returns the Descriptor of the value of the request header.
+func Header(name string) Descriptor {
+	return func() (string, error) {
+		return proxywasm.GetHttpRequestHeader(name)
+	}
+}
+
+// Property returns the Descriptor of the value of the property at the path.
+func Property(path ...string) Descriptor {
+	return func() (string, error) {
+		value, err := proxywasm.GetProperty(path)
+		if err != nil {
+			return "", err
+		}
+		return string(value), nil
+	}
+}
+
+// Response is the response sent to the denied requests.
+type Response struct {
+	StatusCode uint32
+	// Headers are sent in addition to the Retry-After and X-RateLimit-* headers.
+	Headers [][2]string
+	Body    []byte
+}
+
+// Handler limits the HTTP requests with the Limiter by the key made of the values of the descriptors.
+// Each value is prefixed with its length, so that the values containing the separator don't collide,
+// e.g. "a|b" and "c" versus "a" and "b|c". All the requests share the same key if there is no descriptor.
+type Handler struct {
+	limiter     Limiter
+	descriptors []Descriptor
+	response    Response
+}
+
+// NewHandler returns a new Handler which denies the requests with 429 Too Many Requests.
+func NewHandler(limiter Limiter, descriptors ...Descriptor) *Handler {
+	return &Handler{
+		limiter:     limiter,
+		descriptors: descriptors,
+		response:    Response{StatusCode: 429, Body: []byte("Too Many Requests")},
+	}
+}
+
+// WithResponse returns a new Handler which denies the requests with the given response.
+func (h *Handler) WithResponse(response Response) *Handler {
+	n := *h
+	n.response = response
+	return &n
+}
+
+// OnHttpRequestHeaders limits the request, and should be called from types.HttpContext.OnHttpRequestHeaders.
+// This sends the response and returns types.ActionPause if the request is denied. The request is allowed if
+// the limiter fails, e.g. when the CAS retries are exhausted, so that the errors don't block the traffic.
+func (h *Handler) OnHttpRequestHeaders() types.Action {
+	key, err := h.key()
+	if errors.Is(err, types.ErrorStatusNotFound) {
+		return types.ActionContinue
+	} else if err != nil {
+		proxywasm.LogWarnf("failed to get rate limit key: %v", err)
+		return types.ActionContinue
+	}
+
+	res, err := h.limiter.Allow(key)
+	if err != nil {
+		proxywasm.LogWarnf("failed to rate limit %q: %v", key, err)
+		return types.ActionContinue
+	}
+	if res.Allowed {
+		return types.ActionContinue
+	}
+
+	headers := append(res.Headers(), h.response.Headers...)
+	if err := proxywasm.SendHttpResponse(h.response.StatusCode, headers, h.response.Body, -1); err != nil {
+		proxywasm.LogErrorf("failed to send rate limit response: %v", err)
+		return types.ActionContinue
+	}
+	return types.ActionPause
+}
+
+func (h *Handler) key() (string, error) {
+	values := make([]string, len(h.descriptors))
+	for i, d := range h.descriptors {
+		v, err := d()
+		if err != nil {
+			return "", err
+		}
+		values[i] = strconv.Itoa(len(v)) + ":" + v
+	}
+	return strings.Join(values, "|"), nil
+}
+
+// Headers returns the X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset headers,
+// and Retry-After if the request is denied. The durations are in seconds rounded up.
+func (r Result) Headers() [][2]string {
+	headers := [][2]string{
+		{"x-ratelimit-limit", strconv.FormatUint(r.Limit, 10)},
+		{"x-ratelimit-remaining", strconv.FormatUint(r.Remaining, 10)},
+		{"x-ratelimit-reset", strconv.FormatInt(ceilSeconds(r.Reset), 10)},
+	}
+	if !r.Allowed {
+		retryAfter := ceilSeconds(r.RetryAfter)
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		headers = append(headers, [2]string{"retry-after", strconv.FormatInt(retryAfter, 10)})
+	}
+	return headers
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+// stripPort returns the host of "host:port" or "[host]:port", or the address as is if it has no port.
+func stripPort(addr string) string {
+	if strings.HasPrefix(addr, "[") {
+		if i := strings.IndexByte(addr, ']'); i > 0 {
+			return addr[1:i]
+		}
+		return addr
+	}
+	if i := strings.LastIndexByte(addr, ':'); i >= 0 && strings.IndexByte(addr, ':') == i {
+		return addr[:i]
+	}
+	return addr
+}
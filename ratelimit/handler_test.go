@@ -0,0 +1,172 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/ratelimit"
+)
+
+// rateLimitPlugin allows 2 requests per client address every 10 seconds, and the tenants are limited separately.
+type rateLimitPlugin struct {
+	types.DefaultVMContext
+}
+
+type rateLimitPluginContext struct {
+	types.DefaultPluginContext
+	handler *ratelimit.Handler
+}
+
+type rateLimitHttpContext struct {
+	types.DefaultHttpContext
+	handler *ratelimit.Handler
+}
+
+// NewPluginContext implements the same method on types.VMContext.
+func (*rateLimitPlugin) NewPluginContext(uint32) types.PluginContext {
+	limiter := ratelimit.NewTokenBucket("ratelimit", 2, 1, 5*time.Second)
+	handler := ratelimit.NewHandler(limiter, ratelimit.RemoteAddress(), ratelimit.Header("x-tenant")).
+		WithResponse(ratelimit.Response{
+			StatusCode: 429,
+			Headers:    [][2]string{{"content-type", "text/plain"}},
+			Body:       []byte("slow down"),
+		})
+	return &rateLimitPluginContext{handler: handler}
+}
+
+// NewHttpContext implements the same method on types.PluginContext.
+func (p *rateLimitPluginContext) NewHttpContext(uint32) types.HttpContext {
+	return &rateLimitHttpContext{handler: p.handler}
+}
+
+// OnHttpRequestHeaders implements the same method on types.HttpContext.
+func (ctx *rateLimitHttpContext) OnHttpRequestHeaders(int, bool) types.Action {
+	return ctx.handler.OnHttpRequestHeaders()
+}
+
+func newRateLimitOption(addr string) *proxytest.EmulatorOption {
+	return proxytest.NewEmulatorOption().
+		WithVMContext(&rateLimitPlugin{}).
+		WithStartTime(startTime).
+		WithProperty([]string{"source", "address"}, []byte(addr))
+}
+
+func sendRequest(t *testing.T, host proxytest.HostEmulator, tenant string) *proxytest.LocalHttpResponse {
+	t.Helper()
+	id := host.InitializeHttpContext()
+	var headers [][2]string
+	if tenant != "" {
+		headers = append(headers, [2]string{"x-tenant", tenant})
+	}
+	action := host.CallOnRequestHeaders(id, headers, true)
+	res := host.GetSentLocalResponse(id)
+	if res == nil {
+		require.Equal(t, types.ActionContinue, action)
+	} else {
+		require.Equal(t, types.ActionPause, action)
+	}
+	return res
+}
+
+func TestHandler(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(newRateLimitOption("10.0.0.1:50000"))
+	defer reset()
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	require.Nil(t, sendRequest(t, host, "a"))
+	require.Nil(t, sendRequest(t, host, "a"))
+	res := sendRequest(t, host, "a")
+	require.NotNil(t, res)
+	require.Equal(t, uint32(429), res.StatusCode)
+	require.Equal(t, "slow down", string(res.Data))
+	require.Equal(t, [][2]string{
+		{"x-ratelimit-limit", "2"},
+		{"x-ratelimit-remaining", "0"},
+		{"x-ratelimit-reset", "10"},
+		{"retry-after", "5"},
+		{"content-type", "text/plain"},
+	}, res.Headers)
+
+	// The other tenant is limited separately, and the requests without the tenant are not limited.
+	require.Nil(t, sendRequest(t, host, "b"))
+	for i := 0; i < 3; i++ {
+		require.Nil(t, sendRequest(t, host, ""))
+	}
+
+	host.AdvanceTime(5 * time.Second)
+	require.Nil(t, sendRequest(t, host, "a"))
+}
+
+func TestHandler_cluster(t *testing.T) {
+	cluster, reset := proxytest.NewClusterEmulator(
+		newRateLimitOption("10.0.0.1:50000"),
+		newRateLimitOption("10.0.0.1:50001"),
+		newRateLimitOption("[2001:db8::1]:50000"),
+	)
+	defer reset()
+	for i := 0; i < cluster.NumVMs(); i++ {
+		require.Equal(t, types.OnPluginStartStatusOK, cluster.VM(i).StartPlugin())
+	}
+
+	// The connections from the same address to the different VMs share the bucket.
+	require.Nil(t, sendRequest(t, cluster.VM(0), "a"))
+	require.Nil(t, sendRequest(t, cluster.VM(1), "a"))
+	res := sendRequest(t, cluster.VM(0), "a")
+	require.NotNil(t, res)
+	require.Equal(t, uint32(429), res.StatusCode)
+	require.NotNil(t, sendRequest(t, cluster.VM(1), "a"))
+
+	// The other address has its own bucket.
+	require.Nil(t, sendRequest(t, cluster.VM(2), "a"))
+
+	// The shared clock refills the bucket for all the VMs.
+	cluster.VM(0).AdvanceTime(5 * time.Second)
+	require.Nil(t, sendRequest(t, cluster.VM(1), "a"))
+	require.NotNil(t, sendRequest(t, cluster.VM(0), "a"))
+}
+
+// headerPairPlugin allows 1 request per pair of the x-a and x-b headers every 5 seconds.
+type headerPairPlugin struct {
+	types.DefaultVMContext
+}
+
+// NewPluginContext implements the same method on types.VMContext.
+func (*headerPairPlugin) NewPluginContext(uint32) types.PluginContext {
+	limiter := ratelimit.NewTokenBucket("ratelimit", 1, 1, 5*time.Second)
+	return &rateLimitPluginContext{handler: ratelimit.NewHandler(limiter, ratelimit.Header("x-a"), ratelimit.Header("x-b"))}
+}
+
+func TestHandler_keyCollision(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().
+		WithVMContext(&headerPairPlugin{}).WithStartTime(startTime))
+	defer reset()
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	send := func(a, b string) *proxytest.LocalHttpResponse {
+		id := host.InitializeHttpContext()
+		host.CallOnRequestHeaders(id, [][2]string{{"x-a", a}, {"x-b", b}}, true)
+		return host.GetSentLocalResponse(id)
+	}
+	require.Nil(t, send("a|b", "c"))
+	require.NotNil(t, send("a|b", "c"))
+	// The values containing the separator are limited separately.
+	require.Nil(t, send("a", "b|c"))
+	require.Nil(t, send("a|b|", ""))
+}
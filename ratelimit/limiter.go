@@ -0,0 +1,225 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package ratelimit provides the rate limiters shared by all the VMs, whose state is stored in the shared data
+// and updated with CAS, e.g. to allow 100 requests per minute for each client address:
+//
+//	limiter := ratelimit.NewTokenBucket("ratelimit", 100, 100, time.Minute)
+//	handler := ratelimit.NewHandler(limiter, ratelimit.RemoteAddress())
+//
+//	func (ctx *httpContext) OnHttpRequestHeaders(int, bool) types.Action {
+//		return handler.OnHttpRequestHeaders()
+//	}
+//
+// The hosts cannot delete the shared data, so the state of every key is kept until the host restarts.
+// Choose the descriptors whose values are bounded.
+package ratelimit
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/shareddata"
+)
+
+// Limiter decides whether a request for the key is allowed.
+type Limiter interface {
+	// Allow consumes the quota of the key for a request, and returns whether the request is allowed.
+	Allow(key string) (Result, error)
+}
+
+// Result is the decision of a Limiter.
+type Result struct {
+	Allowed bool
+	// Limit is the maximum number of the requests allowed at once.
+	Limit uint64
+	// Remaining is the number of the requests allowed after this one.
+	Remaining uint64
+	// RetryAfter is the time until the next request is allowed, which is zero if Allowed.
+	RetryAfter time.Duration
+	// Reset is the time until the quota is fully restored.
+	Reset time.Duration
+}
+
+// errDenied aborts the update of the state of the denied request.
+var errDenied = errors.New("denied")
+
+// TokenBucket is a Limiter which allows the bursts of up to the capacity, and refills the tokens at the constant rate.
+// The state of each key is a single timestamp, the theoretical arrival time of GCRA, which is equivalent to
+// the token bucket without the floating point arithmetic.
+type TokenBucket struct {
+	capacity uint64
+	// interval is the time to refill a token.
+	interval int64
+	store    *shareddata.Store[uint64]
+}
+
+// NewTokenBucket returns a new TokenBucket holding up to capacity tokens, which are refilled by rate every period.
+// The state is stored in the shared data with the keys prefixed with name and "/".
+func NewTokenBucket(name string, capacity, rate uint64, period time.Duration) *TokenBucket {
+	if rate == 0 || period <= 0 {
+		panic("ratelimit: rate and period must be positive")
+	}
+	interval := int64(period) / int64(rate)
+	if interval == 0 {
+		interval = 1
+	}
+	return &TokenBucket{
+		capacity: capacity,
+		interval: interval,
+		store:    shareddata.NewStore(shareddata.Uint64).WithNamespace(name),
+	}
+}
+
+// Allow implements Limiter.
+func (b *TokenBucket) Allow(key string) (Result, error) {
+	now := proxywasm.Now().UnixNano()
+	burst := int64(b.capacity) * b.interval
+
+	var res Result
+	_, err := b.store.Update(key, func(stored uint64) (uint64, error) {
+		tat := int64(stored)
+		if tat < now {
+			tat = now
+		}
+		next := tat + b.interval
+		if allowAt := next - burst; now < allowAt {
+			res = Result{Limit: b.capacity, RetryAfter: time.Duration(allowAt - now), Reset: time.Duration(tat - now)}
+			return 0, errDenied
+		}
+		res = Result{
+			Allowed:   true,
+			Limit:     b.capacity,
+			Remaining: uint64((now - (next - burst)) / b.interval),
+			Reset:     time.Duration(next - now),
+		}
+		return uint64(next), nil
+	})
+	if err != nil && !errors.Is(err, errDenied) {
+		return Result{}, err
+	}
+	return res, nil
+}
+
+// SlidingWindow is a Limiter which allows up to the limit of the requests in any window. The number of the requests
+// in the window ending now is estimated from the counts of the current and previous fixed windows, assuming
+// that the requests of the previous window were evenly distributed.
+type SlidingWindow struct {
+	limit  uint64
+	window int64
+	store  *shareddata.Store[windowState]
+}
+
+// NewSlidingWindow returns a new SlidingWindow allowing limit requests in every window.
+// The state is stored in the shared data with the keys prefixed with name and "/".
+func NewSlidingWindow(name string, limit uint64, window time.Duration) *SlidingWindow {
+	if window <= 0 {
+		panic("ratelimit: window must be positive")
+	}
+	return &SlidingWindow{
+		limit:  limit,
+		window: int64(window),
+		store:  shareddata.NewStore[windowState](windowStateCodec{}).WithNamespace(name),
+	}
+}
+
+// Allow implements Limiter.
+func (w *SlidingWindow) Allow(key string) (Result, error) {
+	now := proxywasm.Now().UnixNano()
+	start := now - now%w.window
+	elapsed := now - start
+	limit := float64(w.limit)
+
+	var res Result
+	_, err := w.store.Update(key, func(s windowState) (windowState, error) {
+		switch s.start {
+		case start:
+		case start - w.window:
+			s = windowState{start: start, previous: s.current}
+		default:
+			s = windowState{start: start}
+		}
+
+		weight := float64(w.window-elapsed) / float64(w.window)
+		estimate := float64(s.previous)*weight + float64(s.current)
+		if estimate+1 > limit {
+			res = Result{Limit: w.limit, RetryAfter: w.retryAfter(s, elapsed), Reset: time.Duration(w.window - elapsed)}
+			return s, errDenied
+		}
+		s.current++
+		res = Result{
+			Allowed:   true,
+			Limit:     w.limit,
+			Remaining: uint64(limit - estimate - 1),
+			Reset:     time.Duration(w.window - elapsed),
+		}
+		return s, nil
+	})
+	if err != nil && !errors.Is(err, errDenied) {
+		return Result{}, err
+	}
+	return res, nil
+}
+
+// retryAfter returns the time until the estimate becomes low enough to allow a request.
+func (w *SlidingWindow) retryAfter(s windowState, elapsed int64) time.Duration {
+	if w.limit == 0 {
+		return time.Duration(w.window - elapsed)
+	}
+	limit, window := float64(w.limit), float64(w.window)
+	if s.current < w.limit {
+		// The requests of the previous window slide out within the current window.
+		at := int64(math.Ceil(window * (1 - (limit-1-float64(s.current))/float64(s.previous))))
+		return time.Duration(at - elapsed)
+	}
+	// The current window becomes the previous one, whose requests slide out within the next window.
+	at := int64(math.Ceil(window * (1 - (limit-1)/float64(s.current))))
+	if at < 0 {
+		at = 0
+	}
+	return time.Duration(w.window - elapsed + at)
+}
+
+// windowState is the counts of the requests in the fixed window beginning at start and the previous one.
+type windowState struct {
+	start             int64
+	previous, current uint64
+}
+
+// windowStateCodec encodes windowState as the three 8 bytes integers in little endian.
+type windowStateCodec struct{}
+
+// Encode implements shareddata.Codec.
+func (windowStateCodec) Encode(s windowState) ([]byte, error) {
+	buf := make([]byte, 24)
+	binary.LittleEndian.PutUint64(buf, uint64(s.start))
+	binary.LittleEndian.PutUint64(buf[8:], s.previous)
+	binary.LittleEndian.PutUint64(buf[16:], s.current)
+	return buf, nil
+}
+
+// Decode implements shareddata.Codec.
+func (windowStateCodec) Decode(data []byte) (windowState, error) {
+	if len(data) != 24 {
+		return windowState{}, fmt.Errorf("invalid sliding window state of %d bytes", len(data))
+	}
+	return windowState{
+		start:    int64(binary.LittleEndian.Uint64(data)),
+		previous: binary.LittleEndian.Uint64(data[8:]),
+		current:  binary.LittleEndian.Uint64(data[16:]),
+	}, nil
+}
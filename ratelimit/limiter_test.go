@@ -0,0 +1,113 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/ratelimit"
+)
+
+// startTime is aligned to the minute, so that the fixed windows of SlidingWindow begin at the start of the tests.
+var startTime = time.Unix(1_700_000_040, 0)
+
+func TestTokenBucket(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithStartTime(startTime))
+	defer reset()
+
+	limiter := ratelimit.NewTokenBucket("bucket", 3, 1, time.Second)
+	for _, remaining := range []uint64{2, 1, 0} {
+		res, err := limiter.Allow("key")
+		require.NoError(t, err)
+		reset := time.Duration(3-remaining) * time.Second
+		require.Equal(t, ratelimit.Result{Allowed: true, Limit: 3, Remaining: remaining, Reset: reset}, res)
+	}
+	res, err := limiter.Allow("key")
+	require.NoError(t, err)
+	require.Equal(t, ratelimit.Result{Limit: 3, RetryAfter: time.Second, Reset: 3 * time.Second}, res)
+
+	// The other keys have their own buckets.
+	res, err = limiter.Allow("other")
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+
+	// A token is refilled every second.
+	host.AdvanceTime(time.Second)
+	res, err = limiter.Allow("key")
+	require.NoError(t, err)
+	require.Equal(t, ratelimit.Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}, res)
+
+	// The bucket doesn't exceed the capacity.
+	host.AdvanceTime(time.Hour)
+	res, err = limiter.Allow("key")
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), res.Remaining)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithStartTime(startTime))
+	defer reset()
+
+	limiter := ratelimit.NewSlidingWindow("window", 4, time.Minute)
+	for _, remaining := range []uint64{3, 2, 1, 0} {
+		res, err := limiter.Allow("key")
+		require.NoError(t, err)
+		require.Equal(t, ratelimit.Result{Allowed: true, Limit: 4, Remaining: remaining, Reset: time.Minute}, res)
+	}
+	// The 4 requests are counted as 1 in the window ending 45 seconds after the next window begins.
+	res, err := limiter.Allow("key")
+	require.NoError(t, err)
+	require.Equal(t, ratelimit.Result{Limit: 4, RetryAfter: 75 * time.Second, Reset: time.Minute}, res)
+
+	host.AdvanceTime(75 * time.Second)
+	res, err = limiter.Allow("key")
+	require.NoError(t, err)
+	require.Equal(t, ratelimit.Result{Allowed: true, Limit: 4, Remaining: 0, Reset: 45 * time.Second}, res)
+
+	// The requests of the previous window slide out as the time passes.
+	res, err = limiter.Allow("key")
+	require.NoError(t, err)
+	require.Equal(t, ratelimit.Result{Limit: 4, RetryAfter: 15 * time.Second, Reset: 45 * time.Second}, res)
+	host.AdvanceTime(15 * time.Second)
+	res, err = limiter.Allow("key")
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+
+	// The state is reset after a window without requests.
+	host.AdvanceTime(2 * time.Minute)
+	res, err = limiter.Allow("key")
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), res.Remaining)
+}
+
+func TestResult_Headers(t *testing.T) {
+	res := ratelimit.Result{Limit: 10, Remaining: 0, RetryAfter: 1500 * time.Millisecond, Reset: 30 * time.Second}
+	require.Equal(t, [][2]string{
+		{"x-ratelimit-limit", "10"},
+		{"x-ratelimit-remaining", "0"},
+		{"x-ratelimit-reset", "30"},
+		{"retry-after", "2"},
+	}, res.Headers())
+
+	res = ratelimit.Result{Allowed: true, Limit: 10, Remaining: 9, Reset: 100 * time.Millisecond}
+	require.Equal(t, [][2]string{
+		{"x-ratelimit-limit", "10"},
+		{"x-ratelimit-remaining", "9"},
+		{"x-ratelimit-reset", "1"},
+	}, res.Headers())
+}
@@ -0,0 +1,369 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package shareddata
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+// Cache is a cache of T shared by all the VMs, whose entries expire after the TTL and are evicted
+// in the least recently used order when the number of the keys exceeds the limit.
+//
+// The keys are tracked by the index stored in the shared data next to the entries, which is updated with CAS
+// so that the concurrent VMs don't lose each other's keys. The expired entries are evicted lazily when read,
+// and by Sweep, which should be called periodically, e.g. with StartSweeper. Since the hosts cannot delete
+// the shared data, the evicted entries are overwritten with empty data, and only their keys remain in the host.
+//
+// When the number of the keys is limited, a hit on a key in the least recently used half of the index moves the key
+// to the most recently used end, which rewrites the whole index with CAS. The keys in the other half are not moved,
+// so that hot keys don't contend for the index, at the cost of an approximate order among them.
+//
+// The cache counts the hits, misses and evictions with the counter metrics "<name>_hits_total",
+// "<name>_misses_total" and "<name>_evictions_total".
+type Cache[T any] struct {
+	ttl      time.Duration
+	maxKeys  int
+	entries  *Store[cacheEntry[T]]
+	index    *Store[[]indexEntry]
+	indexKey string
+
+	hits, misses, evictions proxywasm.MetricCounter
+}
+
+// NewCache returns a new Cache whose entries are stored with the keys prefixed with name and "/".
+// The entries never expire if ttl is zero, and the number of the keys is not limited if maxKeys is zero.
+// This defines the metrics, and thus should be called on or after types.PluginContext.OnPluginStart.
+func NewCache[T any](name string, codec Codec[T], ttl time.Duration, maxKeys int) *Cache[T] {
+	return &Cache[T]{
+		ttl:       ttl,
+		maxKeys:   maxKeys,
+		entries:   NewStore[cacheEntry[T]](entryCodec[T]{codec: codec}).WithNamespace(name),
+		index:     NewStore[[]indexEntry](indexCodec{}),
+		indexKey:  name + ".index",
+		hits:      proxywasm.DefineCounterMetric(name + "_hits_total"),
+		misses:    proxywasm.DefineCounterMetric(name + "_misses_total"),
+		evictions: proxywasm.DefineCounterMetric(name + "_evictions_total"),
+	}
+}
+
+// Get returns the value of the key, or false if the key doesn't exist or has expired.
+func (c *Cache[T]) Get(key string) (value T, ok bool, err error) {
+	e, _, err := c.entries.Get(key)
+	if err != nil && !errors.Is(err, types.ErrorStatusNotFound) {
+		return value, false, err
+	}
+	if !e.ok {
+		c.misses.Increment(1)
+		return value, false, nil
+	}
+
+	now := proxywasm.Now()
+	if e.expired(now) {
+		c.misses.Increment(1)
+		if _, err := c.evictExpired([]string{key}, now); err != nil {
+			return value, false, err
+		}
+		return value, false, nil
+	}
+
+	c.hits.Increment(1)
+	if c.maxKeys > 0 {
+		// Failing to update the recency only makes the eviction less accurate, so the value is returned regardless.
+		_ = c.touch(key, e.expiry)
+	}
+	return e.value, true, nil
+}
+
+// Set sets the value of the key with the TTL of the cache, and evicts the least recently used keys
+// if the number of the keys exceeds the limit.
+func (c *Cache[T]) Set(key string, value T) error {
+	var expiry int64
+	if c.ttl > 0 {
+		expiry = proxywasm.Now().Add(c.ttl).UnixNano()
+	}
+	entry := cacheEntry[T]{value: value, expiry: expiry, ok: true}
+	if _, err := c.entries.Update(key, func(cacheEntry[T]) (cacheEntry[T], error) { return entry, nil }); err != nil {
+		return err
+	}
+
+	return c.updateIndex(func(index []indexEntry) ([]indexEntry, error) {
+		return append(removeIndexEntry(index, key), indexEntry{key: key, expiry: expiry}), nil
+	})
+}
+
+// Delete deletes the key from the cache.
+func (c *Cache[T]) Delete(key string) error {
+	if err := c.remove(key); err != nil {
+		return err
+	}
+	_, err := c.index.Update(c.indexKey, func(index []indexEntry) ([]indexEntry, error) {
+		return removeIndexEntry(index, key), nil
+	})
+	return err
+}
+
+// Sweep evicts all the expired entries, and returns the number of them.
+func (c *Cache[T]) Sweep() (int, error) {
+	if c.ttl <= 0 {
+		return 0, nil
+	}
+	now := proxywasm.Now()
+	index, _, err := c.index.Get(c.indexKey)
+	if errors.Is(err, types.ErrorStatusNotFound) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	var expired []string
+	for _, e := range index {
+		if e.expired(now) {
+			expired = append(expired, e.key)
+		}
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+	return c.evictExpired(expired, now)
+}
+
+// StartSweeper calls Sweep every interval on the scheduler of the plugin context.
+// The returned timer stops the sweeper.
+func (c *Cache[T]) StartSweeper(s *proxywasm.Scheduler, interval time.Duration) *proxywasm.Timer {
+	return s.Every(interval, func() {
+		if _, err := c.Sweep(); err != nil {
+			proxywasm.LogWarnf("failed to sweep cache %s: %v", c.indexKey, err)
+		}
+	})
+}
+
+// evictExpired removes the keys from the index, and overwrites the entries which are still expired,
+// since another VM may have set them again in the meantime. This returns the number of the evicted entries.
+func (c *Cache[T]) evictExpired(keys []string, now time.Time) (int, error) {
+	_, err := c.index.Update(c.indexKey, func(index []indexEntry) ([]indexEntry, error) {
+		ret := index[:0:0]
+		for _, e := range index {
+			if !e.expired(now) || !containsKey(keys, e.key) {
+				ret = append(ret, e)
+			}
+		}
+		return ret, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var evicted int
+	for _, key := range keys {
+		_, err := c.entries.Update(key, func(e cacheEntry[T]) (cacheEntry[T], error) {
+			if !e.ok || !e.expired(now) {
+				return e, errUnchanged
+			}
+			return cacheEntry[T]{}, nil
+		})
+		if errors.Is(err, errUnchanged) {
+			continue
+		} else if err != nil {
+			return evicted, err
+		}
+		c.evictions.Increment(1)
+		evicted++
+	}
+	return evicted, nil
+}
+
+// remove overwrites the entry of the key with empty data.
+func (c *Cache[T]) remove(key string) error {
+	_, err := c.entries.Update(key, func(e cacheEntry[T]) (cacheEntry[T], error) {
+		if !e.ok {
+			return e, errUnchanged
+		}
+		return cacheEntry[T]{}, nil
+	})
+	if errors.Is(err, errUnchanged) {
+		return nil
+	}
+	return err
+}
+
+// touch moves the key to the most recently used end of the index if it is in the least recently used half.
+// The key is not added back if another VM has evicted it in the meantime.
+func (c *Cache[T]) touch(key string, expiry int64) error {
+	err := c.updateIndex(func(index []indexEntry) ([]indexEntry, error) {
+		i := indexOf(index, key)
+		if i < 0 || i >= len(index)/2 {
+			return nil, errUnchanged
+		}
+		return append(removeIndexEntry(index, key), indexEntry{key: key, expiry: expiry}), nil
+	})
+	if errors.Is(err, errUnchanged) {
+		return nil
+	}
+	return err
+}
+
+// updateIndex updates the index with f, and evicts the least recently used keys exceeding the limit.
+func (c *Cache[T]) updateIndex(f func(index []indexEntry) ([]indexEntry, error)) error {
+	var evicted []string
+	_, err := c.index.Update(c.indexKey, func(index []indexEntry) ([]indexEntry, error) {
+		index, err := f(index)
+		if err != nil {
+			return nil, err
+		}
+		evicted = evicted[:0]
+		if c.maxKeys > 0 && len(index) > c.maxKeys {
+			for _, e := range index[:len(index)-c.maxKeys] {
+				evicted = append(evicted, e.key)
+			}
+			index = index[len(index)-c.maxKeys:]
+		}
+		return index, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range evicted {
+		if err := c.remove(k); err != nil {
+			return err
+		}
+		c.evictions.Increment(1)
+	}
+	return nil
+}
+
+// errUnchanged aborts Store.Update when the value doesn't need to be updated.
+var errUnchanged = errors.New("unchanged")
+
+// cacheEntry is the value of a Cache with its expiry. The evicted entries are stored as empty data,
+// which is decoded as the entry whose ok is false.
+type cacheEntry[T any] struct {
+	value T
+	// expiry is the Unix time in nanoseconds, or zero if the entry never expires.
+	expiry int64
+	ok     bool
+}
+
+func (e cacheEntry[T]) expired(now time.Time) bool {
+	return e.expiry != 0 && now.UnixNano() >= e.expiry
+}
+
+// entryCodec encodes cacheEntry as the 8 bytes expiry in little endian followed by the value.
+type entryCodec[T any] struct {
+	codec Codec[T]
+}
+
+// Encode implements Codec.
+func (c entryCodec[T]) Encode(e cacheEntry[T]) ([]byte, error) {
+	if !e.ok {
+		return []byte{}, nil
+	}
+	data, err := c.codec.Encode(e.value)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 8, 8+len(data))
+	binary.LittleEndian.PutUint64(buf, uint64(e.expiry))
+	return append(buf, data...), nil
+}
+
+// Decode implements Codec.
+func (c entryCodec[T]) Decode(data []byte) (cacheEntry[T], error) {
+	var e cacheEntry[T]
+	if len(data) == 0 {
+		return e, nil
+	}
+	if len(data) < 8 {
+		return e, fmt.Errorf("invalid cache entry of %d bytes", len(data))
+	}
+	value, err := c.codec.Decode(data[8:])
+	if err != nil {
+		return e, err
+	}
+	return cacheEntry[T]{value: value, expiry: int64(binary.LittleEndian.Uint64(data)), ok: true}, nil
+}
+
+// indexEntry is a key of a Cache in the index, which is ordered from the least recently used.
+type indexEntry struct {
+	key    string
+	expiry int64
+}
+
+func (e indexEntry) expired(now time.Time) bool {
+	return e.expiry != 0 && now.UnixNano() >= e.expiry
+}
+
+// indexCodec encodes the index as the sequence of the key length in uvarint, the key and the 8 bytes expiry.
+type indexCodec struct{}
+
+// Encode implements Codec.
+func (indexCodec) Encode(index []indexEntry) ([]byte, error) {
+	var buf []byte
+	for _, e := range index {
+		buf = binary.AppendUvarint(buf, uint64(len(e.key)))
+		buf = append(buf, e.key...)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(e.expiry))
+	}
+	return buf, nil
+}
+
+// Decode implements Codec.
+func (indexCodec) Decode(data []byte) ([]indexEntry, error) {
+	var index []indexEntry
+	for len(data) > 0 {
+		n, size := binary.Uvarint(data)
+		if size <= 0 || uint64(len(data)-size) < n+8 {
+			return nil, errors.New("invalid cache index")
+		}
+		data = data[size:]
+		index = append(index, indexEntry{
+			key:    string(data[:n]),
+			expiry: int64(binary.LittleEndian.Uint64(data[n:])),
+		})
+		data = data[n+8:]
+	}
+	return index, nil
+}
+
+func removeIndexEntry(index []indexEntry, key string) []indexEntry {
+	if i := indexOf(index, key); i >= 0 {
+		return append(index[:i:i], index[i+1:]...)
+	}
+	return index
+}
+
+// indexOf returns the position of the key in the index, or -1 if the key is not in the index.
+func indexOf(index []indexEntry, key string) int {
+	for i, e := range index {
+		if e.key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
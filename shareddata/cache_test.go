@@ -0,0 +1,234 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package shareddata_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/shareddata"
+)
+
+func requireCounters(t *testing.T, host proxytest.HostEmulator, name string, hits, misses, evictions uint64) {
+	t.Helper()
+	for suffix, want := range map[string]uint64{"_hits_total": hits, "_misses_total": misses, "_evictions_total": evictions} {
+		got, err := host.GetCounterMetric(name + suffix)
+		require.NoError(t, err)
+		require.Equal(t, want, got, name+suffix)
+	}
+}
+
+func TestCache(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption())
+	defer reset()
+
+	cache := shareddata.NewCache("sessions", shareddata.String, time.Minute, 0)
+	_, ok, err := cache.Get("a")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, cache.Set("a", "alice"))
+	value, ok, err := cache.Get("a")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "alice", value)
+
+	// The expired entry is evicted on read.
+	host.AdvanceTime(time.Minute)
+	_, ok, err = cache.Get("a")
+	require.NoError(t, err)
+	require.False(t, ok)
+	data, _, err := proxywasm.GetSharedData("sessions/a")
+	require.NoError(t, err)
+	require.Empty(t, data)
+	requireCounters(t, host, "sessions", 1, 2, 1)
+
+	require.NoError(t, cache.Set("b", "bob"))
+	require.NoError(t, cache.Delete("b"))
+	_, ok, err = cache.Get("b")
+	require.NoError(t, err)
+	require.False(t, ok)
+	requireCounters(t, host, "sessions", 1, 3, 1)
+}
+
+func TestCache_maxKeys(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption())
+	defer reset()
+
+	cache := shareddata.NewCache("lru", shareddata.Uint64, 0, 2)
+	require.NoError(t, cache.Set("a", 1))
+	require.NoError(t, cache.Set("b", 2))
+	// Reading a makes b the least recently used.
+	_, ok, err := cache.Get("a")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, cache.Set("c", 3))
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		_, ok, err := cache.Get(key)
+		require.NoError(t, err)
+		require.Equal(t, want, ok, key)
+	}
+	requireCounters(t, host, "lru", 3, 1, 1)
+}
+
+func TestCache_touch(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption())
+	defer reset()
+
+	cache := shareddata.NewCache("touch", shareddata.Uint64, 0, 4)
+	for i, key := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, cache.Set(key, uint64(i)))
+	}
+	indexCas := func() uint32 {
+		_, cas, err := proxywasm.GetSharedData("touch.index")
+		require.NoError(t, err)
+		return cas
+	}
+
+	// The hits on the most recently used half don't rewrite the index.
+	cas := indexCas()
+	for _, key := range []string{"c", "d"} {
+		_, ok, err := cache.Get(key)
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+	require.Equal(t, cas, indexCas())
+
+	// The hit on the least recently used half moves a to the most recently used end, so b is evicted first.
+	_, ok, err := cache.Get("a")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NotEqual(t, cas, indexCas())
+	require.NoError(t, cache.Set("e", 4))
+	_, ok, err = cache.Get("b")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// The key evicted from the index by another VM is not added back by a hit.
+	// The index holding only a is the length of the key, the key and the 8 bytes expiry.
+	onlyA := append([]byte{1, 'a'}, make([]byte, 8)...)
+	require.NoError(t, proxywasm.SetSharedData("touch.index", onlyA, indexCas()))
+	_, ok, err = cache.Get("c")
+	require.NoError(t, err)
+	require.True(t, ok)
+	index, _, err := proxywasm.GetSharedData("touch.index")
+	require.NoError(t, err)
+	require.Equal(t, onlyA, index)
+	requireCounters(t, host, "touch", 4, 1, 1)
+}
+
+func TestCache_Sweep(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption())
+	defer reset()
+
+	cache := shareddata.NewCache("sweep", shareddata.String, time.Minute, 0)
+	require.NoError(t, cache.Set("a", "alice"))
+	host.AdvanceTime(30 * time.Second)
+	require.NoError(t, cache.Set("b", "bob"))
+	host.AdvanceTime(31 * time.Second)
+
+	n, err := cache.Sweep()
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	data, _, err := proxywasm.GetSharedData("sweep/a")
+	require.NoError(t, err)
+	require.Empty(t, data)
+
+	value, ok, err := cache.Get("b")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "bob", value)
+	requireCounters(t, host, "sweep", 1, 0, 1)
+}
+
+// sweeperPlugin caches an entry on start, and sweeps the cache every 10 seconds.
+type sweeperPlugin struct {
+	types.DefaultVMContext
+}
+
+type sweeperPluginContext struct {
+	types.DefaultPluginContext
+	scheduler *proxywasm.Scheduler
+}
+
+// NewPluginContext implements the same method on types.VMContext.
+func (*sweeperPlugin) NewPluginContext(uint32) types.PluginContext {
+	return &sweeperPluginContext{scheduler: proxywasm.NewScheduler()}
+}
+
+// OnPluginStart implements the same method on types.PluginContext.
+func (p *sweeperPluginContext) OnPluginStart(int) types.OnPluginStartStatus {
+	cache := shareddata.NewCache("tokens", shareddata.String, 15*time.Second, 0)
+	if err := cache.Set("token", "secret"); err != nil {
+		proxywasm.LogCriticalf("failed to set cache: %v", err)
+		return types.OnPluginStartStatusFailed
+	}
+	cache.StartSweeper(p.scheduler, 10*time.Second)
+	return types.OnPluginStartStatusOK
+}
+
+// OnTick implements the same method on types.PluginContext.
+func (p *sweeperPluginContext) OnTick() {
+	p.scheduler.OnTick()
+}
+
+func TestCache_StartSweeper(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(&sweeperPlugin{}))
+	defer reset()
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	host.AdvanceTime(10 * time.Second)
+	requireCounters(t, host, "tokens", 0, 0, 0)
+	host.AdvanceTime(10 * time.Second)
+	requireCounters(t, host, "tokens", 0, 0, 1)
+	data, _, err := proxywasm.GetSharedData("tokens/token")
+	require.NoError(t, err)
+	require.Empty(t, data)
+}
+
+func TestCache_cluster(t *testing.T) {
+	cluster, reset := proxytest.NewClusterEmulator(proxytest.NewEmulatorOption(), proxytest.NewEmulatorOption())
+	defer reset()
+
+	// Each VM has its own Cache sharing the entries and the index.
+	cluster.VM(0)
+	cache0 := shareddata.NewCache("shared", shareddata.String, 0, 2)
+	cluster.VM(1)
+	cache1 := shareddata.NewCache("shared", shareddata.String, 0, 2)
+
+	cluster.VM(0)
+	require.NoError(t, cache0.Set("a", "from vm 0"))
+	cluster.VM(1)
+	require.NoError(t, cache1.Set("b", "from vm 1"))
+	require.NoError(t, cache1.Set("c", "from vm 1"))
+
+	// VM 1 evicts the key set by VM 0, since the index is shared.
+	cluster.VM(0)
+	_, ok, err := cache0.Get("a")
+	require.NoError(t, err)
+	require.False(t, ok)
+	value, ok, err := cache0.Get("b")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "from vm 1", value)
+
+	requireCounters(t, cluster.VM(0), "shared", 1, 1, 0)
+	requireCounters(t, cluster.VM(1), "shared", 0, 0, 1)
+}
@@ -0,0 +1,126 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package shareddata
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Codec converts the values of T from and to the bytes stored in the shared data.
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// CodecFuncs is a Codec made of the pair of functions.
+type CodecFuncs[T any] struct {
+	EncodeFunc func(v T) ([]byte, error)
+	DecodeFunc func(data []byte) (T, error)
+}
+
+// Encode implements Codec.
+func (c CodecFuncs[T]) Encode(v T) ([]byte, error) {
+	return c.EncodeFunc(v)
+}
+
+// Decode implements Codec.
+func (c CodecFuncs[T]) Decode(data []byte) (T, error) {
+	return c.DecodeFunc(data)
+}
+
+// Uint64 encodes uint64 as 8 bytes in little endian. Empty data is decoded as zero,
+// so that a key initialized with the empty value can be used as a counter.
+var Uint64 Codec[uint64] = uint64Codec{}
+
+type uint64Codec struct{}
+
+// Encode implements Codec.
+func (uint64Codec) Encode(v uint64) ([]byte, error) {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, v)
+	return buf, nil
+}
+
+// Decode implements Codec.
+func (uint64Codec) Decode(data []byte) (uint64, error) {
+	switch len(data) {
+	case 0:
+		return 0, nil
+	case 8:
+		return binary.LittleEndian.Uint64(data), nil
+	default:
+		return 0, fmt.Errorf("invalid uint64 data of %d bytes", len(data))
+	}
+}
+
+// String stores strings as is.
+var String Codec[string] = stringCodec{}
+
+type stringCodec struct{}
+
+// Encode implements Codec.
+func (stringCodec) Encode(v string) ([]byte, error) {
+	return []byte(v), nil
+}
+
+// Decode implements Codec.
+func (stringCodec) Decode(data []byte) (string, error) {
+	return string(data), nil
+}
+
+// JSONValue is the pointer to T which implements the same methods as json.Marshaler and json.Unmarshaler,
+// e.g. generated by easyjson or tinyjson, since TinyGo doesn't support encoding/json based on reflection.
+type JSONValue[T any] interface {
+	*T
+	MarshalJSON() ([]byte, error)
+	UnmarshalJSON(data []byte) error
+}
+
+// JSON returns the Codec storing T as JSON. e.g. JSON[quota]() for *quota implementing JSONValue.
+func JSON[T any, PT JSONValue[T]]() Codec[T] {
+	return CodecFuncs[T]{
+		EncodeFunc: func(v T) ([]byte, error) {
+			return PT(&v).MarshalJSON()
+		},
+		DecodeFunc: func(data []byte) (T, error) {
+			var v T
+			err := PT(&v).UnmarshalJSON(data)
+			return v, err
+		},
+	}
+}
+
+// ProtoMessage is the pointer to T which implements the marshaling methods generated by
+// protoc-gen-go-lite or vtprotobuf, which work without the reflection of the full protobuf runtime.
+type ProtoMessage[T any] interface {
+	*T
+	MarshalVT() ([]byte, error)
+	UnmarshalVT(data []byte) error
+}
+
+// Proto returns the Codec storing *T in the protobuf wire format, e.g. Proto[pb.Quota]() for Store[*pb.Quota].
+// The values are pointers since the generated messages must not be copied.
+func Proto[T any, PT ProtoMessage[T]]() Codec[PT] {
+	return CodecFuncs[PT]{
+		EncodeFunc: func(v PT) ([]byte, error) {
+			return v.MarshalVT()
+		},
+		DecodeFunc: func(data []byte) (PT, error) {
+			v := PT(new(T))
+			err := v.UnmarshalVT(data)
+			return v, err
+		},
+	}
+}
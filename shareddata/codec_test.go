@@ -0,0 +1,109 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package shareddata_test
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/shareddata"
+)
+
+func TestUint64(t *testing.T) {
+	data, err := shareddata.Uint64.Encode(0x0102)
+	require.NoError(t, err)
+	require.Equal(t, []byte{2, 1, 0, 0, 0, 0, 0, 0}, data)
+
+	v, err := shareddata.Uint64.Decode(data)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0x0102), v)
+
+	v, err = shareddata.Uint64.Decode(nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), v)
+
+	_, err = shareddata.Uint64.Decode([]byte{1, 2, 3})
+	require.Error(t, err)
+}
+
+func TestString(t *testing.T) {
+	data, err := shareddata.String.Encode("value")
+	require.NoError(t, err)
+	v, err := shareddata.String.Decode(data)
+	require.NoError(t, err)
+	require.Equal(t, "value", v)
+}
+
+// quota implements the methods generated by the JSON and protobuf code generators by hand.
+type quota struct {
+	limit int
+}
+
+func (q *quota) MarshalJSON() ([]byte, error) {
+	return []byte(`{"limit":` + strconv.Itoa(q.limit) + "}"), nil
+}
+
+func (q *quota) UnmarshalJSON(data []byte) error {
+	const prefix, suffix = `{"limit":`, "}"
+	s := string(data)
+	if len(s) < len(prefix)+len(suffix) || s[:len(prefix)] != prefix || s[len(s)-len(suffix):] != suffix {
+		return errors.New("invalid quota")
+	}
+	limit, err := strconv.Atoi(s[len(prefix) : len(s)-len(suffix)])
+	q.limit = limit
+	return err
+}
+
+func (q *quota) MarshalVT() ([]byte, error) {
+	return []byte{0x08, byte(q.limit)}, nil
+}
+
+func (q *quota) UnmarshalVT(data []byte) error {
+	if len(data) != 2 || data[0] != 0x08 {
+		return errors.New("invalid quota")
+	}
+	q.limit = int(data[1])
+	return nil
+}
+
+func TestJSON(t *testing.T) {
+	codec := shareddata.JSON[quota]()
+	data, err := codec.Encode(quota{limit: 100})
+	require.NoError(t, err)
+	require.Equal(t, `{"limit":100}`, string(data))
+
+	v, err := codec.Decode(data)
+	require.NoError(t, err)
+	require.Equal(t, quota{limit: 100}, v)
+
+	_, err = codec.Decode([]byte("null"))
+	require.Error(t, err)
+}
+
+func TestProto(t *testing.T) {
+	codec := shareddata.Proto[quota]()
+	data, err := codec.Encode(&quota{limit: 100})
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x08, 100}, data)
+
+	v, err := codec.Decode(data)
+	require.NoError(t, err)
+	require.Equal(t, &quota{limit: 100}, v)
+
+	_, err = codec.Decode(nil)
+	require.Error(t, err)
+}
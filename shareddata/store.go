@@ -0,0 +1,155 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package shareddata provides typed access to the shared data of the host with the automatic retry on the CAS
+// mismatch, e.g. the counter incremented by all the VMs:
+//
+//	var requests = shareddata.NewStore(shareddata.Uint64).WithNamespace("my_plugin")
+//
+//	func (ctx *httpContext) OnHttpRequestHeaders(int, bool) types.Action {
+//		if n, err := shareddata.Increment(requests, "requests", 1); err == nil {
+//			proxywasm.LogInfof("requests: %d", n)
+//		}
+//		return types.ActionContinue
+//	}
+package shareddata
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/properties"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+// DefaultMaxRetries is the default number of the retries of Store.Update on types.ErrorStatusCasMismatch.
+const DefaultMaxRetries = 8
+
+// Store reads and writes the values of T in the shared data. The With* methods return a new Store
+// without modifying the receiver.
+type Store[T any] struct {
+	codec      Codec[T]
+	prefix     string
+	maxRetries int
+}
+
+// NewStore returns a new Store encoding the values with the given Codec.
+func NewStore[T any](codec Codec[T]) *Store[T] {
+	return &Store[T]{codec: codec, maxRetries: DefaultMaxRetries}
+}
+
+// WithNamespace returns a new Store whose keys are prefixed with the namespace and "/", so that the stores
+// of different namespaces don't clobber each other. Namespaces of a Store derived from another are nested.
+func (s *Store[T]) WithNamespace(namespace string) *Store[T] {
+	n := *s
+	n.prefix = s.prefix + namespace + "/"
+	return &n
+}
+
+// WithPluginNamespace returns a new Store namespaced with the plugin name, so that the plugins sharing
+// the same vm_id don't clobber each other. This fails if the plugin name is not available, and
+// thus should be called on or after types.PluginContext.OnPluginStart.
+func (s *Store[T]) WithPluginNamespace() (*Store[T], error) {
+	name, err := properties.GetPluginName()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plugin name: %w", err)
+	}
+	if name == "" {
+		return nil, errors.New("plugin name is empty")
+	}
+	return s.WithNamespace(name), nil
+}
+
+// WithMaxRetries returns a new Store whose Update retries up to n times on types.ErrorStatusCasMismatch.
+func (s *Store[T]) WithMaxRetries(n int) *Store[T] {
+	c := *s
+	c.maxRetries = n
+	return &c
+}
+
+// Key returns the key of the shared data for the given key, which is prefixed with the namespaces.
+func (s *Store[T]) Key(key string) string {
+	return s.prefix + key
+}
+
+// Get returns the value of the key and its cas. This returns types.ErrorStatusNotFound if the key doesn't exist.
+func (s *Store[T]) Get(key string) (value T, cas uint32, err error) {
+	data, cas, err := proxywasm.GetSharedData(s.Key(key))
+	if err != nil {
+		return value, 0, err
+	}
+	if value, err = s.codec.Decode(data); err != nil {
+		return value, 0, fmt.Errorf("failed to decode shared data %q: %w", s.Key(key), err)
+	}
+	return value, cas, nil
+}
+
+// Set sets the value of the key if cas matches the current one, or returns types.ErrorStatusCasMismatch.
+// See proxywasm.SetSharedData for the semantics of cas.
+func (s *Store[T]) Set(key string, value T, cas uint32) error {
+	data, err := s.codec.Encode(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode shared data %q: %w", s.Key(key), err)
+	}
+	return proxywasm.SetSharedData(s.Key(key), data, cas)
+}
+
+// Update replaces the value of the key with the one returned by f, and returns it. f is called with
+// the current value, or the zero value if the key doesn't exist. If another VM updates the key in the meantime,
+// f is called again with the new value up to the max retries, and then types.ErrorStatusCasMismatch is returned.
+// The error returned by f aborts the update and is returned as is.
+//
+// Note that the creation of the key is not atomic, since hosts set the value of the absent key regardless of cas.
+// Initialize the key, e.g. in types.VMContext.OnVMStart, if the concurrent first updates must not be lost.
+func (s *Store[T]) Update(key string, f func(old T) (T, error)) (T, error) {
+	var zero T
+	for i := 0; i <= s.maxRetries; i++ {
+		old, cas, err := s.Get(key)
+		if err != nil && !errors.Is(err, types.ErrorStatusNotFound) {
+			return zero, err
+		}
+
+		next, err := f(old)
+		if err != nil {
+			return zero, err
+		}
+		if err = s.Set(key, next, cas); errors.Is(err, types.ErrorStatusCasMismatch) {
+			continue
+		} else if err != nil {
+			return zero, err
+		}
+		return next, nil
+	}
+	return zero, fmt.Errorf("failed to update shared data %q after %d retries: %w", s.Key(key), s.maxRetries,
+		types.ErrorStatusCasMismatch)
+}
+
+// Increment atomically adds delta to the counter of the key, and returns the new value.
+// The absent key is treated as zero.
+func Increment(s *Store[uint64], key string, delta uint64) (uint64, error) {
+	return s.Update(key, func(old uint64) (uint64, error) {
+		return old + delta, nil
+	})
+}
+
+// Decrement atomically subtracts delta from the counter of the key, and returns the new value.
+// The counter stops at zero instead of wrapping around.
+func Decrement(s *Store[uint64], key string, delta uint64) (uint64, error) {
+	return s.Update(key, func(old uint64) (uint64, error) {
+		if old < delta {
+			return 0, nil
+		}
+		return old - delta, nil
+	})
+}
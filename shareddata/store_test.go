@@ -0,0 +1,193 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package shareddata_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/shareddata"
+)
+
+func TestStore(t *testing.T) {
+	_, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption())
+	defer reset()
+
+	store := shareddata.NewStore(shareddata.String).WithNamespace("a").WithNamespace("b")
+	require.Equal(t, "a/b/key", store.Key("key"))
+
+	_, _, err := store.Get("key")
+	require.ErrorIs(t, err, types.ErrorStatusNotFound)
+
+	require.NoError(t, store.Set("key", "value", 0))
+	value, cas, err := store.Get("key")
+	require.NoError(t, err)
+	require.Equal(t, "value", value)
+
+	raw, _, err := proxywasm.GetSharedData("a/b/key")
+	require.NoError(t, err)
+	require.Equal(t, "value", string(raw))
+
+	require.NoError(t, store.Set("key", "new", cas))
+	require.ErrorIs(t, store.Set("key", "stale", cas), types.ErrorStatusCasMismatch)
+}
+
+func TestStore_WithPluginNamespace(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		opt := proxytest.NewEmulatorOption().WithProperty([]string{"plugin_name"}, []byte("ratelimit"))
+		_, reset := proxytest.NewHostEmulator(opt)
+		defer reset()
+
+		store, err := shareddata.NewStore(shareddata.Uint64).WithPluginNamespace()
+		require.NoError(t, err)
+		require.Equal(t, "ratelimit/requests", store.Key("requests"))
+	})
+
+	t.Run("unavailable", func(t *testing.T) {
+		_, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption())
+		defer reset()
+
+		_, err := shareddata.NewStore(shareddata.Uint64).WithPluginNamespace()
+		require.Error(t, err)
+	})
+}
+
+func TestStore_Update(t *testing.T) {
+	_, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption())
+	defer reset()
+
+	store := shareddata.NewStore(shareddata.Uint64)
+
+	t.Run("retry on cas mismatch", func(t *testing.T) {
+		var olds []uint64
+		value, err := store.Update("retry", func(old uint64) (uint64, error) {
+			olds = append(olds, old)
+			if len(olds) == 1 {
+				// Another VM updates the key between the read and the write.
+				require.NoError(t, store.Set("retry", 10, 0))
+			}
+			return old + 1, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, uint64(11), value)
+		require.Equal(t, []uint64{0, 10}, olds)
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		calls := 0
+		_, err := store.WithMaxRetries(2).Update("exhausted", func(old uint64) (uint64, error) {
+			calls++
+			_, cas, _ := store.Get("exhausted")
+			require.NoError(t, store.Set("exhausted", old+100, cas))
+			return old + 1, nil
+		})
+		require.ErrorIs(t, err, types.ErrorStatusCasMismatch)
+		require.Equal(t, 3, calls)
+	})
+
+	t.Run("aborted", func(t *testing.T) {
+		errOverLimit := errors.New("over limit")
+		_, err := store.Update("aborted", func(uint64) (uint64, error) {
+			return 0, errOverLimit
+		})
+		require.Equal(t, errOverLimit, err)
+		_, _, err = store.Get("aborted")
+		require.ErrorIs(t, err, types.ErrorStatusNotFound)
+	})
+
+	t.Run("invalid data", func(t *testing.T) {
+		require.NoError(t, proxywasm.SetSharedData("invalid", []byte("abc"), 0))
+		_, err := shareddata.Increment(store, "invalid", 1)
+		require.Error(t, err)
+	})
+}
+
+func TestIncrement(t *testing.T) {
+	_, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption())
+	defer reset()
+
+	store := shareddata.NewStore(shareddata.Uint64)
+	value, err := shareddata.Increment(store, "counter", 3)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), value)
+	value, err = shareddata.Increment(store, "counter", 2)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), value)
+
+	value, err = shareddata.Decrement(store, "counter", 4)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), value)
+	// Decrement saturates at zero.
+	value, err = shareddata.Decrement(store, "counter", 4)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), value)
+}
+
+var requests = shareddata.NewStore(shareddata.Uint64).WithNamespace("test")
+
+// counterPlugin increments the shared counter on each tick.
+type counterPlugin struct {
+	types.DefaultVMContext
+}
+
+type counterPluginContext struct {
+	types.DefaultPluginContext
+}
+
+// NewPluginContext implements the same method on types.VMContext.
+func (*counterPlugin) NewPluginContext(uint32) types.PluginContext {
+	return &counterPluginContext{}
+}
+
+// OnTick implements the same method on types.PluginContext.
+func (*counterPluginContext) OnTick() {
+	value, err := shareddata.Increment(requests, "requests", 1)
+	if err != nil {
+		proxywasm.LogCriticalf("failed to increment: %v", err)
+		return
+	}
+	proxywasm.LogInfof("requests: %d", value)
+}
+
+func TestIncrement_cluster(t *testing.T) {
+	cluster, reset := proxytest.NewClusterEmulator(
+		proxytest.NewEmulatorOption().WithVMContext(&counterPlugin{}),
+		proxytest.NewEmulatorOption().WithVMContext(&counterPlugin{}),
+	)
+	defer reset()
+
+	cluster.VM(0).Tick()
+	cluster.VM(1).Tick()
+	require.Equal(t, []string{"requests: 1"}, cluster.VM(0).GetInfoLogs())
+	require.Equal(t, []string{"requests: 2"}, cluster.VM(1).GetInfoLogs())
+
+	// VM 1 increments the counter while VM 0 is in the middle of the update, which is then retried.
+	cluster.VM(0)
+	calls := 0
+	value, err := requests.Update("requests", func(old uint64) (uint64, error) {
+		if calls++; calls == 1 {
+			cluster.VM(1).Tick()
+		}
+		return old + 10, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, calls)
+	require.Equal(t, uint64(13), value)
+	require.Equal(t, []string{"requests: 2", "requests: 3"}, cluster.VM(1).GetInfoLogs())
+}
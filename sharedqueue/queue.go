@@ -0,0 +1,226 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package sharedqueue provides the typed channels over the shared queues. A Sender enqueues the items of T
+// in batches, and a Dispatcher drains the queues on types.PluginContext.OnQueueReady and passes the items
+// to the handler registered for each queue, e.g.
+//
+//	// In the receiver VM.
+//	dispatcher := sharedqueue.NewDispatcher()
+//	_, err := sharedqueue.Register(dispatcher, "access_logs", shareddata.String, func(logs []string) {
+//		...
+//	})
+//
+//	func (ctx *pluginContext) OnQueueReady(queueID uint32) {
+//		ctx.dispatcher.OnQueueReady(queueID)
+//	}
+//
+//	// In the sender VMs.
+//	sender, err := sharedqueue.NewSender("receiver", "access_logs", shareddata.String)
+//	err = sender.Send(line)
+package sharedqueue
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/shareddata"
+)
+
+// Sender enqueues the items of T to a shared queue. Multiple items are encoded into a single entry of the queue,
+// which is cheaper than enqueuing them one by one, since every entry is copied by the host and notifies the receiver.
+type Sender[T any] struct {
+	queueID   uint32
+	codec     shareddata.Codec[T]
+	batchSize int
+	pending   [][]byte
+}
+
+// NewSender returns a new Sender to the queue of the name registered by the VMs of vmID.
+func NewSender[T any](vmID, name string, codec shareddata.Codec[T]) (*Sender[T], error) {
+	queueID, err := proxywasm.ResolveSharedQueue(vmID, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve queue %q of vm %q: %w", name, vmID, err)
+	}
+	return NewSenderFor(queueID, codec), nil
+}
+
+// NewSenderFor returns a new Sender to the queue of queueID.
+func NewSenderFor[T any](queueID uint32, codec shareddata.Codec[T]) *Sender[T] {
+	return &Sender[T]{queueID: queueID, codec: codec, batchSize: 1}
+}
+
+// WithBatchSize returns a new Sender whose Add buffers the items until n items are added.
+// The buffered items must be sent with Flush, e.g. periodically with proxywasm.Scheduler.
+// The items already buffered by s are moved to the new Sender, so that they are neither lost nor sent twice.
+func (s *Sender[T]) WithBatchSize(n int) *Sender[T] {
+	if n < 1 {
+		n = 1
+	}
+	pending := s.pending
+	s.pending = nil
+	return &Sender[T]{queueID: s.queueID, codec: s.codec, batchSize: n, pending: pending}
+}
+
+// QueueID returns the ID of the queue.
+func (s *Sender[T]) QueueID() uint32 {
+	return s.queueID
+}
+
+// Send enqueues the items as a single entry. This doesn't send the items buffered by Add.
+func (s *Sender[T]) Send(items ...T) error {
+	if len(items) == 0 {
+		return nil
+	}
+	encoded := make([][]byte, len(items))
+	for i, item := range items {
+		data, err := s.codec.Encode(item)
+		if err != nil {
+			return fmt.Errorf("failed to encode item: %w", err)
+		}
+		encoded[i] = data
+	}
+	return s.enqueue(encoded)
+}
+
+// Add buffers the item, and enqueues the buffered items as a single entry when the batch size is reached.
+func (s *Sender[T]) Add(item T) error {
+	data, err := s.codec.Encode(item)
+	if err != nil {
+		return fmt.Errorf("failed to encode item: %w", err)
+	}
+	s.pending = append(s.pending, data)
+	if len(s.pending) < s.batchSize {
+		return nil
+	}
+	return s.Flush()
+}
+
+// Flush enqueues the items buffered by Add as a single entry.
+// The items are discarded if the enqueue fails, so that a broken queue doesn't make the buffer grow forever.
+func (s *Sender[T]) Flush() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	pending := s.pending
+	s.pending = nil
+	return s.enqueue(pending)
+}
+
+// Pending returns the number of the items buffered by Add.
+func (s *Sender[T]) Pending() int {
+	return len(s.pending)
+}
+
+func (s *Sender[T]) enqueue(items [][]byte) error {
+	if err := proxywasm.EnqueueSharedQueue(s.queueID, encodeEntry(items)); err != nil {
+		return fmt.Errorf("failed to enqueue %d items to queue %d: %w", len(items), s.queueID, err)
+	}
+	return nil
+}
+
+// Dispatcher passes the items of the shared queues registered by a plugin context to their handlers.
+type Dispatcher struct {
+	handlers map[uint32]func(entries [][]byte)
+}
+
+// NewDispatcher returns a new Dispatcher. Create one for each types.PluginContext,
+// since the queues notify only the plugin context which registered them.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{handlers: map[uint32]func([][]byte){}}
+}
+
+// Register registers the queue of the name, and dispatches its items to the handler. All the items
+// available in the queue are passed to a single call of the handler. The entries which cannot be decoded are
+// logged and skipped. This must be called in the plugin context, e.g. in types.PluginContext.OnPluginStart.
+func Register[T any](d *Dispatcher, name string, codec shareddata.Codec[T], handler func(items []T)) (uint32, error) {
+	queueID, err := proxywasm.RegisterSharedQueue(name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to register queue %q: %w", name, err)
+	}
+	d.handlers[queueID] = func(entries [][]byte) {
+		var items []T
+		for _, entry := range entries {
+			decoded, err := decodeEntry(entry, codec)
+			if err != nil {
+				proxywasm.LogErrorf("failed to decode entry of queue %q: %v", name, err)
+				continue
+			}
+			items = append(items, decoded...)
+		}
+		if len(items) > 0 {
+			handler(items)
+		}
+	}
+	return queueID, nil
+}
+
+// OnQueueReady drains the queue, and passes the items to its handler.
+// This should be called from types.PluginContext.OnQueueReady.
+func (d *Dispatcher) OnQueueReady(queueID uint32) {
+	handler, ok := d.handlers[queueID]
+	if !ok {
+		proxywasm.LogWarnf("no handler for queue %d", queueID)
+		return
+	}
+
+	var entries [][]byte
+	for {
+		data, err := proxywasm.DequeueSharedQueue(queueID)
+		if errors.Is(err, types.ErrorStatusEmpty) {
+			// Another VM may have drained the queue first.
+			break
+		} else if err != nil {
+			proxywasm.LogErrorf("failed to dequeue from queue %d: %v", queueID, err)
+			break
+		}
+		entries = append(entries, data)
+	}
+	if len(entries) > 0 {
+		handler(entries)
+	}
+}
+
+// encodeEntry encodes the items as the sequence of the length in uvarint followed by the item.
+func encodeEntry(items [][]byte) []byte {
+	size := 0
+	for _, item := range items {
+		size += binary.MaxVarintLen64 + len(item)
+	}
+	buf := make([]byte, 0, size)
+	for _, item := range items {
+		buf = binary.AppendUvarint(buf, uint64(len(item)))
+		buf = append(buf, item...)
+	}
+	return buf
+}
+
+func decodeEntry[T any](data []byte, codec shareddata.Codec[T]) ([]T, error) {
+	var items []T
+	for len(data) > 0 {
+		n, size := binary.Uvarint(data)
+		if size <= 0 || uint64(len(data)-size) < n {
+			return nil, errors.New("invalid entry")
+		}
+		item, err := codec.Decode(data[size : size+int(n)])
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		data = data[size+int(n):]
+	}
+	return items, nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2020-2024 Tetrate
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sharedqueue_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/shareddata"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/sharedqueue"
+)
+
+// receiverPlugin registers the queues "events" and "counts", and logs the items of each call of the handlers.
+type receiverPlugin struct {
+	types.DefaultVMContext
+	// paused makes the plugin ignore the notifications, so that the entries pile up in the queues.
+	paused bool
+}
+
+type receiverPluginContext struct {
+	types.DefaultPluginContext
+	vm         *receiverPlugin
+	dispatcher *sharedqueue.Dispatcher
+}
+
+// NewPluginContext implements the same method on types.VMContext.
+func (vm *receiverPlugin) NewPluginContext(uint32) types.PluginContext {
+	return &receiverPluginContext{vm: vm, dispatcher: sharedqueue.NewDispatcher()}
+}
+
+// OnPluginStart implements the same method on types.PluginContext.
+func (p *receiverPluginContext) OnPluginStart(int) types.OnPluginStartStatus {
+	if _, err := sharedqueue.Register(p.dispatcher, "events", shareddata.String, func(events []string) {
+		proxywasm.LogInfof("events: %v", events)
+	}); err != nil {
+		return types.OnPluginStartStatusFailed
+	}
+	if _, err := sharedqueue.Register(p.dispatcher, "counts", shareddata.Uint64, func(counts []uint64) {
+		proxywasm.LogInfof("counts: %v", counts)
+	}); err != nil {
+		return types.OnPluginStartStatusFailed
+	}
+	return types.OnPluginStartStatusOK
+}
+
+// OnQueueReady implements the same method on types.PluginContext.
+func (p *receiverPluginContext) OnQueueReady(queueID uint32) {
+	if !p.vm.paused {
+		p.dispatcher.OnQueueReady(queueID)
+	}
+}
+
+func TestSender(t *testing.T) {
+	receiver := &receiverPlugin{}
+	cluster, reset := proxytest.NewClusterEmulator(
+		proxytest.NewEmulatorOption().WithVMContext(receiver).WithVMID("receiver"),
+		proxytest.NewEmulatorOption().WithVMID("sender"),
+	)
+	defer reset()
+	require.Equal(t, types.OnPluginStartStatusOK, cluster.VM(0).StartPlugin())
+
+	sender := cluster.VM(1)
+	events, err := sharedqueue.NewSender("receiver", "events", shareddata.String)
+	require.NoError(t, err)
+	counts, err := sharedqueue.NewSender("receiver", "counts", shareddata.Uint64)
+	require.NoError(t, err)
+	_, err = sharedqueue.NewSender("receiver", "unknown", shareddata.String)
+	require.Error(t, err)
+
+	// The items sent at once are received at once, and dispatched to the handler of the queue.
+	require.NoError(t, events.Send("a", "b"))
+	require.NoError(t, counts.Send(1))
+	require.NoError(t, events.Send())
+	require.Equal(t, []string{"events: [a b]", "counts: [1]"}, cluster.VM(0).GetInfoLogs())
+
+	// The items added to the batch are sent when the batch is full or flushed.
+	batch := events.WithBatchSize(3)
+	require.NoError(t, batch.Add("c"))
+	require.NoError(t, batch.Add("d"))
+	require.Equal(t, 2, batch.Pending())
+	require.NoError(t, batch.Add("e"))
+	require.NoError(t, batch.Add("f"))
+	require.NoError(t, batch.Flush())
+	require.Equal(t, 0, batch.Pending())
+	require.Equal(t, []string{"events: [a b]", "counts: [1]", "events: [c d e]", "events: [f]"},
+		cluster.VM(0).GetInfoLogs())
+	require.Equal(t, 0, sender.GetQueueSize(events.QueueID()))
+
+	// The buffered items are moved to the Sender with the new batch size.
+	require.NoError(t, batch.Add("g"))
+	larger := batch.WithBatchSize(2)
+	require.Equal(t, 0, batch.Pending())
+	require.Equal(t, 1, larger.Pending())
+	require.NoError(t, larger.Add("h"))
+	require.NoError(t, batch.Flush())
+	require.Equal(t, []string{"events: [a b]", "counts: [1]", "events: [c d e]", "events: [f]", "events: [g h]"},
+		cluster.VM(0).GetInfoLogs())
+}
+
+func TestDispatcher_drain(t *testing.T) {
+	receiver := &receiverPlugin{}
+	cluster, reset := proxytest.NewClusterEmulator(
+		proxytest.NewEmulatorOption().WithVMContext(receiver).WithVMID("receiver"),
+		// The other VM registers the same queue, and is notified after the first one drains it.
+		proxytest.NewEmulatorOption().WithVMContext(receiver).WithVMID("receiver"),
+		proxytest.NewEmulatorOption().WithVMID("sender"),
+	)
+	defer reset()
+	require.Equal(t, types.OnPluginStartStatusOK, cluster.VM(0).StartPlugin())
+	require.Equal(t, types.OnPluginStartStatusOK, cluster.VM(1).StartPlugin())
+
+	cluster.VM(2)
+	events, err := sharedqueue.NewSender("receiver", "events", shareddata.String)
+	require.NoError(t, err)
+
+	receiver.paused = true
+	for i := 0; i < 3; i++ {
+		require.NoError(t, events.Send(fmt.Sprint(i)))
+	}
+	require.Equal(t, 3, cluster.VM(2).GetQueueSize(events.QueueID()))
+
+	// All the entries are drained on the next notification.
+	receiver.paused = false
+	require.NoError(t, events.Send("3", "4"))
+	require.Equal(t, []string{"events: [0 1 2 3 4]"}, cluster.VM(0).GetInfoLogs())
+	require.Empty(t, cluster.VM(1).GetInfoLogs())
+	require.Empty(t, cluster.VM(1).GetErrorLogs())
+}
+
+func TestDispatcher_invalidEntry(t *testing.T) {
+	cluster, reset := proxytest.NewClusterEmulator(
+		proxytest.NewEmulatorOption().WithVMContext(&receiverPlugin{}).WithVMID("receiver"),
+		proxytest.NewEmulatorOption().WithVMID("sender"),
+	)
+	defer reset()
+	require.Equal(t, types.OnPluginStartStatusOK, cluster.VM(0).StartPlugin())
+
+	cluster.VM(1)
+	counts, err := sharedqueue.NewSender("receiver", "counts", shareddata.Uint64)
+	require.NoError(t, err)
+	// The raw data enqueued without Sender cannot be decoded.
+	require.NoError(t, proxywasm.EnqueueSharedQueue(counts.QueueID(), []byte("raw")))
+	require.NoError(t, counts.Send(7))
+
+	require.Len(t, cluster.VM(0).GetErrorLogs(), 1)
+	require.Equal(t, []string{"counts: [7]"}, cluster.VM(0).GetInfoLogs())
+}